@@ -0,0 +1,365 @@
+package s3streamer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/dsnet/compress/bzip2"
+)
+
+// bzip2 blocks are independent once their position in the bit stream is known, so a
+// checkpoint only needs the bit offset of a block. Blocks are not byte aligned and their
+// length is not stored anywhere, so bzip2Decoder scans for the 48-bit block and
+// end-of-stream magics, wraps each block in a synthetic single-block stream and decodes
+// it on its own. A magic that turns up inside compressed data fails the block CRC and is
+// skipped.
+
+const (
+	bzip2BlockMagic = 0x314159265359
+	bzip2EndMagic   = 0x177245385090
+	bzip2MagicMask  = 1<<48 - 1
+
+	// bzip2ReadSize is how much compressed input is buffered at a time.
+	bzip2ReadSize = 64 * 1024
+)
+
+var errBzip2Corrupt = errors.New("bzip2: corrupt stream")
+
+// bzip2 decoder states.
+const (
+	bzip2StateHeader = iota
+	bzip2StateMagic
+	bzip2StateBlock
+	bzip2StateDone
+)
+
+// bzip2Decoder decompresses a (possibly multi-stream) bzip2 stream block by block while
+// recording resumable positions at block boundaries.
+type bzip2Decoder struct {
+	src        io.Reader
+	srcErr     error
+	base       int64  // Absolute bit position of buf[0]
+	buf        []byte // Compressed bytes from the current block onwards
+	pos        int64  // Next bit to scan, relative to base
+	reg        uint64 // The most recently scanned bits
+	blockStart int64  // Start of the current block's magic, relative to base
+
+	state     int
+	streams   int
+	streamCRC uint32 // Combined CRC of the blocks decoded in the current stream
+	verify    bool   // False while finishing a stream that was resumed mid-way
+
+	zr       *bzip2.Reader
+	synth    msbBitWriter
+	blockBuf bytes.Buffer
+
+	out      []byte
+	outPos   int
+	produced int64 // Decompressed offset of the next byte produced
+
+	snapshots snapshotQueue
+	err       error
+}
+
+// newBzip2Decoder starts decoding r, which must be positioned at the first byte of a
+// bzip2 stream, or at the byte holding the block described by cp if cp is not nil.
+func newBzip2Decoder(r io.Reader, start int64, cp *Checkpoint, interval int64) (*bzip2Decoder, error) {
+	zr, err := bzip2.NewReader(bytes.NewReader(nil), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &bzip2Decoder{
+		src:    r,
+		base:   start * 8,
+		state:  bzip2StateHeader,
+		verify: true,
+		zr:     zr,
+	}
+	d.snapshots.init(interval, 0)
+
+	if cp != nil {
+		d.pos = int64(cp.BitOffset)
+		d.produced = cp.BlockOffset
+		d.snapshots.init(interval, cp.BlockOffset)
+		d.streams = 1
+		d.verify = false
+		d.state = bzip2StateMagic
+	}
+	return d, nil
+}
+
+// Read implements io.Reader.
+func (d *bzip2Decoder) Read(p []byte) (int, error) {
+	for d.outPos == len(d.out) {
+		if d.err != nil {
+			return 0, d.err
+		}
+		d.out = nil
+		d.outPos = 0
+		d.err = d.step()
+		d.produced += int64(len(d.out))
+	}
+	n := copy(p, d.out[d.outPos:])
+	d.outPos += n
+	return n, nil
+}
+
+// checkpoint implements checkpointReader.
+func (d *bzip2Decoder) checkpoint(offset int64) (Checkpoint, bool) {
+	return d.snapshots.latest(offset)
+}
+
+// step advances the decoder by one stream header, block or end-of-stream marker.
+func (d *bzip2Decoder) step() error {
+	switch d.state {
+	case bzip2StateHeader:
+		return d.readHeader()
+	case bzip2StateMagic:
+		return d.readMagic()
+	case bzip2StateBlock:
+		return d.scanBlock()
+	default:
+		return io.EOF
+	}
+}
+
+// readHeader parses the 4-byte stream header, or detects the end of the input.
+func (d *bzip2Decoder) readHeader() error {
+	if !d.ensure(d.pos + 8) {
+		if d.streams > 0 && d.srcErr == io.EOF {
+			d.state = bzip2StateDone
+			return io.EOF
+		}
+		return d.truncated()
+	}
+
+	hdr, err := d.bits(d.pos, 32)
+	if err != nil {
+		return err
+	}
+	level := byte(hdr)
+	if hdr>>8 != 'B'<<16|'Z'<<8|'h' || level < '1' || level > '9' {
+		return fmt.Errorf("%w: invalid stream header", errBzip2Corrupt)
+	}
+
+	d.pos += 32
+	d.streams++
+	d.streamCRC = 0
+	d.verify = true
+	d.state = bzip2StateMagic
+	return nil
+}
+
+// readMagic reads the magic that follows a stream header or resumes at a block.
+func (d *bzip2Decoder) readMagic() error {
+	magic, err := d.bits(d.pos, 48)
+	if err != nil {
+		return err
+	}
+	switch magic {
+	case bzip2BlockMagic:
+		d.blockStart = d.pos
+		d.pos += 48
+		d.reg = 0
+		d.state = bzip2StateBlock
+		return nil
+	case bzip2EndMagic:
+		d.pos += 48
+		return d.endStream()
+	default:
+		return fmt.Errorf("%w: missing block magic", errBzip2Corrupt)
+	}
+}
+
+// scanBlock finds the end of the current block, decodes it and queues its output.
+func (d *bzip2Decoder) scanBlock() error {
+	// Skip the block's own magic and CRC before looking for the next magic
+	earliest := d.blockStart + 48 + 32 + 48
+	var lastErr error
+	for {
+		i := d.pos >> 3
+		if i >= int64(len(d.buf)) && !d.ensure(d.pos+1) {
+			if lastErr != nil {
+				return lastErr
+			}
+			return d.truncated()
+		}
+		d.reg = d.reg<<1 | uint64(d.buf[i]>>(7-d.pos&7)&1)
+		d.pos++
+
+		magic := d.reg & bzip2MagicMask
+		if d.pos < earliest || (magic != bzip2BlockMagic && magic != bzip2EndMagic) {
+			continue
+		}
+
+		end := d.pos - 48
+		data, blockCRC, err := d.decodeBlock(d.blockStart, end)
+		if err != nil {
+			lastErr = err // Most likely a magic inside compressed data
+			continue
+		}
+
+		if d.snapshots.due(d.produced) {
+			start := d.base + d.blockStart
+			d.snapshots.add(Checkpoint{
+				Compression:      Bzip2,
+				CompressedOffset: start / 8,
+				BitOffset:        uint8(start % 8),
+				BlockOffset:      d.produced,
+			})
+		}
+		d.out = data
+		d.streamCRC = (d.streamCRC<<1 | d.streamCRC>>31) ^ blockCRC
+
+		if magic == bzip2EndMagic {
+			return d.endStream()
+		}
+		d.blockStart = end
+		d.discardBefore(d.blockStart)
+		return nil
+	}
+}
+
+// decodeBlock decodes the block occupying bits [start, end) of the buffer by wrapping
+// it in a single-block stream, which also verifies the block CRC.
+func (d *bzip2Decoder) decodeBlock(start, end int64) ([]byte, uint32, error) {
+	blockCRC, err := d.bits(start+48, 32)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Level 9 accepts blocks written at any level
+	d.synth.reset()
+	d.synth.writeBits('B'<<24|'Z'<<16|'h'<<8|'9', 32)
+	d.synth.copyBits(d.buf, start, end)
+	d.synth.writeBits(bzip2EndMagic>>24, 24)
+	d.synth.writeBits(bzip2EndMagic&(1<<24-1), 24)
+	d.synth.writeBits(blockCRC, 32)
+
+	if err := d.zr.Reset(bytes.NewReader(d.synth.flush())); err != nil {
+		return nil, 0, err
+	}
+	d.blockBuf.Reset()
+	if _, err := d.blockBuf.ReadFrom(d.zr); err != nil {
+		return nil, 0, fmt.Errorf("%w: %v", errBzip2Corrupt, err)
+	}
+	// The previous block's output has been consumed, so its buffer can be reused
+	return d.blockBuf.Bytes(), uint32(blockCRC), nil
+}
+
+// endStream checks the combined stream CRC and moves to the next stream header.
+func (d *bzip2Decoder) endStream() error {
+	crc, err := d.bits(d.pos, 32)
+	if err != nil {
+		return err
+	}
+	if d.verify && uint32(crc) != d.streamCRC {
+		return fmt.Errorf("%w: stream checksum mismatch", errBzip2Corrupt)
+	}
+	d.pos = (d.pos + 32 + 7) &^ 7
+	d.discardBefore(d.pos)
+	d.state = bzip2StateHeader
+	return nil
+}
+
+// discardBefore drops whole bytes that precede the relative bit position pos.
+func (d *bzip2Decoder) discardBefore(pos int64) {
+	n := pos >> 3
+	if n == 0 {
+		return
+	}
+	d.buf = d.buf[:copy(d.buf, d.buf[n:])]
+	d.base += n * 8
+	d.pos -= n * 8
+	d.blockStart -= n * 8
+}
+
+// ensure buffers input until bit position end (exclusive) is available.
+func (d *bzip2Decoder) ensure(end int64) bool {
+	for int64(len(d.buf))*8 < end {
+		if d.srcErr != nil {
+			return false
+		}
+		n := len(d.buf)
+		if cap(d.buf)-n < bzip2ReadSize {
+			grown := make([]byte, n, 2*cap(d.buf)+bzip2ReadSize)
+			copy(grown, d.buf)
+			d.buf = grown
+		}
+		m, err := d.src.Read(d.buf[n : n+bzip2ReadSize])
+		d.buf = d.buf[:n+m]
+		if err != nil {
+			d.srcErr = err
+		}
+	}
+	return true
+}
+
+// bits reads n (at most 57) bits starting at the relative bit position pos.
+func (d *bzip2Decoder) bits(pos int64, n uint) (uint64, error) {
+	if !d.ensure(pos + int64(n)) {
+		return 0, d.truncated()
+	}
+	var v uint64
+	for i := int64(0); i < int64(n); i++ {
+		p := pos + i
+		v = v<<1 | uint64(d.buf[p>>3]>>(7-p&7)&1)
+	}
+	return v, nil
+}
+
+// truncated converts the source error into the error reported to callers.
+func (d *bzip2Decoder) truncated() error {
+	if d.srcErr == nil || d.srcErr == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return d.srcErr
+}
+
+// msbBitWriter packs bits most significant bit first, as bzip2 expects.
+type msbBitWriter struct {
+	buf   []byte
+	acc   uint64
+	nbits uint
+}
+
+func (w *msbBitWriter) reset() {
+	w.buf = w.buf[:0]
+	w.acc = 0
+	w.nbits = 0
+}
+
+// writeBits appends the low n (at most 32) bits of v.
+func (w *msbBitWriter) writeBits(v uint64, n uint) {
+	w.acc = w.acc<<n | v&(1<<n-1)
+	w.nbits += n
+	for w.nbits >= 8 {
+		w.buf = append(w.buf, byte(w.acc>>(w.nbits-8)))
+		w.nbits -= 8
+	}
+}
+
+// copyBits appends bits [from, to) of src.
+func (w *msbBitWriter) copyBits(src []byte, from, to int64) {
+	for ; from < to && from&7 != 0; from++ {
+		w.writeBits(uint64(src[from>>3]>>(7-from&7)&1), 1)
+	}
+	for ; to-from >= 8; from += 8 {
+		w.writeBits(uint64(src[from>>3]), 8)
+	}
+	for ; from < to; from++ {
+		w.writeBits(uint64(src[from>>3]>>(7-from&7)&1), 1)
+	}
+}
+
+// flush pads the final byte with zeros and returns the packed bytes.
+func (w *msbBitWriter) flush() []byte {
+	if w.nbits > 0 {
+		w.buf = append(w.buf, byte(w.acc<<(8-w.nbits)))
+		w.nbits = 0
+	}
+	return w.buf
+}
@@ -0,0 +1,183 @@
+package s3streamer
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// DefaultCheckpointInterval is the approximate number of decompressed bytes between
+// checkpoints when StreamOptions.CheckpointInterval is not set.
+const DefaultCheckpointInterval = 16 * 1024 * 1024
+
+// errCheckpointsUnsupported is returned before any line is read when checkpoints are
+// requested for an object whose encoding cannot be resumed.
+var errCheckpointsUnsupported = errors.New("checkpoints are not supported")
+
+// Checkpoint records a position in an object that a later StreamWithOptions call can
+// resume from, exactly at a line boundary, even inside a gzip or bzip2 stream. It is
+// safe to serialize with encoding/json; gzip checkpoints carry up to 32KiB of
+// decompressor history in Window.
+// Example:
+//
+//	opts := s3streamer.StreamOptions{
+//	    OnCheckpoint: func(cp s3streamer.Checkpoint) error {
+//	        data, err := json.Marshal(cp)
+//	        if err != nil {
+//	            return err
+//	        }
+//	        return os.WriteFile("progress.json", data, 0o644)
+//	    },
+//	}
+//	err := streamer.StreamWithOptions(ctx, "my-bucket", "data.json.gz", opts, processLine)
+type Checkpoint struct {
+	// Compression is the compression of the object the checkpoint was taken from.
+	Compression Compression `json:"compression"`
+	// ETag and VersionID identify the object version the checkpoint belongs to.
+	// Resuming against a different version fails with an *ObjectChangedError.
+	ETag      string `json:"etag,omitempty"`
+	VersionID string `json:"version_id,omitempty"`
+	// CompressedOffset and BitOffset locate the compressed block where decoding restarts.
+	CompressedOffset int64 `json:"compressed_offset"`
+	BitOffset        uint8 `json:"bit_offset,omitempty"`
+	// MemberStart is set when decoding restarts at a gzip member header.
+	MemberStart bool `json:"member_start,omitempty"`
+	// Window is the deflate history the block at CompressedOffset may refer back to.
+	Window []byte `json:"window,omitempty"`
+	// BlockOffset is the decompressed offset produced by the block at CompressedOffset.
+	BlockOffset int64 `json:"block_offset"`
+	// Offset is the decompressed offset of the next line to process.
+	Offset int64 `json:"offset"`
+	// Line is the number of lines processed before Offset.
+	Line int64 `json:"line"`
+}
+
+// validate rejects checkpoints that cannot describe a valid position.
+func (c *Checkpoint) validate() error {
+	switch {
+	case c.CompressedOffset < 0, c.BlockOffset < 0, c.Line < 0:
+		return fmt.Errorf("invalid checkpoint: negative position")
+	case c.BitOffset > 7:
+		return fmt.Errorf("invalid checkpoint: bit offset %d out of range", c.BitOffset)
+	case c.Offset < c.BlockOffset:
+		return fmt.Errorf("invalid checkpoint: offset %d precedes block offset %d", c.Offset, c.BlockOffset)
+	case len(c.Window) > deflateWindowSize:
+		return fmt.Errorf("invalid checkpoint: window of %d bytes exceeds %d", len(c.Window), deflateWindowSize)
+	}
+	return nil
+}
+
+// objectChanged returns an error if head describes a different object version than
+// the one the checkpoint was taken from.
+func (c *Checkpoint) objectChanged(bucket, key string, head *s3.HeadObjectOutput) error {
+	return objectChanged(bucket, key, c.ETag, c.VersionID, head)
+}
+
+// objectChanged returns an *ObjectChangedError if head does not match the expected
+// ETag and version. Empty expectations match any object.
+func objectChanged(bucket, key, expectedETag, expectedVersionID string, head *s3.HeadObjectOutput) error {
+	etag, versionID := aws.ToString(head.ETag), aws.ToString(head.VersionId)
+	if (expectedETag == "" || expectedETag == etag) && (expectedVersionID == "" || expectedVersionID == versionID) {
+		return nil
+	}
+	return &ObjectChangedError{
+		Bucket:            bucket,
+		Key:               key,
+		ExpectedETag:      expectedETag,
+		ExpectedVersionID: expectedVersionID,
+		ActualETag:        etag,
+		ActualVersionID:   versionID,
+	}
+}
+
+// checkpointReader is a decompressing reader that knows where it can be restarted.
+type checkpointReader interface {
+	io.Reader
+	// checkpoint returns the most recent resumable position at or before the
+	// decompressed offset, if one was recorded since the previous call.
+	checkpoint(offset int64) (Checkpoint, bool)
+}
+
+// newCheckpointReader returns a checkpointReader for r, which holds the object from
+// byte offset start. If cp is not nil, r starts at cp.CompressedOffset and decoding
+// resumes at cp.BlockOffset.
+func newCheckpointReader(r io.Reader, compression Compression, start int64, cp *Checkpoint, interval int64) (checkpointReader, error) {
+	if interval <= 0 {
+		interval = DefaultCheckpointInterval
+	}
+	switch compression {
+	case Uncompressed:
+		return &rawCheckpointReader{r: r, next: start + interval, interval: interval}, nil
+	case Gzip:
+		return newGzipDecoder(bufio.NewReaderSize(r, 64*1024), start, cp, interval)
+	case Bzip2:
+		return newBzip2Decoder(r, start, cp, interval)
+	default:
+		return nil, fmt.Errorf("%w for %s objects", errCheckpointsUnsupported, compression)
+	}
+}
+
+// rawCheckpointReader passes uncompressed data through; every line boundary is
+// resumable, so checkpoints are simply rate limited.
+type rawCheckpointReader struct {
+	r        io.Reader
+	next     int64
+	interval int64
+}
+
+func (r *rawCheckpointReader) Read(p []byte) (int, error) {
+	return r.r.Read(p)
+}
+
+func (r *rawCheckpointReader) checkpoint(offset int64) (Checkpoint, bool) {
+	if offset < r.next {
+		return Checkpoint{}, false
+	}
+	r.next = offset + r.interval
+	return Checkpoint{Compression: Uncompressed, CompressedOffset: offset, BlockOffset: offset}, true
+}
+
+// snapshotQueue holds block boundaries recorded by a decoder until the line scanner,
+// which lags behind the decoder, has processed every line that starts before them.
+type snapshotQueue struct {
+	interval int64
+	next     int64 // Decompressed offset at which the next snapshot is due
+	queue    []Checkpoint
+}
+
+// init resets the queue so that the first snapshot is taken interval bytes after start.
+func (q *snapshotQueue) init(interval, start int64) {
+	q.interval = interval
+	q.next = start + interval
+	q.queue = nil
+}
+
+// due reports whether a block boundary at offset should be recorded.
+func (q *snapshotQueue) due(offset int64) bool {
+	return q.interval > 0 && offset >= q.next
+}
+
+// add records a block boundary.
+func (q *snapshotQueue) add(cp Checkpoint) {
+	q.queue = append(q.queue, cp)
+	q.next = cp.BlockOffset + q.interval
+}
+
+// latest removes and returns the newest boundary at or before offset, dropping any
+// older ones it supersedes.
+func (q *snapshotQueue) latest(offset int64) (Checkpoint, bool) {
+	i := 0
+	for i < len(q.queue) && q.queue[i].BlockOffset <= offset {
+		i++
+	}
+	if i == 0 {
+		return Checkpoint{}, false
+	}
+	cp := q.queue[i-1]
+	q.queue = q.queue[i:]
+	return cp, true
+}
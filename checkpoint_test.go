@@ -0,0 +1,230 @@
+package s3streamer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/dsnet/compress/bzip2"
+)
+
+// streamedLine is a line and offset received by a Stream callback.
+type streamedLine struct {
+	data   string
+	offset int64
+}
+
+// collectCheckpoints streams the whole object, returning every line and checkpoint.
+func collectCheckpoints(t *testing.T, streamer *S3Streamer, interval int64) ([]streamedLine, []Checkpoint) {
+	t.Helper()
+	var lines []streamedLine
+	var checkpoints []Checkpoint
+	err := streamer.StreamWithOptions(context.Background(), "test-bucket", "test-key", StreamOptions{
+		CheckpointInterval: interval,
+		OnCheckpoint: func(cp Checkpoint) error {
+			// Every line before the checkpoint must already have been delivered
+			if cp.Line != int64(len(lines)) {
+				t.Errorf("Checkpoint line = %d, want %d", cp.Line, len(lines))
+			}
+			checkpoints = append(checkpoints, cp)
+			return nil
+		},
+	}, func(line []byte, offset int64) error {
+		lines = append(lines, streamedLine{string(line), offset})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return lines, checkpoints
+}
+
+func TestStreamWithOptionsResumesFromCheckpoints(t *testing.T) {
+	lines := checkpointTestLines(4000)
+
+	tests := []struct {
+		name        string
+		compression Compression
+		data        []byte
+	}{
+		{"uncompressed", Uncompressed, lines},
+		{"gzip", Gzip, compressForTest(t, lines, Gzip, gzip.DefaultCompression, 0)},
+		{"gzip stored blocks", Gzip, compressForTest(t, lines, Gzip, gzip.NoCompression, 0)},
+		{"gzip multi member", Gzip, compressForTest(t, lines, Gzip, gzip.BestSpeed, 40*1024)},
+		{"bzip2", Bzip2, compressForTest(t, lines, Bzip2, bzip2.BestSpeed, 0)},
+		{"bzip2 multi stream", Bzip2, compressForTest(t, lines, Bzip2, bzip2.BestSpeed, 150*1024)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := NewMockS3Client(tt.data)
+			mock.etag = `"etag-v1"`
+			streamer := NewS3Streamer(mock)
+			streamer.chunkSize = 16 * 1024
+
+			all, checkpoints := collectCheckpoints(t, streamer, 64*1024)
+			if len(all) != 4000 {
+				t.Fatalf("Streamed %d lines, want 4000", len(all))
+			}
+			if len(checkpoints) < 3 {
+				t.Fatalf("Expected several checkpoints, got %d", len(checkpoints))
+			}
+
+			for _, cp := range checkpoints {
+				if cp.Compression != tt.compression {
+					t.Errorf("Checkpoint compression = %v, want %v", cp.Compression, tt.compression)
+				}
+				if cp.ETag != `"etag-v1"` {
+					t.Errorf("Checkpoint ETag = %q, want %q", cp.ETag, `"etag-v1"`)
+				}
+
+				// Checkpoints must survive serialization
+				data, err := json.Marshal(cp)
+				if err != nil {
+					t.Fatalf("Failed to marshal checkpoint: %v", err)
+				}
+				var restored Checkpoint
+				if err := json.Unmarshal(data, &restored); err != nil {
+					t.Fatalf("Failed to unmarshal checkpoint: %v", err)
+				}
+
+				var resumed []streamedLine
+				err = streamer.StreamWithOptions(context.Background(), "test-bucket", "test-key", StreamOptions{Checkpoint: &restored},
+					func(line []byte, offset int64) error {
+						resumed = append(resumed, streamedLine{string(line), offset})
+						return nil
+					})
+				if err != nil {
+					t.Fatalf("Resume from line %d failed: %v", cp.Line, err)
+				}
+
+				want := all[cp.Line:]
+				if len(resumed) != len(want) {
+					t.Fatalf("Resume from line %d returned %d lines, want %d", cp.Line, len(resumed), len(want))
+				}
+				for i := range want {
+					if resumed[i] != want[i] {
+						t.Fatalf("Resume from line %d: line %d = %+v, want %+v", cp.Line, i, resumed[i], want[i])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestStreamWithOptionsCheckpointsChainAcrossResumes(t *testing.T) {
+	lines := checkpointTestLines(3000)
+	mock := NewMockS3Client(compressForTest(t, lines, Gzip, gzip.DefaultCompression, 0))
+	streamer := NewS3Streamer(mock)
+
+	// Stop after each checkpoint and resume from it until the stream completes
+	errStop := errors.New("stop")
+	var got bytes.Buffer
+	var cp *Checkpoint
+	for resumes := 0; ; resumes++ {
+		if resumes > 100 {
+			t.Fatal("Stream did not complete")
+		}
+		err := streamer.StreamWithOptions(context.Background(), "test-bucket", "test-key", StreamOptions{
+			Checkpoint:         cp,
+			CheckpointInterval: 32 * 1024,
+			OnCheckpoint: func(next Checkpoint) error {
+				cp = &next
+				return errStop
+			},
+		}, func(line []byte, offset int64) error {
+			if offset != int64(got.Len()) {
+				t.Fatalf("Offset = %d, want %d", offset, got.Len())
+			}
+			got.Write(line)
+			got.WriteByte('\n')
+			return nil
+		})
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, errStop) {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	if !bytes.Equal(got.Bytes(), lines) {
+		t.Error("Lines delivered across resumes do not match the object")
+	}
+}
+
+func TestStreamWithOptionsRejectsChangedObject(t *testing.T) {
+	lines := checkpointTestLines(500)
+	mock := NewMockS3Client(compressForTest(t, lines, Gzip, gzip.DefaultCompression, 0))
+	mock.etag = `"etag-v1"`
+	streamer := NewS3Streamer(mock)
+
+	_, checkpoints := collectCheckpoints(t, streamer, 8*1024)
+	if len(checkpoints) == 0 {
+		t.Fatal("Expected at least one checkpoint")
+	}
+
+	mock.setObject(compressForTest(t, bytes.ToUpper(lines), Gzip, gzip.DefaultCompression, 0), `"etag-v2"`, "")
+	err := streamer.StreamWithOptions(context.Background(), "test-bucket", "test-key", StreamOptions{Checkpoint: &checkpoints[0]},
+		func(line []byte, offset int64) error {
+			t.Fatal("Received a line from the changed object")
+			return nil
+		})
+
+	var changed *ObjectChangedError
+	if !errors.As(err, &changed) {
+		t.Fatalf("Expected ObjectChangedError, got %v", err)
+	}
+	if changed.ActualETag != `"etag-v2"` {
+		t.Errorf("ActualETag = %q, want %q", changed.ActualETag, `"etag-v2"`)
+	}
+}
+
+func TestStreamWithOptionsRejectsInvalidCheckpoint(t *testing.T) {
+	streamer := NewS3Streamer(NewMockS3Client([]byte("line\n")))
+
+	for _, cp := range []Checkpoint{
+		{CompressedOffset: -1},
+		{BitOffset: 8},
+		{BlockOffset: 10, Offset: 5},
+	} {
+		err := streamer.StreamWithOptions(context.Background(), "test-bucket", "test-key", StreamOptions{Checkpoint: &cp},
+			func(line []byte, offset int64) error { return nil })
+		if err == nil {
+			t.Errorf("Expected error for checkpoint %+v", cp)
+		}
+	}
+}
+
+func TestStreamReportsRelativeOffsets(t *testing.T) {
+	testData := []byte("first\nsecond\nthird\n")
+	streamer := NewS3Streamer(NewMockS3Client(testData))
+
+	var offsets []int64
+	err := streamer.Stream(context.Background(), "test-bucket", "test-key", 6, func(line []byte, offset int64) error {
+		offsets = append(offsets, offset)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(offsets) != 2 || offsets[0] != 0 || offsets[1] != 7 {
+		t.Errorf("Stream offsets = %v, want [0 7]", offsets)
+	}
+
+	// StreamWithOptions reports positions in the object instead
+	offsets = nil
+	err = streamer.StreamWithOptions(context.Background(), "test-bucket", "test-key", StreamOptions{Offset: 6}, func(line []byte, offset int64) error {
+		offsets = append(offsets, offset)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(offsets) != 2 || offsets[0] != 6 || offsets[1] != 13 {
+		t.Errorf("StreamWithOptions offsets = %v, want [6 13]", offsets)
+	}
+}
@@ -0,0 +1,258 @@
+package s3streamer
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"hash/crc64"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// crc64NVMEPoly is the reversed CRC-64/NVME polynomial used by S3's CRC64NVME checksums.
+const crc64NVMEPoly = 0x9a6c9329ac4bc9b5
+
+var (
+	crc32cTable    = crc32.MakeTable(crc32.Castagnoli)
+	crc64NVMETable = crc64.MakeTable(crc64NVMEPoly)
+)
+
+// WithChecksum makes S3Writer compute a checksum of every part, send it with the
+// upload so S3 rejects corrupted parts, and include it when completing the upload.
+// Supported algorithms are types.ChecksumAlgorithmCrc32c and
+// types.ChecksumAlgorithmCrc64nvme, which produce a full-object checksum, and
+// types.ChecksumAlgorithmSha256, which produces a composite checksum of the part
+// checksums. Read the result with S3Writer.Checksum after Close.
+// Example:
+//
+//	writer, err := s3streamer.NewS3Writer(ctx, client, "my-bucket", "output.json", 5*1024*1024,
+//	    s3streamer.WithChecksum(types.ChecksumAlgorithmCrc64nvme))
+func WithChecksum(algorithm types.ChecksumAlgorithm) WriterOption {
+	return func(cfg *writerConfig) {
+		cfg.checksum = algorithm
+	}
+}
+
+// ObjectChecksum is the checksum of an object written by S3Writer.
+type ObjectChecksum struct {
+	Algorithm types.ChecksumAlgorithm
+	// Type is types.ChecksumTypeFullObject for a checksum of the whole object, or
+	// types.ChecksumTypeComposite for a checksum of the part checksums
+	Type types.ChecksumType
+	// Value is the base64 encoded checksum as reported by S3. Composite checksums end
+	// with the number of parts, for example "xyz...=-3".
+	Value string
+}
+
+// Checksum returns the checksum of the object after a successful Close. The second
+// result is false if WithChecksum was not used or the object has not been completed.
+// Example:
+//
+//	if err := writer.Close(); err != nil {
+//	    return err
+//	}
+//	if checksum, ok := writer.Checksum(); ok {
+//	    catalog.Record(key, checksum.Algorithm, checksum.Value)
+//	}
+func (w *S3Writer) Checksum() (ObjectChecksum, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.objectChecksum.Value == "" {
+		return ObjectChecksum{}, false
+	}
+	return w.objectChecksum, true
+}
+
+// validateChecksumAlgorithm reports whether S3Writer supports algorithm.
+func validateChecksumAlgorithm(algorithm types.ChecksumAlgorithm) error {
+	switch algorithm {
+	case "", types.ChecksumAlgorithmCrc32c, types.ChecksumAlgorithmCrc64nvme, types.ChecksumAlgorithmSha256:
+		return nil
+	}
+	return fmt.Errorf("unsupported checksum algorithm %q", algorithm)
+}
+
+// checksumType returns how S3 combines the part checksums of a multipart upload.
+func checksumType(algorithm types.ChecksumAlgorithm) types.ChecksumType {
+	if algorithm == types.ChecksumAlgorithmSha256 {
+		return types.ChecksumTypeComposite
+	}
+	return types.ChecksumTypeFullObject
+}
+
+// newChecksumHash returns a hash computing the raw checksum for algorithm, or nil if
+// the algorithm is unknown. CRC sums are big-endian, as S3 encodes them.
+func newChecksumHash(algorithm types.ChecksumAlgorithm) hash.Hash {
+	switch algorithm {
+	case types.ChecksumAlgorithmCrc32:
+		return crc32.NewIEEE()
+	case types.ChecksumAlgorithmCrc32c:
+		return crc32.New(crc32cTable)
+	case types.ChecksumAlgorithmCrc64nvme:
+		return crc64.New(crc64NVMETable)
+	case types.ChecksumAlgorithmSha1:
+		return sha1.New()
+	case types.ChecksumAlgorithmSha256:
+		return sha256.New()
+	}
+	return nil
+}
+
+// computeChecksum returns the raw checksum of data.
+func computeChecksum(algorithm types.ChecksumAlgorithm, data []byte) []byte {
+	h := newChecksumHash(algorithm)
+	if h == nil {
+		return nil
+	}
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// encodeChecksum returns the base64 encoding S3 uses for a raw checksum, or "" for none.
+func encodeChecksum(sum []byte) string {
+	if sum == nil {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(sum)
+}
+
+// combineChecksums returns the object checksum for the raw part checksums and sizes,
+// in part order, encoded the way S3 reports it.
+func combineChecksums(algorithm types.ChecksumAlgorithm, checksums [][]byte, sizes []int64) string {
+	switch algorithm {
+	case types.ChecksumAlgorithmCrc32c:
+		var crc uint64
+		for i, sum := range checksums {
+			crc = crcCombine(crc, uint64(binary.BigEndian.Uint32(sum)), sizes[i], uint64(crc32.Castagnoli), 32)
+		}
+		return base64.StdEncoding.EncodeToString(binary.BigEndian.AppendUint32(nil, uint32(crc)))
+	case types.ChecksumAlgorithmCrc64nvme:
+		var crc uint64
+		for i, sum := range checksums {
+			crc = crcCombine(crc, binary.BigEndian.Uint64(sum), sizes[i], crc64NVMEPoly, 64)
+		}
+		return base64.StdEncoding.EncodeToString(binary.BigEndian.AppendUint64(nil, crc))
+	case types.ChecksumAlgorithmSha256:
+		hash := sha256.New()
+		for _, sum := range checksums {
+			hash.Write(sum)
+		}
+		return fmt.Sprintf("%s-%d", base64.StdEncoding.EncodeToString(hash.Sum(nil)), len(checksums))
+	}
+	return ""
+}
+
+// crcCombine returns the CRC of A followed by B given the CRCs of A and B and the
+// length of B, for a reflected CRC with the reversed polynomial poly. This is zlib's
+// crc32_combine generalised to any width up to 64 bits: appending len(B) zero bytes
+// to A is a linear operation, applied by repeatedly squaring a GF(2) matrix.
+func crcCombine(crcA, crcB uint64, lenB int64, poly uint64, width int) uint64 {
+	if lenB <= 0 {
+		return crcA
+	}
+
+	timesMatrix := func(mat []uint64, vec uint64) uint64 {
+		var sum uint64
+		for i := 0; vec != 0; i, vec = i+1, vec>>1 {
+			if vec&1 != 0 {
+				sum ^= mat[i]
+			}
+		}
+		return sum
+	}
+	squareMatrix := func(square, mat []uint64) {
+		for n := range mat {
+			square[n] = timesMatrix(mat, mat[n])
+		}
+	}
+
+	// Operator for one zero bit
+	odd := make([]uint64, width)
+	even := make([]uint64, width)
+	odd[0] = poly
+	row := uint64(1)
+	for n := 1; n < width; n++ {
+		odd[n] = row
+		row <<= 1
+	}
+	squareMatrix(even, odd) // Two zero bits
+	squareMatrix(odd, even) // Four zero bits
+
+	// Apply len(B) zero bytes to crcA, one bit of the length at a time
+	for {
+		squareMatrix(even, odd)
+		if lenB&1 != 0 {
+			crcA = timesMatrix(even, crcA)
+		}
+		lenB >>= 1
+		if lenB == 0 {
+			break
+		}
+		squareMatrix(odd, even)
+		if lenB&1 != 0 {
+			crcA = timesMatrix(odd, crcA)
+		}
+		lenB >>= 1
+		if lenB == 0 {
+			break
+		}
+	}
+	return crcA ^ crcB
+}
+
+// checksumFields points at the per-algorithm checksum fields of an S3 request or
+// response.
+type checksumFields struct {
+	crc32, crc32c, crc64nvme, sha1, sha256 **string
+}
+
+// field returns the field for algorithm, or nil if it has none.
+func (f checksumFields) field(algorithm types.ChecksumAlgorithm) **string {
+	switch algorithm {
+	case types.ChecksumAlgorithmCrc32:
+		return f.crc32
+	case types.ChecksumAlgorithmCrc32c:
+		return f.crc32c
+	case types.ChecksumAlgorithmCrc64nvme:
+		return f.crc64nvme
+	case types.ChecksumAlgorithmSha1:
+		return f.sha1
+	case types.ChecksumAlgorithmSha256:
+		return f.sha256
+	}
+	return nil
+}
+
+// present returns the first algorithm whose field holds a value, or "" if none does.
+func (f checksumFields) present() types.ChecksumAlgorithm {
+	for _, algorithm := range []types.ChecksumAlgorithm{
+		types.ChecksumAlgorithmCrc64nvme, types.ChecksumAlgorithmCrc32c, types.ChecksumAlgorithmCrc32,
+		types.ChecksumAlgorithmSha256, types.ChecksumAlgorithmSha1,
+	} {
+		if f.get(algorithm) != "" {
+			return algorithm
+		}
+	}
+	return ""
+}
+
+// set stores the base64 encoded value in the field for algorithm.
+func (f checksumFields) set(algorithm types.ChecksumAlgorithm, value string) {
+	if field := f.field(algorithm); field != nil && value != "" {
+		*field = aws.String(value)
+	}
+}
+
+// get returns the value of the field for algorithm.
+func (f checksumFields) get(algorithm types.ChecksumAlgorithm) string {
+	if field := f.field(algorithm); field != nil {
+		return aws.ToString(*field)
+	}
+	return ""
+}
@@ -0,0 +1,229 @@
+package s3streamer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"hash/crc32"
+	"hash/crc64"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestComputeChecksumKnownValues(t *testing.T) {
+	check := []byte("123456789")
+
+	if got := binary.BigEndian.Uint32(computeChecksum(types.ChecksumAlgorithmCrc32c, check)); got != 0xe3069283 {
+		t.Errorf("CRC32C = %#x, want 0xe3069283", got)
+	}
+	if got := binary.BigEndian.Uint64(computeChecksum(types.ChecksumAlgorithmCrc64nvme, check)); got != 0xae8b14860a799888 {
+		t.Errorf("CRC64NVME = %#x, want 0xae8b14860a799888", got)
+	}
+	sum := sha256.Sum256(check)
+	if got := computeChecksum(types.ChecksumAlgorithmSha256, check); !bytes.Equal(got, sum[:]) {
+		t.Errorf("SHA256 = %x, want %x", got, sum)
+	}
+}
+
+func TestCRCCombine(t *testing.T) {
+	rng := rand.New(rand.NewPCG(11, 12))
+	data := make([]byte, 100000)
+	for i := range data {
+		data[i] = byte(rng.IntN(256))
+	}
+
+	for i := 0; i < 20; i++ {
+		split := rng.IntN(len(data) + 1)
+		a, b := data[:split], data[split:]
+
+		crc32c := crcCombine(uint64(crc32.Checksum(a, crc32cTable)), uint64(crc32.Checksum(b, crc32cTable)),
+			int64(len(b)), uint64(crc32.Castagnoli), 32)
+		if uint32(crc32c) != crc32.Checksum(data, crc32cTable) {
+			t.Fatalf("Combined CRC32C at split %d does not match", split)
+		}
+
+		crc64nvme := crcCombine(crc64.Checksum(a, crc64NVMETable), crc64.Checksum(b, crc64NVMETable),
+			int64(len(b)), crc64NVMEPoly, 64)
+		if crc64nvme != crc64.Checksum(data, crc64NVMETable) {
+			t.Fatalf("Combined CRC64NVME at split %d does not match", split)
+		}
+	}
+}
+
+// checksumRecordingClient records the checksums S3Writer sends.
+type checksumRecordingClient struct {
+	*mockS3ClientWriter
+	createInput   *s3.CreateMultipartUploadInput
+	partInputs    []*s3.UploadPartInput
+	completeInput *s3.CompleteMultipartUploadInput
+	putInput      *s3.PutObjectInput
+}
+
+func newChecksumRecordingClient() *checksumRecordingClient {
+	return &checksumRecordingClient{mockS3ClientWriter: &mockS3ClientWriter{}}
+}
+
+func (c *checksumRecordingClient) CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	c.createInput = params
+	return c.mockS3ClientWriter.CreateMultipartUpload(ctx, params, optFns...)
+}
+
+func (c *checksumRecordingClient) UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	c.mu.Lock()
+	c.partInputs = append(c.partInputs, params)
+	c.mu.Unlock()
+	return c.mockS3ClientWriter.UploadPart(ctx, params, optFns...)
+}
+
+func (c *checksumRecordingClient) CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	c.completeInput = params
+	return c.mockS3ClientWriter.CompleteMultipartUpload(ctx, params, optFns...)
+}
+
+func (c *checksumRecordingClient) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	c.putInput = params
+	return c.mockS3ClientWriter.PutObject(ctx, params, optFns...)
+}
+
+func TestS3Writer_Checksums(t *testing.T) {
+	partSize := int64(5 * 1024 * 1024)
+	testData := sizedTestData(2*partSize + 777)
+
+	encode := func(sum []byte) string { return base64.StdEncoding.EncodeToString(sum) }
+	part1 := computeChecksum(types.ChecksumAlgorithmSha256, testData[:partSize])
+	part2 := computeChecksum(types.ChecksumAlgorithmSha256, testData[partSize:2*partSize])
+	part3 := computeChecksum(types.ChecksumAlgorithmSha256, testData[2*partSize:])
+	composite := sha256.Sum256(append(append(append([]byte(nil), part1...), part2...), part3...))
+
+	tests := []struct {
+		algorithm    types.ChecksumAlgorithm
+		checksumType types.ChecksumType
+		want         string
+	}{
+		{types.ChecksumAlgorithmCrc32c, types.ChecksumTypeFullObject, encode(computeChecksum(types.ChecksumAlgorithmCrc32c, testData))},
+		{types.ChecksumAlgorithmCrc64nvme, types.ChecksumTypeFullObject, encode(computeChecksum(types.ChecksumAlgorithmCrc64nvme, testData))},
+		{types.ChecksumAlgorithmSha256, types.ChecksumTypeComposite, encode(composite[:]) + "-3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.algorithm), func(t *testing.T) {
+			client := newChecksumRecordingClient()
+			writer, err := NewS3Writer(context.Background(), client, "test-bucket", "test-key", partSize,
+				WithChecksum(tt.algorithm), WithUploadConcurrency(2))
+			if err != nil {
+				t.Fatalf("Failed to create S3Writer: %v", err)
+			}
+			if _, err := writer.Write(testData); err != nil {
+				t.Fatalf("Failed to write data: %v", err)
+			}
+			if _, ok := writer.Checksum(); ok {
+				t.Error("Checksum available before Close")
+			}
+			if err := writer.Close(); err != nil {
+				t.Fatalf("Failed to close writer: %v", err)
+			}
+
+			if client.createInput.ChecksumAlgorithm != tt.algorithm || client.createInput.ChecksumType != tt.checksumType {
+				t.Errorf("CreateMultipartUpload algorithm %q type %q", client.createInput.ChecksumAlgorithm, client.createInput.ChecksumType)
+			}
+			for _, input := range client.partInputs {
+				want := encode(computeChecksum(tt.algorithm, client.uploadedParts[*input.PartNumber]))
+				got := checksumFields{&input.ChecksumCRC32, &input.ChecksumCRC32C, &input.ChecksumCRC64NVME, &input.ChecksumSHA1, &input.ChecksumSHA256}.get(tt.algorithm)
+				if input.ChecksumAlgorithm != tt.algorithm || got != want {
+					t.Errorf("Part %d sent checksum %q (%s), want %q", *input.PartNumber, got, input.ChecksumAlgorithm, want)
+				}
+			}
+			for _, part := range client.completeInput.MultipartUpload.Parts {
+				if (checksumFields{&part.ChecksumCRC32, &part.ChecksumCRC32C, &part.ChecksumCRC64NVME, &part.ChecksumSHA1, &part.ChecksumSHA256}).get(tt.algorithm) == "" {
+					t.Errorf("Completed part %d has no checksum", *part.PartNumber)
+				}
+			}
+			if client.completeInput.ChecksumType != tt.checksumType {
+				t.Errorf("CompleteMultipartUpload checksum type = %q, want %q", client.completeInput.ChecksumType, tt.checksumType)
+			}
+
+			checksum, ok := writer.Checksum()
+			if !ok {
+				t.Fatal("Checksum not available after Close")
+			}
+			if checksum.Algorithm != tt.algorithm || checksum.Type != tt.checksumType || checksum.Value != tt.want {
+				t.Errorf("Checksum() = %+v, want %s %s %s", checksum, tt.algorithm, tt.checksumType, tt.want)
+			}
+		})
+	}
+}
+
+func TestS3Writer_ChecksumSinglePut(t *testing.T) {
+	client := newChecksumRecordingClient()
+	writer, err := NewS3Writer(context.Background(), client, "test-bucket", "test-key", 5*1024*1024,
+		WithChecksum(types.ChecksumAlgorithmCrc32c))
+	if err != nil {
+		t.Fatalf("Failed to create S3Writer: %v", err)
+	}
+	testData := []byte("small object\n")
+	writer.Write(testData)
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Failed to close writer: %v", err)
+	}
+
+	want := base64.StdEncoding.EncodeToString(computeChecksum(types.ChecksumAlgorithmCrc32c, testData))
+	if got := aws.ToString(client.putInput.ChecksumCRC32C); got != want {
+		t.Errorf("PutObject checksum = %q, want %q", got, want)
+	}
+	if checksum, ok := writer.Checksum(); !ok || checksum.Value != want || checksum.Type != types.ChecksumTypeFullObject {
+		t.Errorf("Checksum() = %+v, %v", checksum, ok)
+	}
+}
+
+func TestS3Writer_ChecksumSurvivesResume(t *testing.T) {
+	ctx := context.Background()
+	partSize := int64(5 * 1024 * 1024)
+	testData := sizedTestData(2*partSize + 10)
+
+	client := newChecksumRecordingClient()
+	writer, err := NewS3Writer(ctx, client, "test-bucket", "test-key", partSize, WithChecksum(types.ChecksumAlgorithmCrc64nvme))
+	if err != nil {
+		t.Fatalf("Failed to create S3Writer: %v", err)
+	}
+	writer.Write(testData[:partSize+5])
+	state := writer.State()
+	if state.ChecksumAlgorithm != types.ChecksumAlgorithmCrc64nvme || state.Parts[0].Checksum == "" {
+		t.Fatalf("State does not record checksums: %+v", state)
+	}
+
+	// A tampered checksum no longer matches what S3 recorded
+	tampered := state
+	tampered.Parts = []UploadedPart{state.Parts[0]}
+	tampered.Parts[0].Checksum = base64.StdEncoding.EncodeToString(make([]byte, 8))
+	if _, err := ResumeS3Writer(ctx, client, tampered); err == nil {
+		t.Error("Expected error for mismatched part checksum")
+	}
+
+	resumed, err := ResumeS3Writer(ctx, client, state)
+	if err != nil {
+		t.Fatalf("Failed to resume S3Writer: %v", err)
+	}
+	resumed.Write(testData[state.BytesCommitted:])
+	if err := resumed.Close(); err != nil {
+		t.Fatalf("Failed to close resumed writer: %v", err)
+	}
+
+	want := base64.StdEncoding.EncodeToString(computeChecksum(types.ChecksumAlgorithmCrc64nvme, testData))
+	if checksum, ok := resumed.Checksum(); !ok || checksum.Value != want {
+		t.Errorf("Checksum() after resume = %+v, want %s", checksum, want)
+	}
+}
+
+func TestS3Writer_UnsupportedChecksum(t *testing.T) {
+	_, err := NewS3Writer(context.Background(), &mockS3ClientWriter{}, "test-bucket", "test-key", 5*1024*1024,
+		WithChecksum(types.ChecksumAlgorithmSha1))
+	if err == nil {
+		t.Error("Expected error for unsupported checksum algorithm")
+	}
+}
@@ -2,15 +2,77 @@ package s3streamer
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"sync"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
+// ReaderOption configures optional behaviour of ChunkStreamer and S3Streamer.
+// Example:
+//
+//	streamer := s3streamer.NewS3Streamer(client, s3streamer.WithReadConcurrency(4))
+type ReaderOption func(*readerConfig)
+
+// readerConfig holds the settings shared by ChunkStreamer and S3Streamer.
+type readerConfig struct {
+	concurrency int         // Number of range requests allowed in flight at once
+	retry       RetryPolicy // How failed or truncated range requests are retried
+	etag        string      // If set, every range request must match this ETag
+	versionID   string      // If set, every range request reads this object version
+	cacheSize   int         // Number of chunks ReadAt keeps cached
+
+	verifyChecksums bool         // Verify reads against the object's stored checksums
+	customerKey     *CustomerKey // SSE-C key sent with every request, if set
+	decryption      KeyProvider  // Client-side decryption for S3Streamer, if set
+}
+
+// newReaderConfig applies opts on top of the defaults.
+func newReaderConfig(opts []ReaderOption) readerConfig {
+	cfg := readerConfig{
+		concurrency: 1,
+		retry:       DefaultRetryPolicy(),
+		cacheSize:   defaultCacheSize,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&cfg)
+		}
+	}
+	return cfg
+}
+
+// WithReadConcurrency sets how many ranged GetObject requests may be in flight at once.
+// Chunks are fetched ahead of the reader into an ordered window, so memory usage is
+// bounded by roughly (n+1) × chunkSize. Values below 1 are treated as 1, which fetches
+// one chunk at a time.
+// Example:
+//
+//	streamer := s3streamer.NewChunkStreamer(ctx, client, "my-bucket", "data.json.gz", 0, size, 5*1024*1024,
+//	    s3streamer.WithReadConcurrency(8))
+func WithReadConcurrency(n int) ReaderOption {
+	return func(cfg *readerConfig) {
+		if n < 1 {
+			n = 1
+		}
+		cfg.concurrency = n
+	}
+}
+
 // ChunkStreamer is an io.Reader implementation that streams data in chunks from S3.
 // It also implements io.Closer for proper resource cleanup.
+//
+// Read-Ahead: With WithReadConcurrency(n), up to n chunks are requested concurrently
+// ahead of the reader. Chunks are always delivered in order. Closing the streamer or
+// cancelling its context aborts all in-flight requests.
+//
+// Random Access: ChunkStreamer also implements io.Seeker and io.ReaderAt over the
+// range it was created for, so it can be handed to archive/zip and similar readers.
+//
 // Example:
 //
 //	streamer := s3streamer.NewChunkStreamer(ctx, client, "my-bucket", "data.json.gz", 0, 1024*1024, 5*1024*1024)
@@ -23,13 +85,32 @@ type ChunkStreamer struct {
 	offset, size  int64
 	chunkSize     int64
 	ctx           context.Context
-	currentOffset int64
+	cancel        context.CancelFunc
+	cfg           readerConfig
+	currentOffset int64 // Start of the next chunk to request
+	pos           int64 // Object offset of the next byte returned by Read
 	eof           bool
+	fetchCtx      context.Context    // Context for read-ahead requests, replaced on Seek
+	fetchCancel   context.CancelFunc // Cancels read-ahead requests made before a Seek
+	cache         *blockCache        // Chunks fetched by ReadAt
+	verifier      *checksumVerifier  // Nil unless checksums are verified
+	verifierReady bool               // The object's checksums have been fetched
 	buffer        []byte
+	window        []*chunkFetch // Requested chunks in object order
+	wg            sync.WaitGroup
+	err           error
 	mu            sync.Mutex
 	closed        bool
 }
 
+// chunkFetch is a single ranged request whose result is published by closing done.
+type chunkFetch struct {
+	start, end int64
+	data       []byte
+	err        error
+	done       chan struct{}
+}
+
 // NewChunkStreamer creates a new ChunkStreamer for retrieving a file from S3 in chunks.
 // Returns nil if required parameters are invalid.
 // Example:
@@ -38,7 +119,7 @@ type ChunkStreamer struct {
 //	if streamer == nil {
 //	    return fmt.Errorf("invalid parameters")
 //	}
-func NewChunkStreamer(ctx context.Context, client S3Client, bucket, key string, offset, size, chunkSize int64) *ChunkStreamer {
+func NewChunkStreamer(ctx context.Context, client S3Client, bucket, key string, offset, size, chunkSize int64, opts ...ReaderOption) *ChunkStreamer {
 	// Validate required parameters
 	if ctx == nil {
 		return nil
@@ -62,6 +143,9 @@ func NewChunkStreamer(ctx context.Context, client S3Client, bucket, key string,
 		return nil
 	}
 
+	ctx, cancel := context.WithCancel(ctx)
+	fetchCtx, fetchCancel := context.WithCancel(ctx)
+	cfg := newReaderConfig(opts)
 	return &ChunkStreamer{
 		client:        client,
 		bucket:        bucket,
@@ -70,8 +154,14 @@ func NewChunkStreamer(ctx context.Context, client S3Client, bucket, key string,
 		size:          size,
 		chunkSize:     chunkSize,
 		ctx:           ctx,
+		cancel:        cancel,
+		cfg:           cfg,
 		currentOffset: offset,
+		pos:           offset,
 		eof:           false,
+		fetchCtx:      fetchCtx,
+		fetchCancel:   fetchCancel,
+		cache:         newBlockCache(cfg.cacheSize),
 		buffer:        []byte{},
 	}
 }
@@ -90,75 +180,98 @@ func (c *ChunkStreamer) Read(p []byte) (int, error) {
 		return 0, fmt.Errorf("cannot read from closed ChunkStreamer")
 	}
 
-	if c.eof && len(c.buffer) == 0 {
-		return 0, io.EOF
-	}
-
 	// If we have data in the buffer, return it
 	if len(c.buffer) > 0 {
 		n := copy(p, c.buffer)
 		c.buffer = c.buffer[n:]
+		c.pos += int64(n)
 		return n, nil
 	}
 
-	// If we've reached the end of the file, return EOF
-	if c.currentOffset >= c.offset+c.size {
-		c.eof = true
+	if c.err != nil {
+		return 0, c.err
+	}
+
+	if c.eof {
 		return 0, io.EOF
 	}
 
-	// Calculate the end of the range for this chunk
-	endOffset := c.currentOffset + c.chunkSize - 1
-	if endOffset >= c.offset+c.size {
-		endOffset = c.offset + c.size - 1
+	if c.cfg.verifyChecksums && !c.verifierReady {
+		verifier, err := c.newChecksumVerifier()
+		if err != nil {
+			c.err = err
+			return 0, err
+		}
+		c.verifier, c.verifierReady = verifier, true
 	}
 
-	// Set up range header
-	rangeHeader := fmt.Sprintf("bytes=%d-%d", c.currentOffset, endOffset)
+	// Top up the read-ahead window; the remaining requests keep running
+	// while the caller consumes this chunk
+	c.schedule()
 
-	// Get this chunk
-	resp, err := c.client.GetObject(c.ctx, &s3.GetObjectInput{
-		Bucket: &c.bucket,
-		Key:    &c.key,
-		Range:  &rangeHeader,
-	})
-	if err != nil {
-		return 0, fmt.Errorf("failed to download chunk (%s): %w", rangeHeader, err)
+	// If nothing is left to request or deliver, we've reached the end of the file
+	if len(c.window) == 0 {
+		c.eof = true
+		return 0, io.EOF
 	}
-	defer resp.Body.Close()
 
-	// Read the chunk into our buffer
-	chunkData, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return 0, fmt.Errorf("failed to read chunk data: %w", err)
+	// Wait for the oldest outstanding chunk so data is delivered in order
+	fetch := c.window[0]
+	select {
+	case <-fetch.done:
+	case <-c.ctx.Done():
+		c.err = c.ctx.Err()
+		return 0, c.err
 	}
+	c.window[0] = nil
+	c.window = c.window[1:]
 
-	// Move to the next chunk for subsequent reads
-	c.currentOffset = endOffset + 1
+	if fetch.err != nil {
+		c.err = fetch.err
+		c.fetchCancel() // Stop any chunks requested after the failed one; Seek starts over
+		return 0, c.err
+	}
+
+	// Verify before handing out the chunk that completes a part or the object
+	if c.verifier != nil {
+		if err := c.verifier.write(fetch.start, fetch.data); err != nil {
+			c.err = err
+			c.fetchCancel()
+			return 0, err
+		}
+	}
 
 	// If we're at the end of the file, mark EOF
-	if c.currentOffset >= c.offset+c.size {
+	if len(c.window) == 0 && c.currentOffset >= c.offset+c.size {
 		c.eof = true
 	}
 
-	// Copy as much as we can into p
-	n := copy(p, chunkData)
-
-	// If we couldn't copy everything, store the rest in our buffer
-	if n < len(chunkData) {
-		c.buffer = chunkData[n:]
-	}
+	// Copy as much as we can into p and keep the rest for subsequent reads
+	n := copy(p, fetch.data)
+	c.buffer = fetch.data[n:]
+	c.pos = fetch.start + int64(n)
 
 	return n, nil
 }
 
+// position returns the object offset of the next byte Read will return.
+func (c *ChunkStreamer) position() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.pos
+}
+
 // Close implements io.Closer to clean up resources.
+// Any in-flight range requests are cancelled and awaited before Close returns.
 // After calling Close, subsequent Read calls will return an error.
 // Example:
 //
 //	streamer := s3streamer.NewChunkStreamer(ctx, client, "my-bucket", "data.json.gz", 0, 1024*1024, 5*1024*1024)
 //	defer streamer.Close()
 func (c *ChunkStreamer) Close() error {
+	// Cancel before taking the lock so a Read blocked on a chunk is released
+	c.cancel()
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -167,6 +280,139 @@ func (c *ChunkStreamer) Close() error {
 	}
 
 	c.closed = true
+	c.wg.Wait()
+	c.window = nil
 	c.buffer = nil // Clear buffer to release memory
+	c.cache.clear()
 	return nil
 }
+
+// schedule starts range requests until the window holds cfg.concurrency chunks
+// or the end of the requested range has been reached.
+func (c *ChunkStreamer) schedule() {
+	end := c.offset + c.size
+	for len(c.window) < c.cfg.concurrency && c.currentOffset < end {
+		// Calculate the end of the range for this chunk
+		endOffset := c.currentOffset + c.chunkSize - 1
+		if endOffset >= end {
+			endOffset = end - 1
+		}
+
+		fetch := &chunkFetch{
+			start: c.currentOffset,
+			end:   endOffset,
+			done:  make(chan struct{}),
+		}
+		c.window = append(c.window, fetch)
+
+		// Move to the next chunk for subsequent requests
+		c.currentOffset = endOffset + 1
+
+		ctx := c.fetchCtx
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			defer close(fetch.done)
+			fetch.data, fetch.err = c.fetchRange(ctx, fetch.start, fetch.end)
+		}()
+	}
+}
+
+// fetchRange downloads the inclusive byte range [start, end] of the object.
+// Failed or truncated attempts are retried according to the retry policy, each
+// retry requesting only the bytes that have not been received yet.
+func (c *ChunkStreamer) fetchRange(ctx context.Context, start, end int64) ([]byte, error) {
+	chunkData := make([]byte, end-start+1)
+	received := 0
+
+	for attempt := 1; ; attempt++ {
+		n, err := c.readRange(ctx, start+int64(received), end, chunkData[received:])
+		received += n
+		if err == nil {
+			return chunkData, nil
+		}
+
+		// A changed object will not change back, so never retry it
+		var changed *ObjectChangedError
+		if errors.As(err, &changed) {
+			return nil, err
+		}
+
+		if attempt >= c.cfg.retry.MaxAttempts || !c.cfg.retry.retryable(err) || ctx.Err() != nil {
+			if attempt > 1 {
+				return nil, fmt.Errorf("%w (gave up after %d attempts)", err, attempt)
+			}
+			return nil, err
+		}
+
+		if sleepErr := sleep(ctx, c.cfg.retry.backoff(attempt)); sleepErr != nil {
+			return nil, err
+		}
+	}
+}
+
+// readRange issues a single ranged GetObject for [start, end] and reads the body into
+// buf, which must be exactly end-start+1 bytes long. It returns the number of bytes
+// received, which may be non-zero even when an error is returned.
+func (c *ChunkStreamer) readRange(ctx context.Context, start, end int64, buf []byte) (int, error) {
+	// Set up range header
+	rangeHeader := fmt.Sprintf("bytes=%d-%d", start, end)
+
+	input := &s3.GetObjectInput{
+		Bucket: &c.bucket,
+		Key:    &c.key,
+		Range:  &rangeHeader,
+	}
+	if c.cfg.etag != "" {
+		input.IfMatch = &c.cfg.etag
+	}
+	if c.cfg.versionID != "" {
+		input.VersionId = &c.cfg.versionID
+	}
+	if c.cfg.verifyChecksums {
+		input.ChecksumMode = types.ChecksumModeEnabled
+	}
+	c.cfg.customerKey.apply(&input.SSECustomerAlgorithm, &input.SSECustomerKey, &input.SSECustomerKeyMD5)
+
+	// Get this chunk
+	resp, err := c.client.GetObject(ctx, input)
+	if err != nil {
+		if c.cfg.etag != "" && isPreconditionFailed(err) {
+			return 0, c.changedError("", "", err)
+		}
+		return 0, fmt.Errorf("failed to download chunk (%s): %w", rangeHeader, err)
+	}
+	defer resp.Body.Close()
+
+	// Guard against clients or proxies that ignore If-Match
+	etag, versionID := aws.ToString(resp.ETag), aws.ToString(resp.VersionId)
+	if (c.cfg.etag != "" && etag != "" && etag != c.cfg.etag) ||
+		(c.cfg.versionID != "" && versionID != "" && versionID != c.cfg.versionID) {
+		return 0, c.changedError(etag, versionID, nil)
+	}
+
+	// Read the chunk into the caller's buffer; a short body is reported as
+	// io.ErrUnexpectedEOF so that the missing tail can be requested again
+	n, err := io.ReadFull(resp.Body, buf)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return n, fmt.Errorf("failed to read chunk data (%s, received %d of %d bytes): %w", rangeHeader, n, len(buf), err)
+	}
+
+	return n, nil
+}
+
+// changedError builds an ObjectChangedError for this streamer's pinned version.
+func (c *ChunkStreamer) changedError(etag, versionID string, err error) error {
+	return &ObjectChangedError{
+		Bucket:            c.bucket,
+		Key:               c.key,
+		ExpectedETag:      c.cfg.etag,
+		ExpectedVersionID: c.cfg.versionID,
+		ActualETag:        etag,
+		ActualVersionID:   versionID,
+		Err:               err,
+	}
+}
@@ -3,10 +3,13 @@ package s3streamer
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 )
@@ -306,6 +309,26 @@ func (m *ErrorMockS3Client) AbortMultipartUpload(ctx context.Context, params *s3
 	return nil, m.err
 }
 
+// PutObject implements the S3Client interface (not used in reader tests)
+func (m *ErrorMockS3Client) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	return nil, m.err
+}
+
+// ListParts implements the S3Client interface (not used in reader tests)
+func (m *ErrorMockS3Client) ListParts(ctx context.Context, params *s3.ListPartsInput, optFns ...func(*s3.Options)) (*s3.ListPartsOutput, error) {
+	return nil, m.err
+}
+
+// GetObjectAttributes implements the S3Client interface (not used in reader tests)
+func (m *ErrorMockS3Client) GetObjectAttributes(ctx context.Context, params *s3.GetObjectAttributesInput, optFns ...func(*s3.Options)) (*s3.GetObjectAttributesOutput, error) {
+	return nil, m.err
+}
+
+// ListObjectsV2 implements the S3Client interface (not used in reader tests)
+func (m *ErrorMockS3Client) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	return nil, m.err
+}
+
 func TestChunkStreamerBufferManagement(t *testing.T) {
 	testData := []byte("Buffer management test data that should be handled correctly.")
 	ctx := context.Background()
@@ -343,3 +366,168 @@ func TestChunkStreamerBufferManagement(t *testing.T) {
 		t.Errorf("Buffer management failed. Expected %q, got %q", string(testData), string(result))
 	}
 }
+
+// blockingMockS3Client serves ranges from MockS3Client after an optional delay and
+// records how many GetObject calls were in flight at the same time.
+type blockingMockS3Client struct {
+	*MockS3Client
+	delay       time.Duration
+	block       bool // Wait for context cancellation instead of responding
+	inFlight    int32
+	maxInFlight int32
+	started     chan struct{}
+}
+
+func (m *blockingMockS3Client) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	current := atomic.AddInt32(&m.inFlight, 1)
+	defer atomic.AddInt32(&m.inFlight, -1)
+	for {
+		peak := atomic.LoadInt32(&m.maxInFlight)
+		if current <= peak || atomic.CompareAndSwapInt32(&m.maxInFlight, peak, current) {
+			break
+		}
+	}
+
+	if m.started != nil {
+		select {
+		case m.started <- struct{}{}:
+		default:
+		}
+	}
+
+	if m.block {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	select {
+	case <-time.After(m.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return m.MockS3Client.GetObject(ctx, params, optFns...)
+}
+
+func TestChunkStreamerReadConcurrency(t *testing.T) {
+	testData := bytes.Repeat([]byte("0123456789"), 100) // 1000 bytes
+	ctx := context.Background()
+	client := NewMockS3Client(testData)
+
+	streamer := NewChunkStreamer(ctx, client, "test-bucket", "test-key", 0, int64(len(testData)), 50, WithReadConcurrency(4))
+	defer streamer.Close()
+
+	// Odd read size to cross chunk boundaries while the window is refilled
+	var result []byte
+	buf := make([]byte, 37)
+	for {
+		n, err := streamer.Read(buf)
+		result = append(result, buf[:n]...)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	if !bytes.Equal(result, testData) {
+		t.Errorf("Data mismatch. Expected %d bytes, got %d bytes", len(testData), len(result))
+	}
+
+	// Every chunk must be requested exactly once
+	if got, want := client.getCallCount, 20; got != want {
+		t.Errorf("GetObject call count = %d, want %d", got, want)
+	}
+}
+
+func TestChunkStreamerReadConcurrencyBounded(t *testing.T) {
+	testData := bytes.Repeat([]byte("x"), 2000)
+	ctx := context.Background()
+	client := &blockingMockS3Client{
+		MockS3Client: NewMockS3Client(testData),
+		delay:        5 * time.Millisecond,
+	}
+
+	streamer := NewChunkStreamer(ctx, client, "test-bucket", "test-key", 0, int64(len(testData)), 100, WithReadConcurrency(3))
+	defer streamer.Close()
+
+	result, err := io.ReadAll(streamer)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !bytes.Equal(result, testData) {
+		t.Fatalf("Data mismatch. Expected %d bytes, got %d bytes", len(testData), len(result))
+	}
+
+	peak := atomic.LoadInt32(&client.maxInFlight)
+	if peak > 3 {
+		t.Errorf("Peak in-flight requests = %d, want <= 3", peak)
+	}
+	if peak < 2 {
+		t.Errorf("Peak in-flight requests = %d, want requests to overlap", peak)
+	}
+}
+
+func TestChunkStreamerCloseCancelsInFlight(t *testing.T) {
+	testData := bytes.Repeat([]byte("x"), 1000)
+	ctx := context.Background()
+	client := &blockingMockS3Client{
+		MockS3Client: NewMockS3Client(testData),
+		block:        true,
+		started:      make(chan struct{}, 1),
+	}
+
+	streamer := NewChunkStreamer(ctx, client, "test-bucket", "test-key", 0, int64(len(testData)), 100, WithReadConcurrency(4))
+
+	readErr := make(chan error, 1)
+	go func() {
+		_, err := streamer.Read(make([]byte, 10))
+		readErr <- err
+	}()
+
+	<-client.started
+	if err := streamer.Close(); err != nil {
+		t.Fatalf("Unexpected error from Close: %v", err)
+	}
+
+	select {
+	case err := <-readErr:
+		if err == nil {
+			t.Error("Expected Read to fail after Close")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Read did not return after Close")
+	}
+
+	if got := atomic.LoadInt32(&client.inFlight); got != 0 {
+		t.Errorf("In-flight requests after Close = %d, want 0", got)
+	}
+}
+
+func TestChunkStreamerContextCancellation(t *testing.T) {
+	testData := bytes.Repeat([]byte("x"), 1000)
+	ctx, cancel := context.WithCancel(context.Background())
+	client := &blockingMockS3Client{
+		MockS3Client: NewMockS3Client(testData),
+		block:        true,
+		started:      make(chan struct{}, 1),
+	}
+
+	streamer := NewChunkStreamer(ctx, client, "test-bucket", "test-key", 0, int64(len(testData)), 100, WithReadConcurrency(2))
+	defer streamer.Close()
+
+	go func() {
+		<-client.started
+		cancel()
+	}()
+
+	_, err := streamer.Read(make([]byte, 10))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+
+	// The error is sticky for subsequent reads
+	if _, err := streamer.Read(make([]byte, 10)); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled on second read, got %v", err)
+	}
+}
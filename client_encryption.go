@@ -0,0 +1,535 @@
+package s3streamer
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Objects written with client-side encryption start with a header followed by the
+// plaintext split into chunks, each sealed with AES-256-GCM:
+//
+//	"S3SE" | version (1) | chunk size (4) | nonce prefix (7) | key length (2) | encrypted data key
+//	chunk 0 | chunk 1 | ... | final chunk
+//
+// Every chunk but the last holds exactly chunk size plaintext bytes plus a 16 byte tag;
+// the last holds fewer, possibly none. The nonce of a chunk is the nonce prefix, the
+// chunk index and a flag marking the last chunk, so chunks cannot be reordered, and
+// truncating the object is detected. The header is authenticated with every chunk.
+const (
+	encryptionMagic       = "S3SE"
+	encryptionVersion     = 1
+	encryptionFixedHeader = 4 + 1 + 4 + 7 + 2
+	encryptionTagSize     = 16
+	encryptionChunkSize   = 64 * 1024
+	maxEncryptionChunk    = 16 * 1024 * 1024
+)
+
+// KeyProvider supplies the data keys for client-side encryption. Every object gets a
+// fresh 256-bit data key; its encrypted form is stored in the object header and
+// handed back to DecryptDataKey when the object is read. Implementations typically
+// call AWS KMS GenerateDataKey and Decrypt, so the data is encrypted with a key S3
+// never sees.
+// Example:
+//
+//	type kmsKeys struct {
+//	    client *kms.Client
+//	    keyID  string
+//	}
+//
+//	func (k kmsKeys) GenerateDataKey(ctx context.Context) ([]byte, []byte, error) {
+//	    out, err := k.client.GenerateDataKey(ctx, &kms.GenerateDataKeyInput{KeyId: &k.keyID, KeySpec: kmstypes.DataKeySpecAes256})
+//	    if err != nil {
+//	        return nil, nil, err
+//	    }
+//	    return out.Plaintext, out.CiphertextBlob, nil
+//	}
+//
+//	func (k kmsKeys) DecryptDataKey(ctx context.Context, encrypted []byte) ([]byte, error) {
+//	    out, err := k.client.Decrypt(ctx, &kms.DecryptInput{CiphertextBlob: encrypted})
+//	    if err != nil {
+//	        return nil, err
+//	    }
+//	    return out.Plaintext, nil
+//	}
+type KeyProvider interface {
+	// GenerateDataKey returns a new 32 byte data key and its encrypted form, which
+	// must be at most 65535 bytes.
+	GenerateDataKey(ctx context.Context) (plaintext, encrypted []byte, err error)
+	// DecryptDataKey returns the data key for an encrypted form returned by
+	// GenerateDataKey.
+	DecryptDataKey(ctx context.Context, encrypted []byte) ([]byte, error)
+}
+
+// NewStaticKeyProvider returns a KeyProvider that encrypts data keys with a 32 byte
+// master key using AES-256-GCM. Keep the master key outside S3; anyone holding it
+// can read every object encrypted with it.
+// Example:
+//
+//	keys, err := s3streamer.NewStaticKeyProvider(masterKey)
+//	if err != nil {
+//	    return err
+//	}
+//	writer, err := s3streamer.NewEncryptedS3Writer(ctx, client, "my-bucket", "secret.json", 8*1024*1024, keys)
+func NewStaticKeyProvider(masterKey []byte) (KeyProvider, error) {
+	if len(masterKey) != 32 {
+		return nil, fmt.Errorf("master key must be 32 bytes, got %d", len(masterKey))
+	}
+	aead, err := newGCM(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	return staticKeyProvider{aead: aead}, nil
+}
+
+// staticKeyProvider wraps data keys with a master key.
+type staticKeyProvider struct {
+	aead cipher.AEAD
+}
+
+// GenerateDataKey implements KeyProvider.
+func (p staticKeyProvider) GenerateDataKey(ctx context.Context) ([]byte, []byte, error) {
+	key := make([]byte, 32)
+	nonce := make([]byte, p.aead.NonceSize())
+	if _, err := rand.Read(key); err != nil {
+		return nil, nil, err
+	}
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	return key, p.aead.Seal(nonce, nonce, key, nil), nil
+}
+
+// DecryptDataKey implements KeyProvider.
+func (p staticKeyProvider) DecryptDataKey(ctx context.Context, encrypted []byte) ([]byte, error) {
+	if len(encrypted) < p.aead.NonceSize() {
+		return nil, fmt.Errorf("encrypted data key is too short")
+	}
+	nonce, sealed := encrypted[:p.aead.NonceSize()], encrypted[p.aead.NonceSize():]
+	key, err := p.aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt data key: %w", err)
+	}
+	return key, nil
+}
+
+// newGCM returns AES-GCM for a 32 byte key.
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptionHeader is the header of an object written with client-side encryption.
+// Read it with ReadEncryptionHeader to resume decryption in the middle of an object.
+type EncryptionHeader struct {
+	// ChunkSize is the number of plaintext bytes in every chunk but the last
+	ChunkSize int64
+	// EncryptedKey is the data key in the form returned by KeyProvider.GenerateDataKey
+	EncryptedKey []byte
+
+	noncePrefix [7]byte
+	raw         []byte // Encoded header, authenticated with every chunk
+}
+
+// newEncryptionHeader returns a header with a random nonce prefix.
+func newEncryptionHeader(chunkSize int64, encryptedKey []byte) (*EncryptionHeader, error) {
+	if len(encryptedKey) == 0 || len(encryptedKey) > 0xFFFF {
+		return nil, fmt.Errorf("encrypted data key must be 1 to 65535 bytes, got %d", len(encryptedKey))
+	}
+	h := &EncryptionHeader{ChunkSize: chunkSize, EncryptedKey: encryptedKey}
+	if _, err := rand.Read(h.noncePrefix[:]); err != nil {
+		return nil, err
+	}
+
+	h.raw = make([]byte, 0, encryptionFixedHeader+len(encryptedKey))
+	h.raw = append(h.raw, encryptionMagic...)
+	h.raw = append(h.raw, encryptionVersion)
+	h.raw = binary.BigEndian.AppendUint32(h.raw, uint32(chunkSize))
+	h.raw = append(h.raw, h.noncePrefix[:]...)
+	h.raw = binary.BigEndian.AppendUint16(h.raw, uint16(len(encryptedKey)))
+	h.raw = append(h.raw, encryptedKey...)
+	return h, nil
+}
+
+// ReadEncryptionHeader reads the header at the start of a client-side encrypted object.
+// Example:
+//
+//	head := s3streamer.NewChunkStreamer(ctx, client, "my-bucket", "secret.json", 0, size, 64*1024)
+//	header, err := s3streamer.ReadEncryptionHeader(head)
+//	head.Close()
+func ReadEncryptionHeader(r io.Reader) (*EncryptionHeader, error) {
+	fixed := make([]byte, encryptionFixedHeader)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return nil, fmt.Errorf("failed to read encryption header: %w", err)
+	}
+	if string(fixed[:4]) != encryptionMagic {
+		return nil, fmt.Errorf("object is not client-side encrypted")
+	}
+	if fixed[4] != encryptionVersion {
+		return nil, fmt.Errorf("unsupported encryption format version %d", fixed[4])
+	}
+
+	h := &EncryptionHeader{ChunkSize: int64(binary.BigEndian.Uint32(fixed[5:9]))}
+	if h.ChunkSize < 1 || h.ChunkSize > maxEncryptionChunk {
+		return nil, fmt.Errorf("invalid encryption chunk size %d", h.ChunkSize)
+	}
+	copy(h.noncePrefix[:], fixed[9:16])
+
+	h.EncryptedKey = make([]byte, binary.BigEndian.Uint16(fixed[16:18]))
+	if _, err := io.ReadFull(r, h.EncryptedKey); err != nil {
+		return nil, fmt.Errorf("failed to read encrypted data key: %w", err)
+	}
+	h.raw = append(fixed, h.EncryptedKey...)
+	return h, nil
+}
+
+// Size returns the length of the encoded header, which is where chunk 0 starts.
+func (h *EncryptionHeader) Size() int64 {
+	return int64(len(h.raw))
+}
+
+// ChunkStart returns the plaintext offset of the chunk that holds plaintextOffset and
+// the object offset where that chunk is stored. Decryption can only start there.
+// Example:
+//
+//	start, objectOffset := header.ChunkStart(resumeAt)
+//	streamer := s3streamer.NewChunkStreamer(ctx, client, bucket, key, objectOffset, size-objectOffset, 5*1024*1024)
+//	plaintext, err := header.NewReader(ctx, streamer, keys, start)
+//	io.CopyN(io.Discard, plaintext, resumeAt-start)
+func (h *EncryptionHeader) ChunkStart(plaintextOffset int64) (start, objectOffset int64) {
+	index := plaintextOffset / h.ChunkSize
+	return index * h.ChunkSize, h.Size() + index*(h.ChunkSize+encryptionTagSize)
+}
+
+// nonce returns the nonce of chunk index.
+func (h *EncryptionHeader) nonce(index uint32, last bool) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, h.noncePrefix[:])
+	binary.BigEndian.PutUint32(nonce[7:], index)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// NewDecryptingReader reads the encryption header from the start of r and returns the
+// decrypted data that follows it. Wrap a ChunkStreamer to read a client-side encrypted
+// object, and Decompress the result if it was compressed before encryption. Read
+// fails if any chunk was modified, reordered or removed.
+// Example:
+//
+//	streamer := s3streamer.NewChunkStreamer(ctx, client, "my-bucket", "secret.json.gz", 0, size, 5*1024*1024)
+//	defer streamer.Close()
+//	plaintext, err := s3streamer.NewDecryptingReader(ctx, streamer, keys)
+//	if err != nil {
+//	    return err
+//	}
+//	reader, err := s3streamer.Decompress(plaintext)
+func NewDecryptingReader(ctx context.Context, r io.Reader, provider KeyProvider) (*DecryptingReader, error) {
+	header, err := ReadEncryptionHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	return header.NewReader(ctx, r, provider, 0)
+}
+
+// NewReader returns the decrypted data of the object described by the header, starting
+// at plaintext offset start, which must be a chunk boundary returned by ChunkStart. r
+// must be positioned at the matching object offset.
+func (h *EncryptionHeader) NewReader(ctx context.Context, r io.Reader, provider KeyProvider, start int64) (*DecryptingReader, error) {
+	if start < 0 || start%h.ChunkSize != 0 {
+		return nil, fmt.Errorf("decryption must start at a chunk boundary, got offset %d", start)
+	}
+	if provider == nil {
+		return nil, fmt.Errorf("key provider cannot be nil")
+	}
+	key, err := provider.DecryptDataKey(ctx, h.EncryptedKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt data key: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("data key must be 32 bytes, got %d", len(key))
+	}
+	aead, err := newGCM(key)
+	clear(key)
+	if err != nil {
+		return nil, err
+	}
+	return &DecryptingReader{
+		r:      r,
+		header: h,
+		aead:   aead,
+		index:  uint32(start / h.ChunkSize),
+		sealed: make([]byte, h.ChunkSize+encryptionTagSize),
+	}, nil
+}
+
+// DecryptingReader is an io.Reader over the decrypted data of a client-side encrypted
+// object. Create one with NewDecryptingReader or EncryptionHeader.NewReader.
+type DecryptingReader struct {
+	r      io.Reader
+	header *EncryptionHeader
+	aead   cipher.AEAD
+	index  uint32 // Index of the next chunk to read
+	sealed []byte // Buffer for one sealed chunk, decrypted in place
+	plain  []byte // Decrypted bytes not yet returned
+	last   bool   // The final chunk has been read
+	err    error
+}
+
+// Read implements io.Reader. It returns io.EOF only after the final chunk has been
+// authenticated, so a truncated object fails instead of ending early.
+func (d *DecryptingReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		if d.last {
+			d.err = d.checkTrailer()
+			continue
+		}
+		d.err = d.readChunk()
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+// readChunk reads and decrypts the next chunk. Only the final chunk is shorter than a
+// full sealed chunk.
+func (d *DecryptingReader) readChunk() error {
+	n, err := io.ReadFull(d.r, d.sealed)
+	switch err {
+	case nil:
+	case io.ErrUnexpectedEOF:
+		d.last = true
+	case io.EOF:
+		return fmt.Errorf("encrypted object is truncated before chunk %d", d.index)
+	default:
+		return err
+	}
+
+	plain, err := d.aead.Open(d.sealed[:0], d.header.nonce(d.index, d.last), d.sealed[:n], d.header.raw)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt chunk %d: %w", d.index, err)
+	}
+	d.plain = plain
+	d.index++
+	return nil
+}
+
+// checkTrailer returns io.EOF if nothing follows the final chunk.
+func (d *DecryptingReader) checkTrailer() error {
+	var b [1]byte
+	n, err := io.ReadFull(d.r, b[:])
+	if n > 0 {
+		return fmt.Errorf("unexpected data after the final encrypted chunk")
+	}
+	if err != io.EOF {
+		return err
+	}
+	return io.EOF
+}
+
+// WithClientSideEncryption makes CompressedS3Writer encrypt the compressed output with
+// a data key from provider, as NewEncryptedS3Writer does for uncompressed data. Read
+// such objects with WithClientSideDecryption or NewDecryptingReader. NewS3Writer
+// rejects this option, as it cannot encrypt.
+// Example:
+//
+//	writer, err := s3streamer.NewCompressedS3Writer(ctx, client, "my-bucket", "secret.json.gz", 8*1024*1024,
+//	    s3streamer.Gzip, s3streamer.WithClientSideEncryption(keys))
+func WithClientSideEncryption(provider KeyProvider) WriterOption {
+	return func(cfg *writerConfig) {
+		cfg.encryption = provider
+	}
+}
+
+// WithClientSideDecryption makes S3Streamer decrypt objects written with client-side
+// encryption before decompressing them. Stream offsets refer to the decrypted data;
+// decryption starts at the chunk holding the offset. Checkpoints are not supported.
+// ChunkStreamer ignores this option; wrap it with NewDecryptingReader instead.
+// Example:
+//
+//	streamer := s3streamer.NewS3Streamer(client, s3streamer.WithClientSideDecryption(keys))
+//	err := streamer.Stream(ctx, "my-bucket", "secret.json.gz", 0, processLine)
+func WithClientSideDecryption(provider KeyProvider) ReaderOption {
+	return func(cfg *readerConfig) {
+		cfg.decryption = provider
+	}
+}
+
+// EncryptedS3Writer wraps an S3Writer with client-side encryption. Data is sealed in
+// chunks with AES-256-GCM under a fresh data key from a KeyProvider, so S3 only ever
+// stores ciphertext. To compress before encrypting, use NewCompressedS3Writer with
+// WithClientSideEncryption.
+//
+// Thread Safety: EncryptedS3Writer is safe for concurrent use by multiple goroutines.
+//
+// Example:
+//
+//	writer, err := s3streamer.NewEncryptedS3Writer(ctx, client, "my-bucket", "secret.json", 8*1024*1024, keys)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	defer writer.Close()
+//	n, err := writer.Write(data)
+type EncryptedS3Writer struct {
+	s3Writer *S3Writer
+	aead     cipher.AEAD
+	header   *EncryptionHeader
+	mu       sync.Mutex
+	buf      []byte // Plaintext of the current chunk
+	sealed   []byte // Reused output buffer
+	index    uint32
+	closed   bool
+	err      error
+}
+
+// NewEncryptedS3Writer creates an EncryptedS3Writer. A data key is requested from
+// provider immediately. Options are passed on to the underlying S3Writer.
+// Example:
+//
+//	keys, _ := s3streamer.NewStaticKeyProvider(masterKey)
+//	writer, err := s3streamer.NewEncryptedS3Writer(ctx, client, "my-bucket", "secret.json", 8*1024*1024, keys,
+//	    s3streamer.WithUploadConcurrency(4))
+func NewEncryptedS3Writer(ctx context.Context, client S3Client, bucket, key string, partSize int64, provider KeyProvider, opts ...WriterOption) (*EncryptedS3Writer, error) {
+	if provider == nil {
+		return nil, fmt.Errorf("key provider cannot be nil")
+	}
+	s3Writer, err := NewS3Writer(ctx, client, bucket, key, partSize, withoutClientSideEncryption(opts)...)
+	if err != nil {
+		return nil, err
+	}
+	writer, err := newEncryptedS3Writer(ctx, s3Writer, provider)
+	if err != nil {
+		s3Writer.Abort()
+		return nil, err
+	}
+	return writer, nil
+}
+
+// withoutClientSideEncryption returns opts with client-side encryption turned off, for
+// the S3Writer underneath an encrypting writer.
+func withoutClientSideEncryption(opts []WriterOption) []WriterOption {
+	return append(opts[:len(opts):len(opts)], WithClientSideEncryption(nil))
+}
+
+// withoutObjectEncryption returns opts without the SSE-C key and client-side
+// decryption, for reading objects that S3 writes itself, such as inventory reports.
+func withoutObjectEncryption(opts []ReaderOption) []ReaderOption {
+	return append(opts[:len(opts):len(opts)], func(cfg *readerConfig) {
+		cfg.customerKey, cfg.decryption = nil, nil
+	})
+}
+
+// newEncryptedS3Writer starts an encrypted object on s3Writer.
+func newEncryptedS3Writer(ctx context.Context, s3Writer *S3Writer, provider KeyProvider) (*EncryptedS3Writer, error) {
+	key, encryptedKey, err := provider.GenerateDataKey(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("data key must be 32 bytes, got %d", len(key))
+	}
+	aead, err := newGCM(key)
+	clear(key)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := newEncryptionHeader(encryptionChunkSize, encryptedKey)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s3Writer.Write(header.raw); err != nil {
+		return nil, err
+	}
+	return &EncryptedS3Writer{
+		s3Writer: s3Writer,
+		aead:     aead,
+		header:   header,
+		buf:      make([]byte, 0, encryptionChunkSize),
+	}, nil
+}
+
+// Write implements io.Writer. Plaintext is buffered until a chunk is full, then sealed
+// and written to the underlying S3Writer.
+func (ew *EncryptedS3Writer) Write(p []byte) (int, error) {
+	ew.mu.Lock()
+	defer ew.mu.Unlock()
+
+	if ew.closed {
+		return 0, fmt.Errorf("cannot write to closed EncryptedS3Writer")
+	}
+	if ew.err != nil {
+		return 0, ew.err
+	}
+
+	written := 0
+	for len(p) > 0 {
+		n := copy(ew.buf[len(ew.buf):cap(ew.buf)], p)
+		ew.buf = ew.buf[:len(ew.buf)+n]
+		p = p[n:]
+		written += n
+		if len(ew.buf) == cap(ew.buf) {
+			if ew.err = ew.seal(false); ew.err != nil {
+				return written, ew.err
+			}
+		}
+	}
+	return written, nil
+}
+
+// seal encrypts the buffered chunk and writes it to S3Writer.
+func (ew *EncryptedS3Writer) seal(last bool) error {
+	ew.sealed = ew.aead.Seal(ew.sealed[:0], ew.header.nonce(ew.index, last), ew.buf, ew.header.raw)
+	ew.buf = ew.buf[:0]
+	ew.index++
+	_, err := ew.s3Writer.Write(ew.sealed)
+	return err
+}
+
+// Close seals the final chunk and completes the upload.
+func (ew *EncryptedS3Writer) Close() error {
+	ew.mu.Lock()
+	defer ew.mu.Unlock()
+
+	if ew.closed {
+		return nil
+	}
+	ew.closed = true
+	if ew.err != nil {
+		ew.s3Writer.Abort()
+		return ew.err
+	}
+	if err := ew.seal(true); err != nil {
+		ew.s3Writer.Abort()
+		return fmt.Errorf("failed to write final encrypted chunk: %w", err)
+	}
+	return ew.s3Writer.Close()
+}
+
+// Abort cancels the upload. Nothing readable is left in S3.
+func (ew *EncryptedS3Writer) Abort() error {
+	ew.mu.Lock()
+	defer ew.mu.Unlock()
+
+	ew.closed = true
+	ew.buf = ew.buf[:0]
+	return ew.s3Writer.Abort()
+}
+
+// Checksum returns the checksum of the encrypted object after a successful Close, when
+// the writer was created with WithChecksum. See S3Writer.Checksum.
+func (ew *EncryptedS3Writer) Checksum() (ObjectChecksum, bool) {
+	return ew.s3Writer.Checksum()
+}
@@ -0,0 +1,249 @@
+package s3streamer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// testKeyProvider returns a static key provider with a fixed master key.
+func testKeyProvider(t *testing.T) KeyProvider {
+	t.Helper()
+	keys, err := NewStaticKeyProvider(bytes.Repeat([]byte{0x17}, 32))
+	if err != nil {
+		t.Fatalf("Failed to create key provider: %v", err)
+	}
+	return keys
+}
+
+// encryptTestData encrypts data with an EncryptedS3Writer and returns the stored object.
+func encryptTestData(t *testing.T, keys KeyProvider, data []byte) []byte {
+	t.Helper()
+	client := &mockS3ClientWriter{}
+	writer, err := NewEncryptedS3Writer(context.Background(), client, "test-bucket", "test-key", 5*1024*1024, keys)
+	if err != nil {
+		t.Fatalf("Failed to create EncryptedS3Writer: %v", err)
+	}
+	if _, err := writer.Write(data); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	return client.GetUploadedData()
+}
+
+func TestEncryptedS3Writer_RoundTrip(t *testing.T) {
+	ctx := context.Background()
+	keys := testKeyProvider(t)
+
+	for _, size := range []int64{0, 1, encryptionChunkSize - 1, encryptionChunkSize, 3*encryptionChunkSize + 5, 5*1024*1024 + 100} {
+		t.Run(fmt.Sprint(size), func(t *testing.T) {
+			data := sizedTestData(size)
+			stored := encryptTestData(t, keys, data)
+
+			chunks := (size / encryptionChunkSize) + 1
+			header := int64(encryptionFixedHeader + 60) // Static provider: 12 byte nonce, 32 byte key, 16 byte tag
+			if want := header + size + chunks*encryptionTagSize; int64(len(stored)) != want {
+				t.Errorf("Stored %d bytes, want %d", len(stored), want)
+			}
+			if size > 16 && bytes.Contains(stored, data[:16]) {
+				t.Error("Stored object contains plaintext")
+			}
+
+			reader, err := NewDecryptingReader(ctx, bytes.NewReader(stored), keys)
+			if err != nil {
+				t.Fatalf("NewDecryptingReader failed: %v", err)
+			}
+			got, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("Decryption failed: %v", err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("Decrypted %d bytes, want %d", len(got), len(data))
+			}
+		})
+	}
+}
+
+func TestDecryptingReader_Tampering(t *testing.T) {
+	ctx := context.Background()
+	keys := testKeyProvider(t)
+	stored := encryptTestData(t, keys, sizedTestData(2*encryptionChunkSize+10))
+	header, err := ReadEncryptionHeader(bytes.NewReader(stored))
+	if err != nil {
+		t.Fatalf("ReadEncryptionHeader failed: %v", err)
+	}
+	sealedChunk := int(encryptionChunkSize + encryptionTagSize)
+	body := stored[header.Size():]
+
+	flipped := bytes.Clone(stored)
+	flipped[len(flipped)-1] ^= 1
+
+	swapped := bytes.Clone(stored[:header.Size()])
+	swapped = append(swapped, body[sealedChunk:2*sealedChunk]...)
+	swapped = append(swapped, body[:sealedChunk]...)
+	swapped = append(swapped, body[2*sealedChunk:]...)
+
+	tests := []struct {
+		name   string
+		object []byte
+	}{
+		{"modified byte", flipped},
+		{"reordered chunks", swapped},
+		{"final chunk removed", stored[:int(header.Size())+2*sealedChunk]},
+		{"truncated chunk", stored[:len(stored)-5]},
+		{"trailing data", append(bytes.Clone(stored), 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, err := NewDecryptingReader(ctx, bytes.NewReader(tt.object), keys)
+			if err != nil {
+				t.Fatalf("NewDecryptingReader failed: %v", err)
+			}
+			if _, err := io.ReadAll(reader); err == nil {
+				t.Error("Expected decryption to fail")
+			}
+		})
+	}
+
+	other, _ := NewStaticKeyProvider(bytes.Repeat([]byte{0x18}, 32))
+	if _, err := NewDecryptingReader(ctx, bytes.NewReader(stored), other); err == nil {
+		t.Error("Expected error with the wrong master key")
+	}
+	if _, err := NewDecryptingReader(ctx, strings.NewReader("plain text\n"), keys); err == nil {
+		t.Error("Expected error for an unencrypted object")
+	}
+}
+
+func TestEncryptionHeader_ResumeAtChunk(t *testing.T) {
+	ctx := context.Background()
+	keys := testKeyProvider(t)
+	data := sizedTestData(4*encryptionChunkSize + 123)
+	stored := encryptTestData(t, keys, data)
+
+	header, err := ReadEncryptionHeader(bytes.NewReader(stored))
+	if err != nil {
+		t.Fatalf("ReadEncryptionHeader failed: %v", err)
+	}
+	if header.ChunkSize != encryptionChunkSize {
+		t.Errorf("ChunkSize = %d", header.ChunkSize)
+	}
+
+	resumeAt := int64(2*encryptionChunkSize + 1000)
+	start, objectOffset := header.ChunkStart(resumeAt)
+	if start != 2*encryptionChunkSize {
+		t.Errorf("Chunk start = %d", start)
+	}
+	reader, err := header.NewReader(ctx, bytes.NewReader(stored[objectOffset:]), keys, start)
+	if err != nil {
+		t.Fatalf("NewReader failed: %v", err)
+	}
+	got, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("Decryption failed: %v", err)
+	}
+	if !bytes.Equal(got, data[start:]) {
+		t.Errorf("Resumed decryption returned %d bytes, want %d", len(got), len(data)-int(start))
+	}
+
+	if _, err := header.NewReader(ctx, bytes.NewReader(stored[objectOffset:]), keys, start+1); err == nil {
+		t.Error("Expected error when starting between chunk boundaries")
+	}
+}
+
+func TestCompressedS3Writer_ClientSideEncryption(t *testing.T) {
+	ctx := context.Background()
+	keys := testKeyProvider(t)
+	data := sizedTestData(200 * 1024)
+
+	client := newChecksumRecordingClient()
+	writer, err := NewCompressedS3Writer(ctx, client, "test-bucket", "test-key", 5*1024*1024, Gzip, WithClientSideEncryption(keys))
+	if err != nil {
+		t.Fatalf("Failed to create CompressedS3Writer: %v", err)
+	}
+	if _, err := writer.Write(data); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if enc := aws.ToString(client.putInput.ContentEncoding); enc != "" {
+		t.Errorf("Encrypted object labelled with Content-Encoding %q", enc)
+	}
+
+	// Compressed before encryption: the plaintext is gzip
+	stored := client.GetUploadedData()
+	plaintext, err := NewDecryptingReader(ctx, bytes.NewReader(stored), keys)
+	if err != nil {
+		t.Fatalf("NewDecryptingReader failed: %v", err)
+	}
+	compressed, err := io.ReadAll(plaintext)
+	if err != nil {
+		t.Fatalf("Decryption failed: %v", err)
+	}
+	if DetectCompression(compressed) != Gzip {
+		t.Fatal("Decrypted data is not gzip")
+	}
+
+	// Stream decrypts and decompresses
+	streamer := NewS3Streamer(NewMockS3Client(stored), WithClientSideDecryption(keys))
+	streamer.chunkSize = 4096
+	var got bytes.Buffer
+	err = streamer.Stream(ctx, "test-bucket", "test-key", 0, func(line []byte, offset int64) error {
+		got.Write(line)
+		got.WriteByte('\n')
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if !bytes.Equal(bytes.TrimSuffix(got.Bytes(), []byte("\n")), bytes.TrimSuffix(data, []byte("\n"))) {
+		t.Error("Streamed data does not match")
+	}
+
+	// Encryption needs a writer that can encrypt
+	if _, err := NewS3Writer(ctx, &mockS3ClientWriter{}, "test-bucket", "test-key", 5*1024*1024, WithClientSideEncryption(keys)); err == nil {
+		t.Error("Expected NewS3Writer to reject client-side encryption")
+	}
+}
+
+func TestS3Streamer_ClientSideDecryptionOffset(t *testing.T) {
+	ctx := context.Background()
+	keys := testKeyProvider(t)
+	data := sizedTestData(3*encryptionChunkSize + 500)
+	client := newAttributesClient(encryptTestData(t, keys, data), types.ChecksumAlgorithmCrc32c, types.ChecksumTypeComposite, 100000)
+
+	// Start at a line in the third chunk
+	offset := int64(bytes.IndexByte(data[2*encryptionChunkSize+100:], '\n')) + 2*encryptionChunkSize + 101
+	streamer := NewS3Streamer(client, WithClientSideDecryption(keys), WithChecksumVerification())
+	streamer.chunkSize = 10000
+	var got bytes.Buffer
+	err := streamer.Stream(ctx, "test-bucket", "test-key", offset, func(line []byte, lineOffset int64) error {
+		if got.Len() == 0 && lineOffset != 0 {
+			t.Errorf("First line offset = %d", lineOffset)
+		}
+		got.Write(line)
+		got.WriteByte('\n')
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if !bytes.Equal(bytes.TrimSuffix(got.Bytes(), []byte("\n")), bytes.TrimSuffix(data[offset:], []byte("\n"))) {
+		t.Error("Streamed data does not match")
+	}
+
+	err = streamer.StreamWithOptions(ctx, "test-bucket", "test-key", StreamOptions{
+		OnCheckpoint: func(Checkpoint) error { return nil },
+	}, func([]byte, int64) error { return nil })
+	if err == nil {
+		t.Error("Expected checkpoints to be rejected for encrypted objects")
+	}
+}
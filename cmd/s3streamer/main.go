@@ -7,7 +7,6 @@ import (
 	"io"
 	"log"
 	"os"
-	"path/filepath"
 	"strings"
 	"time"
 
@@ -45,9 +44,12 @@ func main() {
 	bucket := flagSet.String("bucket", "", "S3 bucket name (required)")
 	key := flagSet.String("key", "", "S3 object key (required)")
 	filePath := flagSet.String("file", "", "Local file path (required)")
-	compression := flagSet.String("compress", "", "Compression type for upload: 'gzip', 'bzip2', or 'none' (auto-detect from extension if not specified)")
+	compression := flagSet.String("compress", "", "Compression type for upload: 'gzip', 'bzip2', 'zstd', or 'none' (auto-detect from extension if not specified)")
 	partSize := flagSet.Int64("part-size", defaultPartSize, "Part size for multipart uploads (minimum 5MiB)")
 	chunkSize := flagSet.Int64("chunk-size", defaultChunkSize, "Chunk size for downloads")
+	concurrency := flagSet.Int("concurrency", 1, "Number of concurrent range requests for downloads or part uploads for uploads")
+	kmsKeyID := flagSet.String("kms-key-id", "", "KMS key ID, ARN or alias to encrypt uploads with (SSE-KMS)")
+	verify := flagSet.Bool("verify", false, "Verify downloads against the object's stored checksums")
 	region := flagSet.String("region", "", "AWS region (optional, uses default from config/environment)")
 	profile := flagSet.String("profile", "", "AWS profile to use (optional, uses default profile if not specified)")
 
@@ -90,11 +92,11 @@ func main() {
 
 	switch strings.ToLower(command) {
 	case "upload", "up":
-		if err := uploadFile(ctx, client, *bucket, *key, *filePath, *compression, *partSize); err != nil {
+		if err := uploadFile(ctx, client, *bucket, *key, *filePath, *compression, *partSize, *concurrency, *kmsKeyID); err != nil {
 			log.Fatalf("Upload failed: %v", err)
 		}
 	case "download", "down":
-		if err := downloadFile(ctx, client, *bucket, *key, *filePath, *chunkSize); err != nil {
+		if err := downloadFile(ctx, client, *bucket, *key, *filePath, *chunkSize, *concurrency, *verify); err != nil {
 			log.Fatalf("Download failed: %v", err)
 		}
 	default:
@@ -120,10 +122,14 @@ REQUIRED FLAGS:
     -file <path>    Local file path
 
 OPTIONAL FLAGS:
-    -compress <type>    Compression for upload: 'gzip', 'bzip2', 'none'
+    -compress <type>    Compression for upload: 'gzip', 'bzip2', 'zstd', 'none'
                        (auto-detects from file extension if not specified)
     -part-size <bytes>  Part size for uploads (default: 5MiB, minimum: 5MiB)
     -chunk-size <bytes> Chunk size for downloads (default: 5MiB)
+    -concurrency <n>    Concurrent range requests for downloads or part uploads
+                       for uploads (default: 1)
+    -kms-key-id <id>    Encrypt uploads with this KMS key (SSE-KMS)
+    -verify             Verify downloads against the object's stored checksums
     -region <region>    AWS region (uses default from config if not specified)
     -profile <name>     AWS profile to use (uses default profile if not specified)
     -help              Show this help message
@@ -144,6 +150,9 @@ EXAMPLES:
     # Download with custom chunk size
     s3streamer down -bucket my-bucket -key data/file.txt -file local.txt -chunk-size 1048576
 
+    # Download with 8 chunks fetched in parallel
+    s3streamer down -bucket my-bucket -key data/file.json.gz -file local.json -concurrency 8
+
     # Use a specific AWS profile
     s3streamer upload -bucket my-bucket -key data/file.json.gz -file local.json -profile production
 
@@ -153,19 +162,20 @@ EXAMPLES:
 COMPRESSION TYPES:
     gzip    - Fast compression, good balance of speed and size
     bzip2   - Slower compression, better compression ratio
+    zstd    - Fast compression with a better ratio than gzip
     none    - No compression (raw upload)
-    auto    - Auto-detect from file extension (.gz, .bz2)
+    auto    - Auto-detect from file extension (.gz, .bz2, .zst)
 
 NOTES:
     - Upload uses S3 multipart uploads for efficient streaming
-    - Download automatically detects and decompresses gzip/bzip2 files
+    - Download automatically detects and decompresses gzip/bzip2/zstd files
     - Part size must be at least 5MiB (AWS requirement)
     - Large files are processed with constant memory usage
     - Supports resumable operations on network interruptions
 `)
 }
 
-func uploadFile(ctx context.Context, client *s3.Client, bucket, key, filePath, compressionType string, partSize int64) error {
+func uploadFile(ctx context.Context, client *s3.Client, bucket, key, filePath, compressionType string, partSize int64, concurrency int, kmsKeyID string) error {
 	// Validate part size
 	if partSize < 5*1024*1024 {
 		return fmt.Errorf("part size must be at least 5MiB (5242880 bytes), got %d", partSize)
@@ -191,15 +201,19 @@ func uploadFile(ctx context.Context, client *s3.Client, bucket, key, filePath, c
 	}
 
 	// Create appropriate writer
+	opts := []s3streamer.WriterOption{s3streamer.WithUploadConcurrency(concurrency)}
+	if kmsKeyID != "" {
+		opts = append(opts, s3streamer.WithKMSEncryption(s3streamer.KMSEncryption{KeyID: kmsKeyID}))
+	}
 	var writer io.WriteCloser
 	if compression == s3streamer.Uncompressed {
-		w, err := s3streamer.NewS3Writer(ctx, client, bucket, key, partSize)
+		w, err := s3streamer.NewS3Writer(ctx, client, bucket, key, partSize, opts...)
 		if err != nil {
 			return fmt.Errorf("failed to create S3 writer: %w", err)
 		}
 		writer = w
 	} else {
-		w, err := s3streamer.NewCompressedS3Writer(ctx, client, bucket, key, partSize, compression)
+		w, err := s3streamer.NewCompressedS3Writer(ctx, client, bucket, key, partSize, compression, opts...)
 		if err != nil {
 			return fmt.Errorf("failed to create compressed S3 writer: %w", err)
 		}
@@ -240,7 +254,7 @@ func uploadFile(ctx context.Context, client *s3.Client, bucket, key, filePath, c
 	return nil
 }
 
-func downloadFile(ctx context.Context, client *s3.Client, bucket, key, filePath string, chunkSize int64) error {
+func downloadFile(ctx context.Context, client *s3.Client, bucket, key, filePath string, chunkSize int64, concurrency int, verify bool) error {
 	// Get object metadata
 	resp, err := client.HeadObject(ctx, &s3.HeadObjectInput{
 		Bucket: &bucket,
@@ -263,8 +277,19 @@ func downloadFile(ctx context.Context, client *s3.Client, bucket, key, filePath
 	}
 	defer file.Close()
 
-	// Create chunk streamer
-	streamer := s3streamer.NewChunkStreamer(ctx, client, bucket, key, 0, objectSize, chunkSize)
+	// Create chunk streamer pinned to the version we just inspected
+	opts := []s3streamer.ReaderOption{
+		s3streamer.WithReadConcurrency(concurrency),
+		s3streamer.WithObjectVersion(aws.ToString(resp.ETag), aws.ToString(resp.VersionId)),
+	}
+	if verify {
+		opts = append(opts, s3streamer.WithChecksumVerification())
+	}
+	streamer := s3streamer.NewChunkStreamer(ctx, client, bucket, key, 0, objectSize, chunkSize, opts...)
+	if streamer == nil {
+		return fmt.Errorf("failed to create chunk streamer: invalid parameters")
+	}
+	defer streamer.Close()
 
 	// Decompress if needed
 	reader, err := s3streamer.Decompress(streamer)
@@ -276,6 +301,7 @@ func downloadFile(ctx context.Context, client *s3.Client, bucket, key, filePath
 	fmt.Printf("Downloading s3://%s/%s to %s\n", bucket, key, filePath)
 	fmt.Printf("Object size: %d bytes (%.2f MB)\n", objectSize, float64(objectSize)/(1024*1024))
 	fmt.Printf("Chunk size: %d bytes (%.2f MB)\n", chunkSize, float64(chunkSize)/(1024*1024))
+	fmt.Printf("Concurrency: %d\n", concurrency)
 
 	start := time.Now()
 
@@ -284,6 +310,12 @@ func downloadFile(ctx context.Context, client *s3.Client, bucket, key, filePath
 	if err != nil {
 		return fmt.Errorf("failed to download file: %w", err)
 	}
+	if verify {
+		// The decompressor may stop short of the end of the object
+		if _, err := io.Copy(io.Discard, streamer); err != nil {
+			return fmt.Errorf("failed to verify object checksum: %w", err)
+		}
+	}
 
 	duration := time.Since(start)
 	throughput := float64(objectSize) / duration.Seconds() / (1024 * 1024) // MB/s
@@ -298,26 +330,17 @@ func downloadFile(ctx context.Context, client *s3.Client, bucket, key, filePath
 
 func determineCompression(compressionType, key, filePath string) (s3streamer.Compression, error) {
 	if compressionType != "" {
-		switch strings.ToLower(compressionType) {
-		case "gzip", "gz":
-			return s3streamer.Gzip, nil
-		case "bzip2", "bz2":
-			return s3streamer.Bzip2, nil
-		case "none", "uncompressed":
-			return s3streamer.Uncompressed, nil
-		default:
+		compression, ok := s3streamer.CompressionByName(compressionType)
+		if !ok {
 			return s3streamer.Uncompressed, fmt.Errorf("unsupported compression type: %s", compressionType)
 		}
+		return compression, nil
 	}
 
 	// Auto-detect from key or file extension
 	for _, path := range []string{key, filePath} {
-		ext := strings.ToLower(filepath.Ext(path))
-		switch ext {
-		case ".gz":
-			return s3streamer.Gzip, nil
-		case ".bz2":
-			return s3streamer.Bzip2, nil
+		if compression, ok := s3streamer.CompressionByExtension(path); ok {
+			return compression, nil
 		}
 	}
 
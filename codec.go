@@ -0,0 +1,311 @@
+package s3streamer
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	dsnetbzip2 "github.com/dsnet/compress/bzip2"
+	"github.com/klauspost/compress/zstd"
+)
+
+// DefaultLevel is passed to Codec.NewWriter when no WithCompressionLevel option was
+// given, asking the codec to use its own default level.
+const DefaultLevel = math.MinInt32
+
+// Codec describes a compression format. Every place that handles compression consults
+// the codec registry: DetectCompression, Decompress, Compression.Extension,
+// CompressedS3Writer and the command line tool. Register additional codecs with
+// RegisterCodec.
+// Example:
+//
+//	lz4Compression, err := s3streamer.RegisterCodec(s3streamer.Codec{
+//	    Name:      "lz4",
+//	    Extension: ".lz4",
+//	    Magic:     []byte{0x04, 0x22, 0x4D, 0x18},
+//	    NewReader: func(r io.Reader) (io.Reader, error) { return lz4.NewReader(r), nil },
+//	    NewWriter: func(w io.Writer, level int) (io.WriteCloser, error) { return lz4.NewWriter(w), nil },
+//	})
+type Codec struct {
+	// Name identifies the codec, for example "gzip". Names are case-insensitive.
+	Name string
+	// Aliases are alternative names, for example "gz".
+	Aliases []string
+	// Extension is the file extension including the dot, for example ".gz".
+	Extension string
+	// ContentEncoding is the Content-Encoding CompressedS3Writer gives the objects it
+	// writes, for example "gzip". Empty sets none.
+	ContentEncoding string
+	// Magic is the byte sequence every stream starts with. Codecs without magic
+	// bytes are never detected automatically. The longest matching magic wins.
+	Magic []byte
+	// NewReader returns a reader that decompresses r. Required.
+	NewReader func(r io.Reader) (io.Reader, error)
+	// NewWriter returns a writer that compresses into w and flushes on Close. The
+	// level is DefaultLevel unless WithCompressionLevel was used. If nil, the codec
+	// can only be read.
+	NewWriter func(w io.Writer, level int) (io.WriteCloser, error)
+}
+
+// codecRegistry holds the registered codecs in registration order.
+var codecRegistry = struct {
+	sync.RWMutex
+	codecs   map[Compression]Codec
+	order    []Compression // Registration order, for deterministic lookups
+	detect   []Compression // Codecs with magic bytes, longest magic first
+	maxMagic int
+	next     Compression
+}{codecs: make(map[Compression]Codec)}
+
+func init() {
+	for _, builtin := range []struct {
+		compression Compression
+		codec       Codec
+	}{
+		{Uncompressed, Codec{
+			Name:      "none",
+			Aliases:   []string{"uncompressed"},
+			NewReader: func(r io.Reader) (io.Reader, error) { return r, nil },
+		}},
+		{Bzip2, Codec{
+			Name:            "bzip2",
+			Aliases:         []string{"bz2"},
+			Extension:       ".bz2",
+			ContentEncoding: "bzip2",
+			Magic:           []byte{0x42, 0x5A, 0x68},
+			NewReader:       func(r io.Reader) (io.Reader, error) { return bzip2.NewReader(r), nil },
+			NewWriter:       newBzip2Writer,
+		}},
+		{Gzip, Codec{
+			Name:            "gzip",
+			Aliases:         []string{"gz"},
+			Extension:       ".gz",
+			ContentEncoding: "gzip",
+			Magic:           []byte{0x1F, 0x8B}, // Only check first 2 bytes to support all gzip compression methods
+			NewReader:       func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+			NewWriter:       newGzipWriter,
+		}},
+		{Zstd, Codec{
+			Name:            "zstd",
+			Aliases:         []string{"zst"},
+			Extension:       ".zst",
+			ContentEncoding: "zstd",
+			Magic:           []byte{0x28, 0xB5, 0x2F, 0xFD},
+			NewReader:       newZstdReader,
+			NewWriter:       newZstdWriter,
+		}},
+	} {
+		if err := registerCodec(builtin.compression, builtin.codec); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// RegisterCodec adds a codec to the registry and returns the Compression value that
+// identifies it. Registration fails if the name, an alias, the extension or the magic
+// bytes are already taken. Codecs are typically registered from an init function.
+// Example:
+//
+//	var Snappy s3streamer.Compression
+//
+//	func init() {
+//	    var err error
+//	    Snappy, err = s3streamer.RegisterCodec(snappyCodec)
+//	    if err != nil {
+//	        panic(err)
+//	    }
+//	}
+func RegisterCodec(codec Codec) (Compression, error) {
+	codecRegistry.Lock()
+	defer codecRegistry.Unlock()
+
+	compression := codecRegistry.next
+	if err := registerCodecLocked(compression, codec); err != nil {
+		return Uncompressed, err
+	}
+	return compression, nil
+}
+
+// registerCodec validates codec and stores it under compression.
+func registerCodec(compression Compression, codec Codec) error {
+	codecRegistry.Lock()
+	defer codecRegistry.Unlock()
+	return registerCodecLocked(compression, codec)
+}
+
+// registerCodecLocked is registerCodec for callers holding the registry lock.
+func registerCodecLocked(compression Compression, codec Codec) error {
+	if codec.Name == "" {
+		return fmt.Errorf("codec name cannot be empty")
+	}
+	if codec.NewReader == nil {
+		return fmt.Errorf("codec %s: NewReader cannot be nil", codec.Name)
+	}
+	if codec.Extension != "" && !strings.HasPrefix(codec.Extension, ".") {
+		return fmt.Errorf("codec %s: extension %q must start with a dot", codec.Name, codec.Extension)
+	}
+	if _, ok := codecRegistry.codecs[compression]; ok {
+		return fmt.Errorf("codec %s: compression %d is already registered", codec.Name, compression)
+	}
+	for _, id := range codecRegistry.order {
+		existing := codecRegistry.codecs[id]
+		for _, name := range append([]string{codec.Name}, codec.Aliases...) {
+			if existing.hasName(name) {
+				return fmt.Errorf("codec %s: name %q is already registered by %s", codec.Name, name, existing.Name)
+			}
+		}
+		if codec.Extension != "" && strings.EqualFold(codec.Extension, existing.Extension) {
+			return fmt.Errorf("codec %s: extension %q is already registered by %s", codec.Name, codec.Extension, existing.Name)
+		}
+		if len(codec.Magic) > 0 && bytes.Equal(codec.Magic, existing.Magic) {
+			return fmt.Errorf("codec %s: magic bytes are already registered by %s", codec.Name, existing.Name)
+		}
+	}
+
+	codec.Aliases = append([]string(nil), codec.Aliases...)
+	codec.Magic = bytes.Clone(codec.Magic)
+	codecRegistry.codecs[compression] = codec
+	codecRegistry.order = append(codecRegistry.order, compression)
+	if compression >= codecRegistry.next {
+		codecRegistry.next = compression + 1
+	}
+
+	if len(codec.Magic) > 0 {
+		codecRegistry.detect = append(codecRegistry.detect, compression)
+		sort.SliceStable(codecRegistry.detect, func(i, j int) bool {
+			return len(codecRegistry.codecs[codecRegistry.detect[i]].Magic) > len(codecRegistry.codecs[codecRegistry.detect[j]].Magic)
+		})
+		codecRegistry.maxMagic = max(codecRegistry.maxMagic, len(codec.Magic))
+	}
+	return nil
+}
+
+// LookupCodec returns the codec registered for compression.
+// Example:
+//
+//	codec, ok := s3streamer.LookupCodec(s3streamer.Gzip)
+//	fmt.Println(codec.Name, ok) // gzip true
+func LookupCodec(compression Compression) (Codec, bool) {
+	codecRegistry.RLock()
+	defer codecRegistry.RUnlock()
+
+	codec, ok := codecRegistry.codecs[compression]
+	return codec, ok
+}
+
+// CompressionByName returns the compression whose codec name or alias matches name,
+// ignoring case.
+// Example:
+//
+//	compression, ok := s3streamer.CompressionByName("zst") // s3streamer.Zstd, true
+func CompressionByName(name string) (Compression, bool) {
+	codecRegistry.RLock()
+	defer codecRegistry.RUnlock()
+
+	for _, compression := range codecRegistry.order {
+		if codecRegistry.codecs[compression].hasName(name) {
+			return compression, true
+		}
+	}
+	return Uncompressed, false
+}
+
+// CompressionByExtension returns the compression whose extension ends path, ignoring
+// case. If several extensions match, the longest one wins.
+// Example:
+//
+//	compression, ok := s3streamer.CompressionByExtension("logs/2024-01-01.json.gz") // s3streamer.Gzip, true
+func CompressionByExtension(path string) (Compression, bool) {
+	codecRegistry.RLock()
+	defer codecRegistry.RUnlock()
+
+	path = strings.ToLower(path)
+	found, best := Uncompressed, 0
+	for _, compression := range codecRegistry.order {
+		ext := strings.ToLower(codecRegistry.codecs[compression].Extension)
+		if ext != "" && len(ext) > best && strings.HasSuffix(path, ext) {
+			found, best = compression, len(ext)
+		}
+	}
+	return found, best > 0
+}
+
+// detectCodec returns the compression whose magic bytes start source. Longer magic
+// sequences are tried first so a codec cannot be shadowed by a shorter prefix.
+func detectCodec(source []byte) Compression {
+	codecRegistry.RLock()
+	defer codecRegistry.RUnlock()
+
+	for _, compression := range codecRegistry.detect {
+		if bytes.HasPrefix(source, codecRegistry.codecs[compression].Magic) {
+			return compression
+		}
+	}
+	return Uncompressed
+}
+
+// maxMagicLength returns the length of the longest registered magic sequence.
+func maxMagicLength() int {
+	codecRegistry.RLock()
+	defer codecRegistry.RUnlock()
+	return codecRegistry.maxMagic
+}
+
+// hasName reports whether name matches the codec's name or one of its aliases.
+func (c Codec) hasName(name string) bool {
+	if strings.EqualFold(c.Name, name) {
+		return true
+	}
+	for _, alias := range c.Aliases {
+		if strings.EqualFold(alias, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// newGzipWriter is the gzip codec's writer constructor.
+func newGzipWriter(w io.Writer, level int) (io.WriteCloser, error) {
+	if level == DefaultLevel {
+		level = gzip.DefaultCompression
+	}
+	return gzip.NewWriterLevel(w, level)
+}
+
+// newBzip2Writer is the bzip2 codec's writer constructor.
+func newBzip2Writer(w io.Writer, level int) (io.WriteCloser, error) {
+	if level == DefaultLevel {
+		level = dsnetbzip2.DefaultCompression
+	}
+	return dsnetbzip2.NewWriter(w, &dsnetbzip2.WriterConfig{Level: level})
+}
+
+// newZstdReader is the zstd codec's reader constructor.
+func newZstdReader(r io.Reader) (io.Reader, error) {
+	// A single decoder goroutine decodes synchronously, so nothing leaks
+	// when the caller abandons the reader without closing it
+	decoder, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return decoder, nil
+}
+
+// newZstdWriter is the zstd codec's writer constructor. Levels follow the zstd
+// command line tool (1 to 22).
+func newZstdWriter(w io.Writer, level int) (io.WriteCloser, error) {
+	encoderLevel := zstd.SpeedDefault
+	if level != DefaultLevel {
+		if level < 1 || level > 22 {
+			return nil, fmt.Errorf("invalid compression level %d (must be 1-22)", level)
+		}
+		encoderLevel = zstd.EncoderLevelFromZstd(level)
+	}
+	return zstd.NewWriter(w, zstd.WithEncoderLevel(encoderLevel))
+}
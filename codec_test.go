@@ -0,0 +1,217 @@
+package s3streamer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+)
+
+// xorMagic starts every stream of the test codec.
+var xorMagic = []byte("XOR1")
+
+// xorWriter writes xorMagic followed by every byte XORed with 0x5A.
+type xorWriter struct {
+	w       io.Writer
+	started bool
+}
+
+func (x *xorWriter) Write(p []byte) (int, error) {
+	if !x.started {
+		if _, err := x.w.Write(xorMagic); err != nil {
+			return 0, err
+		}
+		x.started = true
+	}
+	out := make([]byte, len(p))
+	for i, b := range p {
+		out[i] = b ^ 0x5A
+	}
+	return x.w.Write(out)
+}
+
+func (x *xorWriter) Close() error { return nil }
+
+// xorReader undoes xorWriter.
+type xorReader struct{ r io.Reader }
+
+func (x *xorReader) Read(p []byte) (int, error) {
+	n, err := x.r.Read(p)
+	for i := range p[:n] {
+		p[i] ^= 0x5A
+	}
+	return n, err
+}
+
+// registerXorCodec registers the test codec once for the whole test binary.
+var registerXorCodec = sync.OnceValues(func() (Compression, error) {
+	return RegisterCodec(Codec{
+		Name:      "xor",
+		Aliases:   []string{"x5a"},
+		Extension: ".xor",
+		Magic:     xorMagic,
+		NewReader: func(r io.Reader) (io.Reader, error) {
+			magic := make([]byte, len(xorMagic))
+			if _, err := io.ReadFull(r, magic); err != nil {
+				return nil, fmt.Errorf("failed to read xor header: %w", err)
+			}
+			return &xorReader{r: r}, nil
+		},
+		NewWriter: func(w io.Writer, level int) (io.WriteCloser, error) {
+			if level != DefaultLevel {
+				return nil, fmt.Errorf("xor has no compression levels")
+			}
+			return &xorWriter{w: w}, nil
+		},
+	})
+})
+
+func TestRegisterCodec(t *testing.T) {
+	xor, err := registerXorCodec()
+	if err != nil {
+		t.Fatalf("Failed to register codec: %v", err)
+	}
+	if xor <= Zstd {
+		t.Errorf("Registered compression = %d, want a value after the built-in codecs", xor)
+	}
+
+	if ext := xor.Extension(); ext != ".xor" {
+		t.Errorf("Extension() = %q, want %q", ext, ".xor")
+	}
+	if name := xor.String(); name != "xor" {
+		t.Errorf("String() = %q, want %q", name, "xor")
+	}
+	if got := DetectCompression([]byte("XOR1payload")); got != xor {
+		t.Errorf("DetectCompression() = %v, want %v", got, xor)
+	}
+	for _, name := range []string{"xor", "X5A"} {
+		if got, ok := CompressionByName(name); !ok || got != xor {
+			t.Errorf("CompressionByName(%q) = %v, %v, want %v, true", name, got, ok, xor)
+		}
+	}
+	if got, ok := CompressionByExtension("logs/data.json.XOR"); !ok || got != xor {
+		t.Errorf("CompressionByExtension() = %v, %v, want %v, true", got, ok, xor)
+	}
+}
+
+func TestRegisterCodecRejectsConflicts(t *testing.T) {
+	if _, err := registerXorCodec(); err != nil {
+		t.Fatalf("Failed to register codec: %v", err)
+	}
+
+	newReader := func(r io.Reader) (io.Reader, error) { return r, nil }
+	tests := []struct {
+		name  string
+		codec Codec
+	}{
+		{"empty name", Codec{NewReader: newReader}},
+		{"missing reader", Codec{Name: "noreader"}},
+		{"duplicate name", Codec{Name: "GZIP", NewReader: newReader}},
+		{"duplicate alias", Codec{Name: "other", Aliases: []string{"zst"}, NewReader: newReader}},
+		{"duplicate extension", Codec{Name: "other", Extension: ".xor", NewReader: newReader}},
+		{"extension without dot", Codec{Name: "other", Extension: "oth", NewReader: newReader}},
+		{"duplicate magic", Codec{Name: "other", Magic: []byte{0x1F, 0x8B}, NewReader: newReader}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := RegisterCodec(tt.codec); err == nil {
+				t.Error("Expected registration to fail")
+			}
+		})
+	}
+}
+
+func TestBuiltinCodecLookups(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		compression Compression
+	}{
+		{"gzip", "a/b.json.gz", Gzip},
+		{"gz", "b.GZ", Gzip},
+		{"bzip2", "c.bz2", Bzip2},
+		{"zstd", "d.zst", Zstd},
+		{"none", "e.json", Uncompressed},
+		{"uncompressed", "", Uncompressed},
+	}
+
+	for _, tt := range tests {
+		if got, ok := CompressionByName(tt.name); !ok || got != tt.compression {
+			t.Errorf("CompressionByName(%q) = %v, %v, want %v", tt.name, got, ok, tt.compression)
+		}
+		got, ok := CompressionByExtension(tt.path)
+		if got != tt.compression || ok != (tt.compression != Uncompressed) {
+			t.Errorf("CompressionByExtension(%q) = %v, %v, want %v", tt.path, got, ok, tt.compression)
+		}
+	}
+
+	if _, ok := CompressionByName("lzma"); ok {
+		t.Error("Expected unknown name to fail")
+	}
+}
+
+func TestRegisteredCodecRoundTrip(t *testing.T) {
+	xor, err := registerXorCodec()
+	if err != nil {
+		t.Fatalf("Failed to register codec: %v", err)
+	}
+
+	writerMock := &mockS3ClientWriter{}
+	writer, err := NewCompressedS3Writer(context.Background(), writerMock, "test-bucket", "test-file.xor", 5*1024*1024, xor)
+	if err != nil {
+		t.Fatalf("Failed to create CompressedS3Writer: %v", err)
+	}
+	testData := "first line\nsecond line\nthird line\n"
+	if _, err := writer.Write([]byte(testData)); err != nil {
+		t.Fatalf("Failed to write data: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Failed to close writer: %v", err)
+	}
+
+	uploaded := writerMock.GetUploadedData()
+	if !bytes.HasPrefix(uploaded, xorMagic) {
+		t.Fatalf("Uploaded data does not start with the codec's magic bytes")
+	}
+
+	// Reading detects the codec from the uploaded bytes
+	var lines []string
+	streamer := NewS3Streamer(NewMockS3Client(uploaded))
+	err = streamer.Stream(context.Background(), "test-bucket", "test-file.xor", 0, func(line []byte, offset int64) error {
+		lines = append(lines, string(line))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if len(lines) != 3 || lines[1] != "second line" {
+		t.Errorf("Streamed lines = %q", lines)
+	}
+
+	// Codec-specific level validation surfaces from the constructor
+	_, err = NewCompressedS3Writer(context.Background(), &mockS3ClientWriter{}, "test-bucket", "test-file.xor", 5*1024*1024, xor,
+		WithCompressionLevel(3))
+	if err == nil {
+		t.Error("Expected error for unsupported compression level")
+	}
+}
+
+func TestDecompressPeeksLongestMagic(t *testing.T) {
+	if _, err := registerXorCodec(); err != nil {
+		t.Fatalf("Failed to register codec: %v", err)
+	}
+
+	// Only the magic bytes are available; Decompress must still detect the codec
+	r, err := Decompress(bufio.NewReader(bytes.NewReader(xorMagic)))
+	if err != nil {
+		t.Fatalf("Decompress failed: %v", err)
+	}
+	rest, err := io.ReadAll(r)
+	if err != nil || len(rest) != 0 {
+		t.Errorf("ReadAll = %q, %v, want empty", rest, err)
+	}
+}
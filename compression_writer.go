@@ -1,12 +1,9 @@
 package s3streamer
 
 import (
-	"compress/gzip"
 	"context"
 	"fmt"
 	"io"
-
-	"github.com/dsnet/compress/bzip2"
 )
 
 // CompressedS3Writer wraps an S3Writer with compression support.
@@ -16,14 +13,23 @@ import (
 //   - Uncompressed: No compression (passthrough to S3Writer)
 //   - Gzip: Gzip compression
 //   - Bzip2: Bzip2 compression
+//   - Zstd: Zstandard compression
+//   - Any codec added with RegisterCodec that has a NewWriter
 //
 // Thread Safety: CompressedS3Writer is safe for concurrent use by multiple
 // goroutines, as the underlying S3Writer is thread-safe and compression
 // operations are serialized.
 //
 // Performance: Compression adds CPU overhead but reduces network transfer size.
-// Gzip is faster but less effective than bzip2. Choose based on your CPU vs
-// bandwidth constraints.
+// Gzip is faster but less effective than bzip2. Zstd is usually both faster and
+// smaller than gzip. Choose based on your CPU vs bandwidth constraints, and tune
+// with WithCompressionLevel.
+//
+// Encryption: With WithClientSideEncryption the compressed output is encrypted as
+// EncryptedS3Writer does before it is uploaded (compress-then-encrypt).
+//
+// Seeking: With WithSeekableBlocks gzip output is written in independent blocks and
+// an index of them is uploaded on Close, so readers can start at any line.
 //
 // Error Handling: Compression errors are propagated to the caller. If compression
 // fails, the underlying S3 upload is automatically aborted.
@@ -39,6 +45,8 @@ import (
 //	n, err := writer.Write(data)
 type CompressedS3Writer struct {
 	s3Writer        *S3Writer
+	encryptor       *EncryptedS3Writer  // Nil unless WithClientSideEncryption is set
+	seekable        *seekableGzipWriter // Nil unless WithSeekableBlocks is set
 	compressor      io.WriteCloser
 	compressionType Compression
 }
@@ -49,8 +57,12 @@ type CompressedS3Writer struct {
 //   - Uncompressed: No compression
 //   - Gzip: Gzip compression
 //   - Bzip2: Bzip2 compression
+//   - Zstd: Zstandard compression
 //
-// Parameters are validated by the underlying S3Writer constructor.
+// Parameters are validated by the underlying S3Writer constructor. Options are passed
+// on to it; WithCompressionLevel selects the compression level. The object's
+// Content-Encoding is set to the codec's ContentEncoding unless WithObjectOptions
+// sets one, or the output is encrypted with WithClientSideEncryption.
 //
 // Example:
 //
@@ -60,9 +72,9 @@ type CompressedS3Writer struct {
 //	    log.Fatal(err)
 //	}
 //	defer writer.Close()
-func NewCompressedS3Writer(ctx context.Context, client S3Client, bucket, key string, partSize int64, compression Compression) (*CompressedS3Writer, error) {
+func NewCompressedS3Writer(ctx context.Context, client S3Client, bucket, key string, partSize int64, compression Compression, opts ...WriterOption) (*CompressedS3Writer, error) {
 	// Create the underlying S3Writer
-	s3Writer, err := NewS3Writer(ctx, client, bucket, key, partSize)
+	s3Writer, err := NewS3Writer(ctx, client, bucket, key, partSize, withoutClientSideEncryption(opts)...)
 	if err != nil {
 		return nil, err
 	}
@@ -72,6 +84,15 @@ func NewCompressedS3Writer(ctx context.Context, client S3Client, bucket, key str
 		compressionType: compression,
 	}
 
+	// Encrypt between the compressor and S3Writer
+	if provider := newWriterConfig(opts).encryption; provider != nil {
+		wrapper.encryptor, err = newEncryptedS3Writer(ctx, s3Writer, provider)
+		if err != nil {
+			s3Writer.Abort()
+			return nil, err
+		}
+	}
+
 	// Set up the appropriate compressor
 	if err := wrapper.setupCompressor(); err != nil {
 		s3Writer.Abort() // Clean up the S3 writer on error
@@ -92,7 +113,15 @@ func (cw *CompressedS3Writer) Write(p []byte) (int, error) {
 		return cw.compressor.Write(p)
 	}
 	// No compression, write directly to S3Writer
-	return cw.s3Writer.Write(p)
+	return cw.output().Write(p)
+}
+
+// output returns the writer that receives the compressed data.
+func (cw *CompressedS3Writer) output() io.Writer {
+	if cw.encryptor != nil {
+		return cw.encryptor
+	}
+	return cw.s3Writer
 }
 
 // Close finalizes the compression and the S3 upload. This method must be called
@@ -115,8 +144,19 @@ func (cw *CompressedS3Writer) Close() error {
 		}
 	}
 
-	// Then close the underlying S3Writer
-	return cw.s3Writer.Close()
+	// Then seal the final encrypted chunk and close the underlying S3Writer
+	if cw.encryptor != nil {
+		return cw.encryptor.Close()
+	}
+	if err := cw.s3Writer.Close(); err != nil {
+		return err
+	}
+
+	// The index describes the stored object, so it is only written once that exists
+	if cw.seekable != nil {
+		return cw.uploadSeekIndex()
+	}
+	return nil
 }
 
 // Abort cancels the upload and cleans up resources.
@@ -135,30 +175,57 @@ func (cw *CompressedS3Writer) Abort() error {
 	}
 
 	// Abort the underlying S3Writer
+	if cw.encryptor != nil {
+		return cw.encryptor.Abort()
+	}
 	return cw.s3Writer.Abort()
 }
 
-// setupCompressor initializes the appropriate compressor based on the detected compression type
+// Checksum returns the checksum of the compressed object after a successful Close,
+// when the writer was created with WithChecksum. See S3Writer.Checksum.
+func (cw *CompressedS3Writer) Checksum() (ObjectChecksum, bool) {
+	return cw.s3Writer.Checksum()
+}
+
+// setupCompressor initializes the compressor from the codec registered for the compression type
 func (cw *CompressedS3Writer) setupCompressor() error {
-	switch cw.compressionType {
-	case Gzip:
-		gzipWriter := gzip.NewWriter(cw.s3Writer)
-		cw.compressor = gzipWriter
-		return nil
-	case Bzip2:
-		bzip2Writer, err := bzip2.NewWriter(cw.s3Writer, &bzip2.WriterConfig{
-			Level: bzip2.DefaultCompression,
-		})
-		if err != nil {
-			return fmt.Errorf("failed to create bzip2 writer: %w", err)
-		}
-		cw.compressor = bzip2Writer
-		return nil
-	case Uncompressed:
+	blockSize := cw.s3Writer.cfg.seekBlockSize
+	if blockSize > 0 && (cw.compressionType != Gzip || cw.encryptor != nil) {
+		return fmt.Errorf("seekable blocks are only supported for unencrypted gzip output")
+	}
+	if cw.compressionType == Uncompressed {
 		// No compressor needed
 		cw.compressor = nil
 		return nil
-	default:
+	}
+
+	codec, ok := LookupCodec(cw.compressionType)
+	if !ok || codec.NewWriter == nil {
 		return fmt.Errorf("unsupported compression type: %v", cw.compressionType)
 	}
+
+	level := DefaultLevel
+	if cfg := cw.s3Writer.cfg; cfg.compressionLevelSet {
+		level = cfg.compressionLevel
+	}
+	if blockSize > 0 {
+		seekable, err := newSeekableGzipWriter(cw.output(), level, blockSize)
+		if err != nil {
+			return fmt.Errorf("failed to create %s writer: %w", codec.Name, err)
+		}
+		cw.seekable, cw.compressor = seekable, seekable
+	} else {
+		compressor, err := codec.NewWriter(cw.output(), level)
+		if err != nil {
+			return fmt.Errorf("failed to create %s writer: %w", codec.Name, err)
+		}
+		cw.compressor = compressor
+	}
+
+	// Nothing has been sent yet, so the object can still be labelled. Encrypted
+	// output cannot be decoded by HTTP clients, so it is left unlabelled.
+	if cfg := &cw.s3Writer.cfg; cfg.object.ContentEncoding == "" && cw.encryptor == nil {
+		cfg.object.ContentEncoding = codec.ContentEncoding
+	}
+	return nil
 }
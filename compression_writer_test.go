@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/dsnet/compress/bzip2"
+	"github.com/klauspost/compress/zstd"
 )
 
 func TestCompressedS3Writer_GzipCompression(t *testing.T) {
@@ -106,6 +107,112 @@ func TestCompressedS3Writer_Bzip2Compression(t *testing.T) {
 	}
 }
 
+func TestCompressedS3Writer_ZstdCompression(t *testing.T) {
+	ctx := context.Background()
+	mock := &mockS3ClientWriter{}
+
+	writer, err := NewCompressedS3Writer(ctx, mock, "test-bucket", "test-file.zst", 5*1024*1024, Zstd)
+	if err != nil {
+		t.Fatalf("Failed to create CompressedS3Writer: %v", err)
+	}
+	defer writer.Close()
+
+	testData := []byte("Hello, World!\nThis is a test file.\nCompressed with zstd.\n")
+	if _, err := writer.Write(testData); err != nil {
+		t.Fatalf("Failed to write data: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Failed to close writer: %v", err)
+	}
+
+	uploadedData := mock.GetUploadedData()
+	if DetectCompression(uploadedData) != Zstd {
+		t.Fatal("Uploaded data is not zstd compressed")
+	}
+
+	// Decompress and verify
+	reader, err := zstd.NewReader(bytes.NewReader(uploadedData))
+	if err != nil {
+		t.Fatalf("Failed to create zstd reader: %v", err)
+	}
+	defer reader.Close()
+
+	decompressed, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("Failed to decompress data: %v", err)
+	}
+
+	if !bytes.Equal(decompressed, testData) {
+		t.Errorf("Decompressed data doesn't match original. Expected: %q, Got: %q", testData, decompressed)
+	}
+}
+
+func TestCompressedS3Writer_CompressionLevel(t *testing.T) {
+	testData := bytes.Repeat([]byte(`{"id":1,"name":"compressible record","tags":["a","b","c"]}`+"\n"), 2000)
+
+	tests := []struct {
+		compression Compression
+		fast, best  int
+	}{
+		{Gzip, gzip.BestSpeed, gzip.BestCompression},
+		{Bzip2, bzip2.BestSpeed, bzip2.BestCompression},
+		{Zstd, 1, 19},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.compression.Extension(), func(t *testing.T) {
+			sizes := make(map[int]int)
+			for _, level := range []int{tt.fast, tt.best} {
+				mock := &mockS3ClientWriter{}
+				writer, err := NewCompressedS3Writer(context.Background(), mock, "test-bucket", "test-file", 5*1024*1024,
+					tt.compression, WithCompressionLevel(level))
+				if err != nil {
+					t.Fatalf("Failed to create writer at level %d: %v", level, err)
+				}
+				writer.Write(testData)
+				if err := writer.Close(); err != nil {
+					t.Fatalf("Failed to close writer: %v", err)
+				}
+
+				reader, err := Decompress(bytes.NewReader(mock.GetUploadedData()))
+				if err != nil {
+					t.Fatalf("Failed to decompress: %v", err)
+				}
+				decompressed, err := io.ReadAll(reader)
+				if err != nil || !bytes.Equal(decompressed, testData) {
+					t.Fatalf("Round trip at level %d failed: %v", level, err)
+				}
+				sizes[level] = len(mock.GetUploadedData())
+			}
+			if sizes[tt.best] > sizes[tt.fast] {
+				t.Errorf("Level %d produced %d bytes, more than level %d with %d bytes", tt.best, sizes[tt.best], tt.fast, sizes[tt.fast])
+			}
+		})
+	}
+}
+
+func TestCompressedS3Writer_InvalidCompressionLevel(t *testing.T) {
+	for _, tt := range []struct {
+		compression Compression
+		level       int
+	}{
+		{Gzip, 42},
+		{Bzip2, 42},
+		{Zstd, 0},
+		{Zstd, 23},
+	} {
+		mock := &mockS3ClientWriter{}
+		_, err := NewCompressedS3Writer(context.Background(), mock, "test-bucket", "test-file", 5*1024*1024,
+			tt.compression, WithCompressionLevel(tt.level))
+		if err == nil {
+			t.Errorf("Expected error for %s level %d", tt.compression.Extension(), tt.level)
+		}
+		if mock.uploadID != "" || mock.putObject {
+			t.Errorf("Expected nothing to be uploaded for %s level %d", tt.compression.Extension(), tt.level)
+		}
+	}
+}
+
 func TestCompressedS3Writer_NoCompression(t *testing.T) {
 	ctx := context.Background()
 	mock := &mockS3ClientWriter{}
@@ -210,12 +317,13 @@ func TestCompressedS3Writer_Abort(t *testing.T) {
 		t.Fatalf("Failed to abort upload: %v", err)
 	}
 
-	if !mock.aborted {
-		t.Error("Multipart upload was not aborted")
+	// The compressed data never filled a part, so nothing was sent to S3
+	if mock.uploadID != "" || mock.aborted {
+		t.Error("No multipart upload should have been started")
 	}
 
-	if mock.completed {
-		t.Error("Multipart upload should not be completed after abort")
+	if mock.completed || mock.putObject {
+		t.Error("Object should not be stored after abort")
 	}
 }
 
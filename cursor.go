@@ -0,0 +1,142 @@
+package s3streamer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// Cursor is the position of a scan over many objects, such as StreamPrefix. It records
+// the objects that have been fully processed and, while an object is being read, a
+// checkpoint inside it. Like Checkpoint it is safe to serialize with encoding/json, so a
+// consumer can persist it and resume the whole scan after a restart.
+// Example:
+//
+//	opts := s3streamer.PrefixOptions{
+//	    OnCursor: func(c s3streamer.Cursor) error {
+//	        data, err := json.Marshal(c)
+//	        if err != nil {
+//	            return err
+//	        }
+//	        return os.WriteFile("scan.json", data, 0o644)
+//	    },
+//	}
+type Cursor struct {
+	// Key is the object being read when the cursor was taken, or empty between objects.
+	Key string `json:"key,omitempty"`
+	// VersionID is the version of Key that Checkpoint belongs to, if the bucket is
+	// versioned.
+	VersionID string `json:"version_id,omitempty"`
+	// Checkpoint is the position inside Key to resume from. It is nil when Key has to
+	// be read from the start.
+	Checkpoint *Checkpoint `json:"checkpoint,omitempty"`
+	// Completed lists, in lexicographic order, the keys whose every line has been
+	// processed. They are skipped on resume.
+	Completed []string `json:"completed,omitempty"`
+}
+
+// cursorTracker maintains the cursor of a scan and reports it to onCursor. It is safe
+// for concurrent use by the goroutines streaming different objects.
+type cursorTracker struct {
+	mu          sync.Mutex
+	onCursor    func(Cursor) error
+	checkpoints bool // Track checkpoints inside objects, only done for serial scans
+	resume      Cursor
+	completed   map[string]bool
+	current     Cursor
+}
+
+// newCursorTracker returns a tracker resuming from resume, which may be nil. Positions
+// inside objects are only tracked when serial is set; concurrent scans report a cursor
+// as each object completes.
+func newCursorTracker(resume *Cursor, onCursor func(Cursor) error, serial bool) *cursorTracker {
+	t := &cursorTracker{
+		onCursor:    onCursor,
+		checkpoints: onCursor != nil && serial,
+		completed:   map[string]bool{},
+	}
+	if resume != nil {
+		t.resume = *resume
+		for _, key := range resume.Completed {
+			t.completed[key] = true
+		}
+		t.current.Completed = slices.Sorted(maps.Keys(t.completed))
+	}
+	return t
+}
+
+// pending returns the keys that have not been completed, in the same order.
+func (t *cursorTracker) pending(keys []string) []string {
+	var remaining []string
+	for _, key := range keys {
+		if !t.completed[key] {
+			remaining = append(remaining, key)
+		}
+	}
+	return remaining
+}
+
+// streamTracked reads key with opts, resuming from the cursor's checkpoint and
+// recording new checkpoints if the scan is tracked, and marks the key completed once
+// it is done.
+func (s *S3Streamer) streamTracked(ctx context.Context, bucket, key string, opts StreamOptions, t *cursorTracker, fn func(line []byte, offset int64) error) error {
+	if t.resume.Key == key && t.resume.Checkpoint != nil {
+		opts.Checkpoint = t.resume.Checkpoint
+	}
+	if t.checkpoints {
+		opts.OnCheckpoint = func(cp Checkpoint) error {
+			return t.checkpoint(key, cp)
+		}
+	}
+
+	err := s.StreamWithOptions(ctx, bucket, key, opts, fn)
+	if errors.Is(err, errCheckpointsUnsupported) && opts.Checkpoint == nil {
+		// Nothing has been read yet; read the object without checkpoints, so that
+		// the cursor only moves once it is completed
+		opts.OnCheckpoint = nil
+		err = s.StreamWithOptions(ctx, bucket, key, opts, fn)
+	}
+	if err != nil {
+		return err
+	}
+	return t.complete(key)
+}
+
+// checkpoint records a checkpoint inside key.
+func (t *cursorTracker) checkpoint(key string, cp Checkpoint) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.current.Key = key
+	t.current.VersionID = cp.VersionID
+	t.current.Checkpoint = &cp
+	return t.emit()
+}
+
+// complete marks key as fully processed.
+func (t *cursorTracker) complete(key string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.current.Key == key {
+		t.current.Key, t.current.VersionID, t.current.Checkpoint = "", "", nil
+	}
+	t.completed[key] = true
+	i, _ := slices.BinarySearch(t.current.Completed, key)
+	t.current.Completed = slices.Insert(t.current.Completed, i, key)
+	return t.emit()
+}
+
+// emit passes a copy of the current cursor to onCursor. The caller holds t.mu.
+func (t *cursorTracker) emit() error {
+	if t.onCursor == nil {
+		return nil
+	}
+	cursor := t.current
+	cursor.Completed = slices.Clone(t.current.Completed)
+	if err := t.onCursor(cursor); err != nil {
+		return fmt.Errorf("cursor callback failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package s3streamer
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// cursorTestObjects returns gzip, bzip2, zstd and plain objects under "data/".
+func cursorTestObjects(t *testing.T) map[string]string {
+	lines := checkpointTestLines(3000)
+	return map[string]string{
+		"data/a.json.gz":  string(compressForTest(t, lines, Gzip, gzip.DefaultCompression, 0)),
+		"data/b.json.bz2": string(compressForTest(t, lines[:len(lines)/2], Bzip2, 9, 0)),
+		"data/c.json.zst": string(prepareTestData(t, 200, Zstd)),
+		"data/d.json":     string(lines),
+	}
+}
+
+type cursorTestLine struct {
+	key    string
+	offset int64
+}
+
+func TestStreamPrefix_Cursor(t *testing.T) {
+	streamer := NewS3Streamer(newBucketTestClient(cursorTestObjects(t)))
+
+	var all []cursorTestLine
+	var cursors []Cursor
+	var seen []int // Lines processed when each cursor was emitted
+	err := streamer.StreamPrefix(context.Background(), "test-bucket", "data/", PrefixOptions{
+		Stream: StreamOptions{CheckpointInterval: 64 * 1024},
+		OnCursor: func(c Cursor) error {
+			cursors = append(cursors, c)
+			seen = append(seen, len(all))
+			return nil
+		},
+	}, func(key string, line []byte, offset int64) error {
+		all = append(all, cursorTestLine{key, offset})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamPrefix failed: %v", err)
+	}
+
+	last := cursors[len(cursors)-1]
+	if last.Key != "" || len(last.Completed) != 4 {
+		t.Errorf("Final cursor %+v, want four completed keys", last)
+	}
+
+	var inside int
+	for i, cursor := range cursors {
+		if cursor.Checkpoint != nil {
+			inside++
+			if cursor.Key == "data/c.json.zst" {
+				t.Errorf("Checkpoint inside a zstd object")
+			}
+		}
+
+		// Every cursor survives JSON and resumes exactly after the lines before it
+		data, err := json.Marshal(cursor)
+		if err != nil {
+			t.Fatalf("Marshal failed: %v", err)
+		}
+		var resume Cursor
+		if err := json.Unmarshal(data, &resume); err != nil {
+			t.Fatalf("Unmarshal failed: %v", err)
+		}
+
+		var got []cursorTestLine
+		err = streamer.StreamPrefix(context.Background(), "test-bucket", "data/", PrefixOptions{Cursor: &resume},
+			func(key string, line []byte, offset int64) error {
+				got = append(got, cursorTestLine{key, offset})
+				return nil
+			})
+		if err != nil {
+			t.Fatalf("Resume from cursor %d failed: %v", i, err)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(all[seen[i]:]) {
+			t.Errorf("Cursor %d (%s, %d completed): resumed %d lines, want %d", i, cursor.Key, len(cursor.Completed), len(got), len(all)-seen[i])
+		}
+	}
+	if inside < 4 {
+		t.Errorf("Only %d cursors point inside an object", inside)
+	}
+}
+
+func TestStreamPrefix_CursorConcurrency(t *testing.T) {
+	streamer := NewS3Streamer(newBucketTestClient(cursorTestObjects(t)))
+
+	var mu sync.Mutex
+	var cursors []Cursor
+	err := streamer.StreamPrefix(context.Background(), "test-bucket", "data/", PrefixOptions{
+		Concurrency: 3,
+		Stream:      StreamOptions{CheckpointInterval: 64 * 1024},
+		OnCursor: func(c Cursor) error {
+			mu.Lock()
+			defer mu.Unlock()
+			cursors = append(cursors, c)
+			return nil
+		},
+	}, func(string, []byte, int64) error { return nil })
+	if err != nil {
+		t.Fatalf("StreamPrefix failed: %v", err)
+	}
+	if len(cursors) != 4 {
+		t.Fatalf("Got %d cursors, want one per object", len(cursors))
+	}
+	for i, cursor := range cursors {
+		if cursor.Key != "" || len(cursor.Completed) != i+1 {
+			t.Errorf("Cursor %d: %+v", i, cursor)
+		}
+	}
+
+	// Resuming skips the completed objects
+	keys := map[string]bool{}
+	err = streamer.StreamPrefix(context.Background(), "test-bucket", "data/", PrefixOptions{Concurrency: 3, Cursor: &cursors[1]},
+		func(key string, line []byte, offset int64) error {
+			mu.Lock()
+			defer mu.Unlock()
+			keys[key] = true
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("Resume failed: %v", err)
+	}
+	for _, key := range cursors[1].Completed {
+		if keys[key] {
+			t.Errorf("Completed key %s streamed again", key)
+		}
+	}
+	if len(keys) != 2 {
+		t.Errorf("Resumed %d keys, want 2", len(keys))
+	}
+}
+
+func TestStreamPrefix_CursorError(t *testing.T) {
+	streamer := NewS3Streamer(newBucketTestClient(cursorTestObjects(t)))
+	errStore := errors.New("store down")
+	err := streamer.StreamPrefix(context.Background(), "test-bucket", "data/", PrefixOptions{
+		OnCursor: func(Cursor) error { return errStore },
+	}, func(string, []byte, int64) error { return nil })
+	if !errors.Is(err, errStore) {
+		t.Errorf("Expected cursor callback error, got %v", err)
+	}
+}
@@ -2,9 +2,7 @@ package s3streamer
 
 import (
 	"bufio"
-	"bytes"
-	"compress/bzip2"
-	"compress/gzip"
+	"fmt"
 	"io"
 )
 
@@ -22,40 +20,41 @@ const (
 	Bzip2
 	// Gzip indicates gzip compression
 	Gzip
+	// Zstd indicates Zstandard compression
+	Zstd
 )
 
-// Extension returns the file extension for the detected compression type.
+// Extension returns the file extension for the detected compression type, as registered
+// with its codec.
 // Example:
 //
 //	compression := s3streamer.Gzip
 //	ext := compression.Extension() // Returns ".gz"
 func (compression *Compression) Extension() string {
-	switch *compression {
-	case Uncompressed:
-		return ""
-	case Bzip2:
-		return ".bz2"
-	case Gzip:
-		return ".gz"
+	codec, ok := LookupCodec(*compression)
+	if !ok {
+		return "[unknown]"
 	}
-	return "[unknown]"
+	return codec.Extension
 }
 
-// DetectCompression detects the compression type from the file's magic bytes.
+// String returns the name of the codec registered for the compression type.
+func (compression Compression) String() string {
+	codec, ok := LookupCodec(compression)
+	if !ok {
+		return fmt.Sprintf("Compression(%d)", int(compression))
+	}
+	return codec.Name
+}
+
+// DetectCompression detects the compression type from the file's magic bytes, checking
+// every registered codec.
 // Example:
 //
 //	data := []byte{0x1F, 0x8B, ...} // Gzip magic bytes
 //	compression := s3streamer.DetectCompression(data) // Returns s3streamer.Gzip
 func DetectCompression(source []byte) Compression {
-	for compression, m := range map[Compression][]byte{
-		Bzip2: {0x42, 0x5A, 0x68},
-		Gzip:  {0x1F, 0x8B}, // Only check first 2 bytes to support all gzip compression methods
-	} {
-		if len(source) >= len(m) && bytes.Equal(m, source[:len(m)]) {
-			return compression
-		}
-	}
-	return Uncompressed
+	return detectCodec(source)
 }
 
 // Decompress takes a reader and returns a decompressed reader based on the detected compression.
@@ -68,20 +67,15 @@ func DetectCompression(source []byte) Compression {
 //	}
 func Decompress(stream io.Reader) (io.Reader, error) {
 	buf := bufio.NewReader(stream)
-	bs, err := buf.Peek(10)
+	bs, err := buf.Peek(max(10, maxMagicLength()))
 	if err != nil && err != io.EOF {
 		return nil, err
 	}
 
 	compression := DetectCompression(bs)
-	switch compression {
-	case Uncompressed:
+	if compression == Uncompressed {
 		return buf, nil
-	case Gzip:
-		return gzip.NewReader(buf)
-	case Bzip2:
-		return bzip2.NewReader(buf), nil
-	default:
-		return stream, nil
 	}
+	codec, _ := LookupCodec(compression)
+	return codec.NewReader(buf)
 }
@@ -5,6 +5,8 @@ import (
 	"io"
 	"strings"
 	"testing"
+
+	"github.com/klauspost/compress/zstd"
 )
 
 func TestCompressionExtension(t *testing.T) {
@@ -15,6 +17,7 @@ func TestCompressionExtension(t *testing.T) {
 		{Uncompressed, ""},
 		{Gzip, ".gz"},
 		{Bzip2, ".bz2"},
+		{Zstd, ".zst"},
 	}
 
 	for _, test := range tests {
@@ -66,6 +69,16 @@ func TestDetectCompressionBzip2(t *testing.T) {
 	}
 }
 
+func TestDetectCompressionZstd(t *testing.T) {
+	// Zstandard frame magic number 0xFD2FB528, little endian
+	zstdData := []byte{0x28, 0xB5, 0x2F, 0xFD, 0x04, 0x00}
+
+	compression := DetectCompression(zstdData)
+	if compression != Zstd {
+		t.Errorf("Expected Zstd compression, got %d", compression)
+	}
+}
+
 func TestDetectCompressionUncompressed(t *testing.T) {
 	// Regular text data
 	textData := []byte("Hello, World! This is uncompressed text data.")
@@ -162,3 +175,29 @@ func TestDecompressEmptyStream(t *testing.T) {
 		t.Errorf("Expected empty result, got %d bytes", len(result))
 	}
 }
+
+func TestDecompressZstd(t *testing.T) {
+	testData := strings.Repeat("Hello, Zstandard! This line repeats.\n", 100)
+
+	var compressed bytes.Buffer
+	encoder, err := zstd.NewWriter(&compressed)
+	if err != nil {
+		t.Fatalf("Failed to create zstd writer: %v", err)
+	}
+	encoder.Write([]byte(testData))
+	encoder.Close()
+
+	decompressed, err := Decompress(bytes.NewReader(compressed.Bytes()))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	result, err := io.ReadAll(decompressed)
+	if err != nil {
+		t.Fatalf("Error reading decompressed data: %v", err)
+	}
+
+	if string(result) != testData {
+		t.Errorf("Decompressed data doesn't match original")
+	}
+}
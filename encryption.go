@@ -0,0 +1,129 @@
+package s3streamer
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// CustomerKey is a 256-bit key for server-side encryption with customer-provided keys
+// (SSE-C). S3 encrypts the object with the key and requires the same key on every
+// request that reads or writes the object's data. Create one with NewCustomerKey.
+type CustomerKey struct {
+	key    string // Base64 encoded key
+	keyMD5 string // Base64 encoded MD5 of the key, which S3 uses to check it arrived intact
+}
+
+// NewCustomerKey returns the SSE-C key for 32 raw key bytes.
+// Example:
+//
+//	key, err := s3streamer.NewCustomerKey(secret) // 32 bytes
+//	if err != nil {
+//	    return err
+//	}
+//	streamer := s3streamer.NewS3Streamer(client, s3streamer.WithReadCustomerKey(key))
+func NewCustomerKey(key []byte) (CustomerKey, error) {
+	if len(key) != 32 {
+		return CustomerKey{}, fmt.Errorf("customer key must be 32 bytes, got %d", len(key))
+	}
+	sum := md5.Sum(key)
+	return CustomerKey{
+		key:    base64.StdEncoding.EncodeToString(key),
+		keyMD5: base64.StdEncoding.EncodeToString(sum[:]),
+	}, nil
+}
+
+// WithReadCustomerKey sends the SSE-C key with every HeadObject, ranged GetObject and
+// GetObjectAttributes request made by S3Streamer and ChunkStreamer.
+// Example:
+//
+//	streamer := s3streamer.NewChunkStreamer(ctx, client, "my-bucket", "archive.json.gz", 0, size, 5*1024*1024,
+//	    s3streamer.WithReadCustomerKey(key))
+func WithReadCustomerKey(key CustomerKey) ReaderOption {
+	return func(cfg *readerConfig) {
+		cfg.customerKey = &key
+	}
+}
+
+// WithUploadCustomerKey encrypts the object S3Writer creates with the SSE-C key. The key
+// is sent with the upload and every part, and must be given again to read the object.
+// It cannot be combined with WithKMSEncryption.
+// Example:
+//
+//	writer, err := s3streamer.NewS3Writer(ctx, client, "my-bucket", "archive.json", 8*1024*1024,
+//	    s3streamer.WithUploadCustomerKey(key))
+func WithUploadCustomerKey(key CustomerKey) WriterOption {
+	return func(cfg *writerConfig) {
+		cfg.customerKey = &key
+	}
+}
+
+// apply sets the SSE-C request fields. It does nothing for a nil key.
+func (k *CustomerKey) apply(algorithm, key, keyMD5 **string) {
+	if k == nil {
+		return
+	}
+	*algorithm = aws.String("AES256")
+	*key = aws.String(k.key)
+	*keyMD5 = aws.String(k.keyMD5)
+}
+
+// KMSEncryption configures server-side encryption with AWS KMS keys (SSE-KMS).
+type KMSEncryption struct {
+	// KeyID is the ID, ARN or alias of the KMS key. Empty uses the AWS managed key
+	// aws/s3.
+	KeyID string
+	// Context is additional authenticated data that KMS binds to the data key. It is
+	// required again for KMS grants and policies that condition on it.
+	Context map[string]string
+	// BucketKeyEnabled uses an S3 Bucket Key, reducing the number of KMS requests.
+	BucketKeyEnabled bool
+}
+
+// WithKMSEncryption encrypts the object S3Writer creates with a KMS key. Reading it
+// needs no options, only kms:Decrypt permission on the key.
+// Example:
+//
+//	writer, err := s3streamer.NewS3Writer(ctx, client, "my-bucket", "output.json", 8*1024*1024,
+//	    s3streamer.WithKMSEncryption(s3streamer.KMSEncryption{
+//	        KeyID:            "arn:aws:kms:eu-west-1:111122223333:key/1234abcd-12ab-34cd-56ef-1234567890ab",
+//	        BucketKeyEnabled: true,
+//	    }))
+func WithKMSEncryption(kms KMSEncryption) WriterOption {
+	return func(cfg *writerConfig) {
+		cfg.kms = &kms
+	}
+}
+
+// encryptionFields points at the encryption settings of a CreateMultipartUpload or
+// PutObject request.
+type encryptionFields struct {
+	serverSideEncryption                        *types.ServerSideEncryption
+	kmsKeyID, kmsContext                        **string
+	bucketKeyEnabled                            **bool
+	customerAlgorithm, customerKey, customerMD5 **string
+}
+
+// applyEncryption sets the SSE-KMS or SSE-C settings of cfg.
+func (cfg writerConfig) applyEncryption(f encryptionFields) {
+	cfg.customerKey.apply(f.customerAlgorithm, f.customerKey, f.customerMD5)
+	if cfg.kms == nil {
+		return
+	}
+
+	*f.serverSideEncryption = types.ServerSideEncryptionAwsKms
+	if cfg.kms.KeyID != "" {
+		*f.kmsKeyID = aws.String(cfg.kms.KeyID)
+	}
+	if len(cfg.kms.Context) > 0 {
+		context, _ := json.Marshal(cfg.kms.Context) // A map of strings always marshals
+		*f.kmsContext = aws.String(base64.StdEncoding.EncodeToString(context))
+	}
+	if cfg.kms.BucketKeyEnabled {
+		*f.bucketKeyEnabled = aws.Bool(true)
+	}
+}
@@ -0,0 +1,192 @@
+package s3streamer
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// testCustomerKey returns a fixed SSE-C key.
+func testCustomerKey(t *testing.T) CustomerKey {
+	t.Helper()
+	key, err := NewCustomerKey(bytes.Repeat([]byte{0x42}, 32))
+	if err != nil {
+		t.Fatalf("Failed to create customer key: %v", err)
+	}
+	return key
+}
+
+// checkCustomerKey reports whether the SSE-C request fields carry key.
+func checkCustomerKey(key CustomerKey, algorithm, customerKey, keyMD5 *string) error {
+	if aws.ToString(algorithm) != "AES256" || aws.ToString(customerKey) != key.key || aws.ToString(keyMD5) != key.keyMD5 {
+		return fmt.Errorf("missing or wrong SSE-C headers (algorithm %q)", aws.ToString(algorithm))
+	}
+	return nil
+}
+
+func TestNewCustomerKey(t *testing.T) {
+	raw := bytes.Repeat([]byte{0x42}, 32)
+	key, err := NewCustomerKey(raw)
+	if err != nil {
+		t.Fatalf("NewCustomerKey failed: %v", err)
+	}
+	sum := md5.Sum(raw)
+	if key.key != base64.StdEncoding.EncodeToString(raw) || key.keyMD5 != base64.StdEncoding.EncodeToString(sum[:]) {
+		t.Errorf("Unexpected key encoding: %+v", key)
+	}
+
+	if _, err := NewCustomerKey(raw[:16]); err == nil {
+		t.Error("Expected error for a 128-bit key")
+	}
+}
+
+func TestS3Writer_KMSEncryption(t *testing.T) {
+	kms := KMSEncryption{
+		KeyID:            "arn:aws:kms:eu-west-1:111122223333:key/test",
+		Context:          map[string]string{"dataset": "events"},
+		BucketKeyEnabled: true,
+	}
+	check := func(t *testing.T, sse types.ServerSideEncryption, keyID, encryptionContext *string, bucketKey *bool) {
+		t.Helper()
+		if sse != types.ServerSideEncryptionAwsKms || aws.ToString(keyID) != kms.KeyID || !aws.ToBool(bucketKey) {
+			t.Errorf("SSE %q, key %q, bucket key %v", sse, aws.ToString(keyID), aws.ToBool(bucketKey))
+		}
+		decoded, err := base64.StdEncoding.DecodeString(aws.ToString(encryptionContext))
+		var got map[string]string
+		if err != nil || json.Unmarshal(decoded, &got) != nil || got["dataset"] != "events" {
+			t.Errorf("Encryption context = %q", aws.ToString(encryptionContext))
+		}
+	}
+
+	partSize := int64(5 * 1024 * 1024)
+	for _, size := range []int64{10, partSize + 10} {
+		t.Run(fmt.Sprint(size), func(t *testing.T) {
+			client := newChecksumRecordingClient()
+			writer, err := NewS3Writer(context.Background(), client, "test-bucket", "test-key", partSize, WithKMSEncryption(kms))
+			if err != nil {
+				t.Fatalf("Failed to create S3Writer: %v", err)
+			}
+			writer.Write(sizedTestData(size))
+			if err := writer.Close(); err != nil {
+				t.Fatalf("Failed to close writer: %v", err)
+			}
+			if in := client.putInput; in != nil {
+				check(t, in.ServerSideEncryption, in.SSEKMSKeyId, in.SSEKMSEncryptionContext, in.BucketKeyEnabled)
+			} else {
+				in := client.createInput
+				check(t, in.ServerSideEncryption, in.SSEKMSKeyId, in.SSEKMSEncryptionContext, in.BucketKeyEnabled)
+			}
+		})
+	}
+}
+
+func TestS3Writer_CustomerKey(t *testing.T) {
+	key := testCustomerKey(t)
+	partSize := int64(5 * 1024 * 1024)
+
+	client := newChecksumRecordingClient()
+	writer, err := NewS3Writer(context.Background(), client, "test-bucket", "test-key", partSize,
+		WithUploadCustomerKey(key), WithChecksum(types.ChecksumAlgorithmCrc32c))
+	if err != nil {
+		t.Fatalf("Failed to create S3Writer: %v", err)
+	}
+	writer.Write(sizedTestData(2*partSize + 10))
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Failed to close writer: %v", err)
+	}
+
+	if err := checkCustomerKey(key, client.createInput.SSECustomerAlgorithm, client.createInput.SSECustomerKey, client.createInput.SSECustomerKeyMD5); err != nil {
+		t.Errorf("CreateMultipartUpload: %v", err)
+	}
+	for _, in := range client.partInputs {
+		if err := checkCustomerKey(key, in.SSECustomerAlgorithm, in.SSECustomerKey, in.SSECustomerKeyMD5); err != nil {
+			t.Errorf("UploadPart %d: %v", aws.ToInt32(in.PartNumber), err)
+		}
+	}
+	if err := checkCustomerKey(key, client.completeInput.SSECustomerAlgorithm, client.completeInput.SSECustomerKey, client.completeInput.SSECustomerKeyMD5); err != nil {
+		t.Errorf("CompleteMultipartUpload: %v", err)
+	}
+	if client.createInput.ServerSideEncryption != "" {
+		t.Errorf("SSE-C upload also requested %q", client.createInput.ServerSideEncryption)
+	}
+}
+
+func TestS3Writer_CombinedEncryption(t *testing.T) {
+	_, err := NewS3Writer(context.Background(), &mockS3ClientWriter{}, "test-bucket", "test-key", 5*1024*1024,
+		WithKMSEncryption(KMSEncryption{}), WithUploadCustomerKey(testCustomerKey(t)))
+	if err == nil {
+		t.Error("Expected error when combining SSE-KMS and SSE-C")
+	}
+}
+
+// customerKeyClient rejects reads of a MockS3Client object that lack its SSE-C key.
+type customerKeyClient struct {
+	*attributesClient
+	key CustomerKey
+}
+
+func (c *customerKeyClient) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	if err := checkCustomerKey(c.key, params.SSECustomerAlgorithm, params.SSECustomerKey, params.SSECustomerKeyMD5); err != nil {
+		return nil, fmt.Errorf("HeadObject: %w", err)
+	}
+	return c.attributesClient.HeadObject(ctx, params, optFns...)
+}
+
+func (c *customerKeyClient) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	if err := checkCustomerKey(c.key, params.SSECustomerAlgorithm, params.SSECustomerKey, params.SSECustomerKeyMD5); err != nil {
+		return nil, fmt.Errorf("GetObject: %w", err)
+	}
+	return c.attributesClient.GetObject(ctx, params, optFns...)
+}
+
+func (c *customerKeyClient) GetObjectAttributes(ctx context.Context, params *s3.GetObjectAttributesInput, optFns ...func(*s3.Options)) (*s3.GetObjectAttributesOutput, error) {
+	if err := checkCustomerKey(c.key, params.SSECustomerAlgorithm, params.SSECustomerKey, params.SSECustomerKeyMD5); err != nil {
+		return nil, fmt.Errorf("GetObjectAttributes: %w", err)
+	}
+	return c.attributesClient.GetObjectAttributes(ctx, params, optFns...)
+}
+
+func TestS3Streamer_CustomerKey(t *testing.T) {
+	ctx := context.Background()
+	key := testCustomerKey(t)
+	data := sizedTestData(3000)
+	client := &customerKeyClient{
+		attributesClient: newAttributesClient(data, types.ChecksumAlgorithmCrc64nvme, types.ChecksumTypeFullObject, 1000),
+		key:              key,
+	}
+
+	streamer := NewS3Streamer(client, WithReadCustomerKey(key), WithChecksumVerification())
+	streamer.chunkSize = 512
+	var got bytes.Buffer
+	err := streamer.Stream(ctx, "test-bucket", "test-key", 0, func(line []byte, offset int64) error {
+		got.Write(line)
+		got.WriteByte('\n')
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if !bytes.Equal(bytes.TrimSuffix(got.Bytes(), []byte("\n")), bytes.TrimSuffix(data, []byte("\n"))) {
+		t.Error("Streamed data does not match")
+	}
+
+	// Without the key every request is rejected
+	if err := NewS3Streamer(client).Stream(ctx, "test-bucket", "test-key", 0, func([]byte, int64) error { return nil }); err == nil {
+		t.Error("Expected error when streaming without the customer key")
+	}
+
+	chunks := NewChunkStreamer(ctx, client, "test-bucket", "test-key", 0, int64(len(data)), 700, WithReadCustomerKey(key))
+	defer chunks.Close()
+	if read, err := io.ReadAll(chunks); err != nil || !bytes.Equal(read, data) {
+		t.Errorf("ChunkStreamer read %d bytes, err %v", len(read), err)
+	}
+}
@@ -0,0 +1,182 @@
+package s3streamer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Framing splits a decompressed stream into records. The zero value splits lines like
+// LineFraming. Offsets reported by Stream always count every byte of the stream,
+// including delimiters, prefixes and carriage returns, so a record's offset is where
+// its frame starts.
+// Example:
+//
+//	err := streamer.StreamWithOptions(ctx, "my-bucket", "events.json-seq", s3streamer.StreamOptions{
+//	    Framing: s3streamer.JSONSeqFraming(),
+//	}, processRecord)
+type Framing struct {
+	kind   framingKind
+	delim  byte         // Delimiter of delimitedFrames
+	prefix LengthPrefix // Length encoding of lengthPrefixedFrames
+}
+
+// framingKind identifies a record format.
+type framingKind int
+
+const (
+	lineFrames framingKind = iota
+	delimitedFrames
+	jsonSeqFrames
+	lengthPrefixedFrames
+)
+
+// LineFraming splits records at LF. A CR before the LF is removed from the record but
+// counted in offsets, so files with CRLF line endings are handled too.
+func LineFraming() Framing {
+	return Framing{kind: lineFrames}
+}
+
+// DelimitedFraming splits records at delim, for example 0 for NUL-delimited output
+// of find -print0. The delimiter is removed from the record.
+func DelimitedFraming(delim byte) Framing {
+	return Framing{kind: delimitedFrames, delim: delim}
+}
+
+// recordSeparator starts every JSON text in an RFC 7464 sequence.
+const recordSeparator = 0x1E
+
+// JSONSeqFraming splits RFC 7464 JSON text sequences, in which every JSON text starts
+// with an RS (0x1E) byte and ends with LF. Records exclude the RS and the final LF;
+// empty records are skipped. A sequence that does not start with RS fails the stream.
+func JSONSeqFraming() Framing {
+	return Framing{kind: jsonSeqFrames}
+}
+
+// LengthPrefix is the encoding of the record length in LengthPrefixedFraming.
+type LengthPrefix int
+
+const (
+	// VarintPrefix is an unsigned varint, as written by binary.AppendUvarint and
+	// used for delimited protobuf messages.
+	VarintPrefix LengthPrefix = iota
+	// Uint32Prefix is a 4 byte big-endian unsigned integer.
+	Uint32Prefix
+)
+
+// LengthPrefixedFraming splits records that are each preceded by their length. The
+// prefix is removed from the record. A stream that ends inside a record fails.
+// Example:
+//
+//	err := streamer.StreamWithOptions(ctx, "my-bucket", "messages.bin", s3streamer.StreamOptions{
+//	    Framing: s3streamer.LengthPrefixedFraming(s3streamer.VarintPrefix),
+//	}, func(message []byte, offset int64) error {
+//	    return proto.Unmarshal(message, &event)
+//	})
+func LengthPrefixedFraming(prefix LengthPrefix) Framing {
+	return Framing{kind: lengthPrefixedFrames, prefix: prefix}
+}
+
+// split is the bufio.SplitFunc of the framing.
+func (f Framing) split(data []byte, atEOF bool) (int, []byte, error) {
+	switch f.kind {
+	case delimitedFrames:
+		if i := bytes.IndexByte(data, f.delim); i >= 0 {
+			return i + 1, data[:i], nil
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+
+	case jsonSeqFrames:
+		if len(data) == 0 {
+			return 0, nil, nil
+		}
+		if data[0] != recordSeparator {
+			return 0, nil, fmt.Errorf("JSON text sequence record does not start with RS (0x1E)")
+		}
+		advance, record, found := f.tail(data[1:], atEOF)
+		if !found {
+			return 0, nil, nil
+		}
+		if len(record) == 0 {
+			return advance + 1, nil, nil
+		}
+		return advance + 1, record, nil
+
+	case lengthPrefixedFrames:
+		if len(data) == 0 {
+			return 0, nil, nil
+		}
+		header, length, err := f.header(data)
+		if err != nil {
+			return 0, nil, err
+		}
+		if header > 0 && uint64(len(data)-header) >= length {
+			end := header + int(length)
+			return end, data[header:end], nil
+		}
+		if atEOF {
+			return 0, nil, errTruncatedRecord
+		}
+		return 0, nil, nil
+
+	default:
+		return bufio.ScanLines(data, atEOF)
+	}
+}
+
+// errTruncatedRecord reports a length-prefixed record cut short by the end of the stream.
+var errTruncatedRecord = fmt.Errorf("stream ends inside a length-prefixed record")
+
+// header decodes the length prefix at the start of data. It returns a zero header size
+// if data holds only part of the prefix.
+func (f Framing) header(data []byte) (int, uint64, error) {
+	if f.prefix == Uint32Prefix {
+		if len(data) < 4 {
+			return 0, 0, nil
+		}
+		return 4, uint64(binary.BigEndian.Uint32(data)), nil
+	}
+	length, n := binary.Uvarint(data)
+	if n < 0 {
+		return 0, 0, fmt.Errorf("record length prefix overflows 64 bits")
+	}
+	return n, length, nil
+}
+
+// tail finds the end of a delimited record in data, which continues the record. It
+// returns the number of bytes up to and including the delimiter and the record bytes
+// they hold, or found false if the record goes on past data.
+func (f Framing) tail(data []byte, atEOF bool) (advance int, record []byte, found bool) {
+	var end int
+	switch f.kind {
+	case delimitedFrames:
+		end = bytes.IndexByte(data, f.delim)
+		advance = end + 1
+	case jsonSeqFrames:
+		// A JSON text ends where the next one starts
+		end = bytes.IndexByte(data, recordSeparator)
+		advance = end
+	default:
+		end = bytes.IndexByte(data, '\n')
+		advance = end + 1
+	}
+	if end < 0 {
+		if !atEOF {
+			return 0, nil, false
+		}
+		end, advance = len(data), len(data)
+	}
+
+	record = data[:end]
+	switch f.kind {
+	case jsonSeqFrames:
+		record = bytes.TrimSuffix(record, []byte("\n"))
+	case lineFrames:
+		record = bytes.TrimSuffix(record, []byte("\r"))
+	}
+	return advance, record, true
+}
@@ -0,0 +1,128 @@
+package s3streamer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"testing"
+)
+
+// streamRecords streams data with framing and returns the records and their offsets.
+func streamRecords(t *testing.T, data []byte, opts StreamOptions) ([]string, []int64, error) {
+	t.Helper()
+	streamer := NewS3Streamer(NewMockS3Client(data))
+	streamer.chunkSize = 7 // Split frames across chunks
+	var records []string
+	var offsets []int64
+	err := streamer.StreamWithOptions(context.Background(), "test-bucket", "test-key", opts, func(record []byte, offset int64) error {
+		records = append(records, string(record))
+		offsets = append(offsets, offset)
+		return nil
+	})
+	return records, offsets, err
+}
+
+func TestStreamWithOptions_Framing(t *testing.T) {
+	varint := binary.AppendUvarint(nil, 3)
+	varint = append(varint, "abc"...)
+	varint = binary.AppendUvarint(varint, 0)
+	varint = binary.AppendUvarint(varint, 200)
+	varint = append(varint, bytes.Repeat([]byte("x"), 200)...)
+
+	uint32BE := binary.BigEndian.AppendUint32(nil, 2)
+	uint32BE = append(uint32BE, "hi"...)
+	uint32BE = binary.BigEndian.AppendUint32(uint32BE, 5)
+	uint32BE = append(uint32BE, "there"...)
+
+	tests := []struct {
+		name    string
+		framing Framing
+		data    string
+		records []string
+		offsets []int64
+	}{
+		{"default LF", Framing{}, "one\ntwo\n\nfour", []string{"one", "two", "", "four"}, []int64{0, 4, 8, 9}},
+		{"CRLF", LineFraming(), "one\r\ntwo\r\n\r\nfour\r\n", []string{"one", "two", "", "four"}, []int64{0, 5, 10, 12}},
+		{"NUL", DelimitedFraming(0), "a/b\x00c d\x00\x00e", []string{"a/b", "c d", "", "e"}, []int64{0, 4, 8, 9}},
+		{"RFC 7464", JSONSeqFraming(), "\x1e{\"a\":1}\n\x1e\x1e[2]\n\x1e\"three\"\n", []string{`{"a":1}`, "[2]", `"three"`}, []int64{0, 10, 15}},
+		{"varint", LengthPrefixedFraming(VarintPrefix), string(varint), []string{"abc", "", string(bytes.Repeat([]byte("x"), 200))}, []int64{0, 4, 5}},
+		{"uint32", LengthPrefixedFraming(Uint32Prefix), string(uint32BE), []string{"hi", "there"}, []int64{0, 6}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, offsets, err := streamRecords(t, []byte(tt.data), StreamOptions{Framing: tt.framing})
+			if err != nil {
+				t.Fatalf("Stream failed: %v", err)
+			}
+			if fmt.Sprint(records) != fmt.Sprint(tt.records) {
+				t.Errorf("Records = %q, want %q", records, tt.records)
+			}
+			if fmt.Sprint(offsets) != fmt.Sprint(tt.offsets) {
+				t.Errorf("Offsets = %v, want %v", offsets, tt.offsets)
+			}
+		})
+	}
+}
+
+func TestStreamWithOptions_FramingErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		framing Framing
+		data    []byte
+	}{
+		{"RFC 7464 without RS", JSONSeqFraming(), []byte("{\"a\":1}\n")},
+		{"truncated varint record", LengthPrefixedFraming(VarintPrefix), []byte{10, 'a', 'b'}},
+		{"truncated uint32 prefix", LengthPrefixedFraming(Uint32Prefix), []byte{0, 0, 'a'}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := streamRecords(t, tt.data, StreamOptions{Framing: tt.framing}); err == nil {
+				t.Error("Expected stream to fail")
+			}
+		})
+	}
+}
+
+func TestStreamWithOptions_FramingCheckpoints(t *testing.T) {
+	var data []byte
+	var want []string
+	for i := range 3000 {
+		record := fmt.Sprintf(`{"id":%d,"payload":"%s"}`, i, bytes.Repeat([]byte("p"), i%50))
+		data = binary.AppendUvarint(data, uint64(len(record)))
+		data = append(data, record...)
+		want = append(want, record)
+	}
+	compressed := compressForTest(t, data, Gzip, gzip.DefaultCompression, 0)
+	framing := LengthPrefixedFraming(VarintPrefix)
+
+	var checkpoints []Checkpoint
+	records, offsets, err := streamRecords(t, compressed, StreamOptions{
+		Framing:            framing,
+		CheckpointInterval: 16 * 1024,
+		OnCheckpoint: func(cp Checkpoint) error {
+			checkpoints = append(checkpoints, cp)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if fmt.Sprint(records) != fmt.Sprint(want) {
+		t.Fatal("Records do not match")
+	}
+	if len(checkpoints) < 2 {
+		t.Fatalf("Expected several checkpoints, got %d", len(checkpoints))
+	}
+
+	cp := checkpoints[len(checkpoints)/2]
+	resumed, resumedOffsets, err := streamRecords(t, compressed, StreamOptions{Framing: framing, Checkpoint: &cp})
+	if err != nil {
+		t.Fatalf("Resume failed: %v", err)
+	}
+	first := len(records) - len(resumed)
+	if fmt.Sprint(resumed) != fmt.Sprint(want[first:]) || resumedOffsets[0] != offsets[first] || resumedOffsets[0] != cp.Offset {
+		t.Errorf("Resumed at record %d offset %d, checkpoint offset %d", first, resumedOffsets[0], cp.Offset)
+	}
+}
@@ -7,6 +7,7 @@ require (
 	github.com/aws/aws-sdk-go-v2/config v1.27.33
 	github.com/aws/aws-sdk-go-v2/service/s3 v1.80.2
 	github.com/dsnet/compress v0.0.1
+	github.com/klauspost/compress v1.18.0
 )
 
 require (
@@ -0,0 +1,665 @@
+package s3streamer
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// The checkpoint decoders need to know exactly where each compressed block starts and
+// what history it depends on, which compress/flate does not expose. gzipDecoder is a
+// small RFC 1951/1952 decoder that reports block boundaries and can restart at one.
+
+const (
+	// deflateWindowSize is the maximum distance a deflate back-reference can reach.
+	deflateWindowSize = 1 << 15
+	deflateWindowMask = deflateWindowSize - 1
+
+	// inflateBatchSize is how much output a single decoding step produces.
+	inflateBatchSize = 32 * 1024
+)
+
+var (
+	errDeflateCorrupt = errors.New("gzip: corrupt deflate stream")
+	errGzipHeader     = errors.New("gzip: invalid header")
+	errGzipChecksum   = errors.New("gzip: checksum mismatch")
+)
+
+var (
+	// Base lengths and extra bits for length symbols 257..285.
+	lengthBase  = [...]uint16{3, 4, 5, 6, 7, 8, 9, 10, 11, 13, 15, 17, 19, 23, 27, 31, 35, 43, 51, 59, 67, 83, 99, 115, 131, 163, 195, 227, 258}
+	lengthExtra = [...]uint8{0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2, 3, 3, 3, 3, 4, 4, 4, 4, 5, 5, 5, 5, 0}
+
+	// Base distances and extra bits for distance symbols 0..29.
+	distBase  = [...]uint16{1, 2, 3, 4, 5, 7, 9, 13, 17, 25, 33, 49, 65, 97, 129, 193, 257, 385, 513, 769, 1025, 1537, 2049, 3073, 4097, 6145, 8193, 12289, 16385, 24577}
+	distExtra = [...]uint8{0, 0, 0, 0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 6, 7, 7, 8, 8, 9, 9, 10, 10, 11, 11, 12, 12, 13, 13}
+
+	// Order in which code length code lengths are transmitted.
+	codeLengthOrder = [...]uint8{16, 17, 18, 0, 8, 7, 9, 6, 10, 5, 11, 4, 12, 3, 13, 2, 14, 1, 15}
+
+	fixedLiteralTable, fixedDistanceTable = newFixedHuffmanTables()
+)
+
+// lsbBitReader reads a deflate bit stream, least significant bit first, and counts
+// the bits consumed so that block boundaries can be located exactly.
+type lsbBitReader struct {
+	r        io.ByteReader
+	bits     uint64
+	nbits    uint
+	consumed int64 // Bits consumed since the reader started
+	err      error // Sticky error from the underlying reader
+}
+
+// refill tops up the bit buffer with whole bytes.
+func (br *lsbBitReader) refill() {
+	for br.nbits <= 56 && br.err == nil {
+		b, err := br.r.ReadByte()
+		if err != nil {
+			br.err = err
+			return
+		}
+		br.bits |= uint64(b) << br.nbits
+		br.nbits += 8
+	}
+}
+
+// readBits consumes n (at most 32) bits.
+func (br *lsbBitReader) readBits(n uint) (uint32, error) {
+	if br.nbits < n {
+		br.refill()
+		if br.nbits < n {
+			return 0, br.truncated()
+		}
+	}
+	v := uint32(br.bits & (1<<n - 1))
+	br.bits >>= n
+	br.nbits -= n
+	br.consumed += int64(n)
+	return v, nil
+}
+
+// alignToByte discards the remaining bits of the current byte.
+func (br *lsbBitReader) alignToByte() {
+	drop := br.nbits % 8
+	br.bits >>= drop
+	br.nbits -= drop
+	br.consumed += int64(drop)
+}
+
+// atEOF reports whether the input is exhausted at a byte boundary.
+func (br *lsbBitReader) atEOF() (bool, error) {
+	if br.nbits == 0 {
+		br.refill()
+	}
+	if br.nbits > 0 {
+		return false, nil
+	}
+	if br.err == io.EOF {
+		return true, nil
+	}
+	return false, br.err
+}
+
+// truncated converts the sticky read error into the error reported to callers.
+func (br *lsbBitReader) truncated() error {
+	if br.err == nil || br.err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return br.err
+}
+
+// huffmanTable decodes a canonical Huffman code with a single lookup indexed by the
+// next maxBits input bits. Each entry holds symbol<<4 | code length.
+type huffmanTable struct {
+	entries []uint16
+	maxBits uint
+}
+
+// init builds the table from per-symbol code lengths (0 means unused).
+func (h *huffmanTable) init(lengths []uint8) error {
+	var count [16]uint16
+	h.maxBits = 0
+	for _, l := range lengths {
+		count[l]++
+		if uint(l) > h.maxBits {
+			h.maxBits = uint(l)
+		}
+	}
+	count[0] = 0
+
+	// Reject over-subscribed codes; incomplete codes are allowed and fail on use
+	left := 1
+	for l := 1; l <= 15; l++ {
+		left = left<<1 - int(count[l])
+		if left < 0 {
+			return errDeflateCorrupt
+		}
+	}
+
+	var nextCode [16]uint16
+	code := uint16(0)
+	for l := 1; l <= 15; l++ {
+		code = (code + count[l-1]) << 1
+		nextCode[l] = code
+	}
+
+	size := 1 << h.maxBits
+	if cap(h.entries) >= size {
+		h.entries = h.entries[:size]
+		clear(h.entries)
+	} else {
+		h.entries = make([]uint16, size)
+	}
+
+	for sym, l := range lengths {
+		if l == 0 {
+			continue
+		}
+		c := nextCode[l]
+		nextCode[l]++
+
+		// Codes are packed starting with their most significant bit, so index the
+		// table by the bit-reversed code and fill every suffix combination
+		rev := uint(0)
+		for i := uint8(0); i < l; i++ {
+			rev = rev<<1 | uint(c>>i&1)
+		}
+		for i := rev; i < uint(size); i += 1 << l {
+			h.entries[i] = uint16(sym)<<4 | uint16(l)
+		}
+	}
+	return nil
+}
+
+// decode reads one symbol.
+func (h *huffmanTable) decode(br *lsbBitReader) (int, error) {
+	if br.nbits < h.maxBits {
+		br.refill()
+	}
+	entry := h.entries[br.bits&(1<<h.maxBits-1)]
+	n := uint(entry & 15)
+	if n == 0 {
+		if br.nbits < h.maxBits {
+			return 0, br.truncated()
+		}
+		return 0, errDeflateCorrupt
+	}
+	if n > br.nbits {
+		return 0, br.truncated()
+	}
+	br.bits >>= n
+	br.nbits -= n
+	br.consumed += int64(n)
+	return int(entry >> 4), nil
+}
+
+// newFixedHuffmanTables builds the tables for block type 1.
+func newFixedHuffmanTables() (*huffmanTable, *huffmanTable) {
+	var lengths [288]uint8
+	for i := range lengths {
+		switch {
+		case i < 144:
+			lengths[i] = 8
+		case i < 256:
+			lengths[i] = 9
+		case i < 280:
+			lengths[i] = 7
+		default:
+			lengths[i] = 8
+		}
+	}
+	lit := new(huffmanTable)
+	if err := lit.init(lengths[:]); err != nil {
+		panic(err)
+	}
+
+	var distLengths [30]uint8
+	for i := range distLengths {
+		distLengths[i] = 5
+	}
+	dist := new(huffmanTable)
+	if err := dist.init(distLengths[:]); err != nil {
+		panic(err)
+	}
+	return lit, dist
+}
+
+// gzip decoder states.
+const (
+	gzipStateHeader = iota
+	gzipStateBlockStart
+	gzipStateStored
+	gzipStateHuffman
+	gzipStateTrailer
+	gzipStateDone
+)
+
+// gzipDecoder decompresses a (possibly multi-member) gzip stream while recording
+// resumable positions at deflate block boundaries.
+type gzipDecoder struct {
+	br        lsbBitReader
+	startBits int64 // Absolute bit position in the object where br started
+	state     int
+	final     bool // Current block is the last one of its member
+	stored    int  // Bytes remaining in the current stored block
+	lit, dist *huffmanTable
+	dynLit    huffmanTable
+	dynDist   huffmanTable
+
+	hist    [deflateWindowSize]byte
+	histPos int64 // Total bytes written to hist
+	histLen int   // Bytes of hist that hold valid history
+
+	out      []byte
+	outPos   int
+	produced int64 // Decompressed offset of the next byte produced
+
+	crc        uint32
+	memberSize uint32
+	verify     bool // False while finishing a member that was resumed mid-way
+	members    int
+
+	snapshots snapshotQueue
+	err       error
+}
+
+// newGzipDecoder starts decoding r, which must be positioned at the first byte of a gzip
+// member, or at the position described by cp if cp is not nil.
+func newGzipDecoder(r io.ByteReader, start int64, cp *Checkpoint, interval int64) (*gzipDecoder, error) {
+	d := &gzipDecoder{
+		br:        lsbBitReader{r: r},
+		startBits: start * 8,
+		state:     gzipStateHeader,
+		verify:    true,
+		out:       make([]byte, 0, inflateBatchSize+258),
+	}
+	d.snapshots.init(interval, 0)
+
+	if cp == nil {
+		return d, nil
+	}
+
+	d.produced = cp.BlockOffset
+	d.snapshots.init(interval, cp.BlockOffset)
+	if cp.MemberStart {
+		return d, nil
+	}
+
+	// Restart at a deflate block inside a member whose header was already read
+	if _, err := d.br.readBits(uint(cp.BitOffset)); err != nil {
+		return nil, fmt.Errorf("failed to seek to checkpoint: %w", err)
+	}
+	d.histLen = copy(d.hist[:], cp.Window)
+	d.histPos = int64(d.histLen)
+	d.verify = false
+	d.members = 1
+	d.state = gzipStateBlockStart
+	return d, nil
+}
+
+// Read implements io.Reader.
+func (d *gzipDecoder) Read(p []byte) (int, error) {
+	for d.outPos == len(d.out) {
+		if d.err != nil {
+			return 0, d.err
+		}
+		d.out = d.out[:0]
+		d.outPos = 0
+		d.err = d.step()
+		if len(d.out) > 0 {
+			d.crc = crc32.Update(d.crc, crc32.IEEETable, d.out)
+			d.memberSize += uint32(len(d.out))
+			d.produced += int64(len(d.out))
+		}
+	}
+	n := copy(p, d.out[d.outPos:])
+	d.outPos += n
+	return n, nil
+}
+
+// checkpoint implements checkpointReader.
+func (d *gzipDecoder) checkpoint(offset int64) (Checkpoint, bool) {
+	return d.snapshots.latest(offset)
+}
+
+// bitPosition returns the absolute bit position of the next unread bit.
+func (d *gzipDecoder) bitPosition() int64 {
+	return d.startBits + d.br.consumed
+}
+
+// step decodes until a batch of output is ready, a block ends or an error occurs.
+func (d *gzipDecoder) step() error {
+	switch d.state {
+	case gzipStateHeader:
+		return d.readHeader()
+	case gzipStateBlockStart:
+		return d.readBlockHeader()
+	case gzipStateStored:
+		return d.copyStored()
+	case gzipStateHuffman:
+		return d.inflateHuffman()
+	case gzipStateTrailer:
+		return d.readTrailer()
+	default:
+		return io.EOF
+	}
+}
+
+// readHeader parses a gzip member header (RFC 1952).
+func (d *gzipDecoder) readHeader() error {
+	if d.members > 0 {
+		eof, err := d.br.atEOF()
+		if err != nil {
+			return err
+		}
+		if eof {
+			d.state = gzipStateDone
+			return io.EOF
+		}
+	}
+
+	pos := d.bitPosition()
+	if d.snapshots.due(d.produced) {
+		d.snapshots.add(Checkpoint{
+			Compression:      Gzip,
+			CompressedOffset: pos / 8,
+			BlockOffset:      d.produced,
+			MemberStart:      true,
+		})
+	}
+
+	var hdr [10]byte
+	for i := range hdr {
+		b, err := d.br.readBits(8)
+		if err != nil {
+			return err
+		}
+		hdr[i] = byte(b)
+	}
+	if hdr[0] != 0x1f || hdr[1] != 0x8b || hdr[2] != 8 {
+		return errGzipHeader
+	}
+
+	flags := hdr[3]
+	if flags&0x04 != 0 { // FEXTRA
+		n, err := d.br.readBits(16)
+		if err != nil {
+			return err
+		}
+		if err := d.skipBytes(int(n)); err != nil {
+			return err
+		}
+	}
+	for _, flag := range []byte{0x08, 0x10} { // FNAME, FCOMMENT
+		if flags&flag == 0 {
+			continue
+		}
+		for {
+			b, err := d.br.readBits(8)
+			if err != nil {
+				return err
+			}
+			if b == 0 {
+				break
+			}
+		}
+	}
+	if flags&0x02 != 0 { // FHCRC
+		if err := d.skipBytes(2); err != nil {
+			return err
+		}
+	}
+
+	d.crc = 0
+	d.memberSize = 0
+	d.verify = true
+	d.histLen = 0
+	d.members++
+	d.state = gzipStateBlockStart
+	return nil
+}
+
+// skipBytes discards n byte-aligned bytes.
+func (d *gzipDecoder) skipBytes(n int) error {
+	for i := 0; i < n; i++ {
+		if _, err := d.br.readBits(8); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readBlockHeader records a resumable position and prepares the next block.
+func (d *gzipDecoder) readBlockHeader() error {
+	if d.snapshots.due(d.produced) {
+		pos := d.bitPosition()
+		d.snapshots.add(Checkpoint{
+			Compression:      Gzip,
+			CompressedOffset: pos / 8,
+			BitOffset:        uint8(pos % 8),
+			Window:           d.window(),
+			BlockOffset:      d.produced,
+		})
+	}
+
+	hdr, err := d.br.readBits(3)
+	if err != nil {
+		return err
+	}
+	d.final = hdr&1 == 1
+
+	switch hdr >> 1 {
+	case 0:
+		d.br.alignToByte()
+		lens, err := d.br.readBits(32)
+		if err != nil {
+			return err
+		}
+		if uint16(lens) != ^uint16(lens>>16) {
+			return errDeflateCorrupt
+		}
+		d.stored = int(uint16(lens))
+		d.state = gzipStateStored
+	case 1:
+		d.lit, d.dist = fixedLiteralTable, fixedDistanceTable
+		d.state = gzipStateHuffman
+	case 2:
+		if err := d.readDynamicTables(); err != nil {
+			return err
+		}
+		d.lit, d.dist = &d.dynLit, &d.dynDist
+		d.state = gzipStateHuffman
+	default:
+		return errDeflateCorrupt
+	}
+	return nil
+}
+
+// readDynamicTables reads the code length codes and builds the block's tables.
+func (d *gzipDecoder) readDynamicTables() error {
+	counts, err := d.br.readBits(14)
+	if err != nil {
+		return err
+	}
+	nlit := int(counts&0x1f) + 257
+	ndist := int(counts>>5&0x1f) + 1
+	nclen := int(counts>>10) + 4
+	if nlit > 286 || ndist > 30 {
+		return errDeflateCorrupt
+	}
+
+	var clens [19]uint8
+	for i := 0; i < nclen; i++ {
+		v, err := d.br.readBits(3)
+		if err != nil {
+			return err
+		}
+		clens[codeLengthOrder[i]] = uint8(v)
+	}
+	var clTable huffmanTable
+	if err := clTable.init(clens[:]); err != nil {
+		return err
+	}
+
+	var lengths [286 + 30]uint8
+	for i := 0; i < nlit+ndist; {
+		sym, err := clTable.decode(&d.br)
+		if err != nil {
+			return err
+		}
+		if sym < 16 {
+			lengths[i] = uint8(sym)
+			i++
+			continue
+		}
+
+		var repeat uint32
+		var value uint8
+		switch sym {
+		case 16:
+			if i == 0 {
+				return errDeflateCorrupt
+			}
+			value = lengths[i-1]
+			repeat, err = d.br.readBits(2)
+			repeat += 3
+		case 17:
+			repeat, err = d.br.readBits(3)
+			repeat += 3
+		default:
+			repeat, err = d.br.readBits(7)
+			repeat += 11
+		}
+		if err != nil {
+			return err
+		}
+		if i+int(repeat) > nlit+ndist {
+			return errDeflateCorrupt
+		}
+		for ; repeat > 0; repeat-- {
+			lengths[i] = value
+			i++
+		}
+	}
+
+	if lengths[256] == 0 {
+		return errDeflateCorrupt // The block could never end
+	}
+	if err := d.dynLit.init(lengths[:nlit]); err != nil {
+		return err
+	}
+	return d.dynDist.init(lengths[nlit : nlit+ndist])
+}
+
+// copyStored copies bytes from a stored block.
+func (d *gzipDecoder) copyStored() error {
+	for d.stored > 0 && len(d.out) < inflateBatchSize {
+		b, err := d.br.readBits(8)
+		if err != nil {
+			return err
+		}
+		d.emit(byte(b))
+		d.stored--
+	}
+	if d.stored == 0 {
+		d.endBlock()
+	}
+	return nil
+}
+
+// inflateHuffman decodes literal/length and distance symbols.
+func (d *gzipDecoder) inflateHuffman() error {
+	for len(d.out) < inflateBatchSize {
+		sym, err := d.lit.decode(&d.br)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case sym < 256:
+			d.emit(byte(sym))
+			continue
+		case sym == 256:
+			d.endBlock()
+			return nil
+		case sym > 285:
+			return errDeflateCorrupt
+		}
+
+		sym -= 257
+		extra, err := d.br.readBits(uint(lengthExtra[sym]))
+		if err != nil {
+			return err
+		}
+		length := int(lengthBase[sym]) + int(extra)
+
+		dsym, err := d.dist.decode(&d.br)
+		if err != nil {
+			return err
+		}
+		if dsym >= len(distBase) {
+			return errDeflateCorrupt
+		}
+		extra, err = d.br.readBits(uint(distExtra[dsym]))
+		if err != nil {
+			return err
+		}
+		distance := int(distBase[dsym]) + int(extra)
+		if distance > d.histLen {
+			return errDeflateCorrupt
+		}
+
+		for i := 0; i < length; i++ {
+			d.emit(d.hist[(d.histPos-int64(distance))&deflateWindowMask])
+		}
+	}
+	return nil
+}
+
+// emit appends one decompressed byte to the output and the history window.
+func (d *gzipDecoder) emit(b byte) {
+	d.hist[d.histPos&deflateWindowMask] = b
+	d.histPos++
+	if d.histLen < deflateWindowSize {
+		d.histLen++
+	}
+	d.out = append(d.out, b)
+}
+
+// window returns a copy of the valid history in output order.
+func (d *gzipDecoder) window() []byte {
+	w := make([]byte, d.histLen)
+	start := d.histPos - int64(d.histLen)
+	for i := range w {
+		w[i] = d.hist[(start+int64(i))&deflateWindowMask]
+	}
+	return w
+}
+
+// endBlock moves to the next block or, after the final block, to the trailer.
+func (d *gzipDecoder) endBlock() {
+	if d.final {
+		d.state = gzipStateTrailer
+	} else {
+		d.state = gzipStateBlockStart
+	}
+}
+
+// readTrailer checks the member's CRC-32 and size.
+func (d *gzipDecoder) readTrailer() error {
+	d.br.alignToByte()
+	crc, err := d.br.readBits(32)
+	if err != nil {
+		return err
+	}
+	size, err := d.br.readBits(32)
+	if err != nil {
+		return err
+	}
+	if d.verify && (crc != d.crc || size != d.memberSize) {
+		return errGzipChecksum
+	}
+	d.state = gzipStateHeader
+	return nil
+}
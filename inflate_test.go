@@ -0,0 +1,208 @@
+package s3streamer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/dsnet/compress/bzip2"
+)
+
+// checkpointTestLines returns count JSON lines mixing repetitive and random content, so
+// that compressors emit many blocks of every kind.
+func checkpointTestLines(count int) []byte {
+	rng := rand.New(rand.NewPCG(1, 2))
+	var buf bytes.Buffer
+	for i := 0; i < count; i++ {
+		payload := make([]byte, rng.IntN(200))
+		for j := range payload {
+			payload[j] = "abcdefghijklmnopqrstuvwxyz0123456789"[rng.IntN(36)]
+		}
+		fmt.Fprintf(&buf, `{"id":%d,"kind":"event","payload":"%s"}`+"\n", i, payload)
+	}
+	return buf.Bytes()
+}
+
+// compressForTest compresses data, writing a new gzip member or bzip2 stream every
+// split bytes if split is positive.
+func compressForTest(t testing.TB, data []byte, compression Compression, level, split int) []byte {
+	t.Helper()
+	if split <= 0 {
+		split = len(data)
+	}
+
+	var out bytes.Buffer
+	for len(data) > 0 {
+		n := min(int64(split), int64(len(data)))
+		var w io.WriteCloser
+		var err error
+		switch compression {
+		case Gzip:
+			w, err = gzip.NewWriterLevel(&out, level)
+		case Bzip2:
+			w, err = bzip2.NewWriter(&out, &bzip2.WriterConfig{Level: level})
+		default:
+			t.Fatalf("Unsupported compression type: %v", compression)
+		}
+		if err != nil {
+			t.Fatalf("Failed to create writer: %v", err)
+		}
+		if _, err := w.Write(data[:n]); err != nil {
+			t.Fatalf("Failed to compress: %v", err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Failed to close writer: %v", err)
+		}
+		data = data[n:]
+	}
+	return out.Bytes()
+}
+
+func TestGzipDecoderMatchesInput(t *testing.T) {
+	random := make([]byte, 100*1024)
+	rng := rand.New(rand.NewPCG(3, 4))
+	for i := range random {
+		random[i] = byte(rng.Uint32())
+	}
+	lines := checkpointTestLines(3000)
+
+	tests := []struct {
+		name  string
+		data  []byte
+		level int
+		split int
+	}{
+		{"default", lines, gzip.DefaultCompression, 0},
+		{"best speed", lines, gzip.BestSpeed, 0},
+		{"best compression", lines, gzip.BestCompression, 0},
+		{"huffman only", lines, gzip.HuffmanOnly, 0},
+		{"stored", lines, gzip.NoCompression, 0},
+		{"random", random, gzip.DefaultCompression, 0},
+		{"multi member", lines, gzip.DefaultCompression, 50 * 1024},
+		{"empty", nil, gzip.DefaultCompression, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var compressed []byte
+			if len(tt.data) == 0 {
+				var buf bytes.Buffer
+				gw := gzip.NewWriter(&buf)
+				gw.Close()
+				compressed = buf.Bytes()
+			} else {
+				compressed = compressForTest(t, tt.data, Gzip, tt.level, tt.split)
+			}
+
+			d, err := newGzipDecoder(bytes.NewReader(compressed), 0, nil, 0)
+			if err != nil {
+				t.Fatalf("Failed to create decoder: %v", err)
+			}
+			got, err := io.ReadAll(d)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !bytes.Equal(got, tt.data) {
+				t.Fatalf("Decoded %d bytes that differ from the %d input bytes", len(got), len(tt.data))
+			}
+		})
+	}
+}
+
+func TestGzipDecoderHeaderFields(t *testing.T) {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	gw.Name = "data.json"
+	gw.Comment = "exported"
+	gw.Extra = []byte("extra field")
+	gw.Write([]byte("hello\nworld\n"))
+	gw.Close()
+
+	d, _ := newGzipDecoder(bytes.NewReader(buf.Bytes()), 0, nil, 0)
+	got, err := io.ReadAll(d)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(got) != "hello\nworld\n" {
+		t.Errorf("Decoded %q", got)
+	}
+}
+
+func TestGzipDecoderDetectsCorruption(t *testing.T) {
+	compressed := compressForTest(t, checkpointTestLines(100), Gzip, gzip.DefaultCompression, 0)
+
+	t.Run("checksum", func(t *testing.T) {
+		corrupt := bytes.Clone(compressed)
+		corrupt[len(corrupt)-8] ^= 0xff
+		d, _ := newGzipDecoder(bytes.NewReader(corrupt), 0, nil, 0)
+		if _, err := io.ReadAll(d); !errors.Is(err, errGzipChecksum) {
+			t.Errorf("Expected checksum error, got %v", err)
+		}
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		d, _ := newGzipDecoder(bytes.NewReader(compressed[:len(compressed)/2]), 0, nil, 0)
+		if _, err := io.ReadAll(d); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("Expected unexpected EOF, got %v", err)
+		}
+	})
+
+	t.Run("trailing garbage", func(t *testing.T) {
+		d, _ := newGzipDecoder(bytes.NewReader(append(bytes.Clone(compressed), "garbage"...)), 0, nil, 0)
+		if _, err := io.ReadAll(d); err == nil {
+			t.Error("Expected error for trailing garbage")
+		}
+	})
+}
+
+func TestBzip2DecoderMatchesInput(t *testing.T) {
+	lines := checkpointTestLines(3000)
+
+	tests := []struct {
+		name  string
+		level int
+		split int
+	}{
+		{"single stream", bzip2.BestSpeed, 0},
+		{"large blocks", bzip2.BestCompression, 0},
+		{"multi stream", bzip2.BestSpeed, 150 * 1024},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compressed := compressForTest(t, lines, Bzip2, tt.level, tt.split)
+
+			d, err := newBzip2Decoder(bytes.NewReader(compressed), 0, nil, 0)
+			if err != nil {
+				t.Fatalf("Failed to create decoder: %v", err)
+			}
+			got, err := io.ReadAll(d)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !bytes.Equal(got, lines) {
+				t.Fatalf("Decoded %d bytes that differ from the %d input bytes", len(got), len(lines))
+			}
+		})
+	}
+}
+
+func TestBzip2DecoderDetectsCorruption(t *testing.T) {
+	compressed := compressForTest(t, checkpointTestLines(1000), Bzip2, bzip2.BestSpeed, 0)
+
+	corrupt := bytes.Clone(compressed)
+	corrupt[len(corrupt)/2] ^= 0xff
+	d, _ := newBzip2Decoder(bytes.NewReader(corrupt), 0, nil, 0)
+	if _, err := io.ReadAll(d); err == nil {
+		t.Error("Expected error for corrupt block")
+	}
+
+	d, _ = newBzip2Decoder(bytes.NewReader(compressed[:len(compressed)-20]), 0, nil, 0)
+	if _, err := io.ReadAll(d); err == nil {
+		t.Error("Expected error for truncated stream")
+	}
+}
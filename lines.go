@@ -0,0 +1,64 @@
+package s3streamer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+)
+
+// Line is a line read by S3Streamer.Lines.
+type Line struct {
+	// Data is the line without its newline. It is only valid until the next iteration;
+	// copy it to keep it.
+	Data []byte
+	// Offset is the position of the line in the decompressed stream.
+	Offset int64
+	// Number is the 1-based line number, counted from the start of the stream or
+	// checkpoint.
+	Number int64
+	// Partial is set on every fragment of a record but the last, when the record is
+	// delivered in fragments by FragmentOversizeRecords.
+	Partial bool
+	// CompressedPosition is the number of object bytes the decoder had consumed when
+	// the line was read. For uncompressed objects it equals Offset; for compressed and
+	// encrypted ones it lies at or past the end of the line's stored bytes, which makes
+	// it a measure of progress through the object. Resume with checkpoints instead.
+	CompressedPosition int64
+}
+
+// errStopLines stops the stream when the consumer of Lines breaks out of its loop.
+var errStopLines = errors.New("lines iteration stopped")
+
+// Lines returns an iterator over the lines of the object at bucket/key, read as
+// StreamWithOptions would. An error ends the iteration as a final pair with a zero
+// Line. Breaking out of the loop stops the download and releases its resources
+// before the loop exits. Each range over the iterator streams the object again.
+// Example:
+//
+//	for line, err := range streamer.Lines(ctx, "my-bucket", "data.json.gz", s3streamer.StreamOptions{}) {
+//	    if err != nil {
+//	        return err
+//	    }
+//	    if bytes.Contains(line.Data, []byte(`"type":"error"`)) {
+//	        fmt.Printf("first error on line %d at offset %d\n", line.Number, line.Offset)
+//	        break
+//	    }
+//	}
+func (s *S3Streamer) Lines(ctx context.Context, bucket, key string, opts StreamOptions) iter.Seq2[Line, error] {
+	return func(yield func(Line, error) bool) {
+		if opts.Workers > 1 {
+			yield(Line{}, fmt.Errorf("Lines does not support multiple workers"))
+			return
+		}
+		err := s.streamLines(ctx, bucket, key, opts, func(line Line) error {
+			if !yield(line, nil) {
+				return errStopLines
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, errStopLines) {
+			yield(Line{}, err)
+		}
+	}
+}
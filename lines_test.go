@@ -0,0 +1,114 @@
+package s3streamer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// countingGetClient counts GetObject requests.
+type countingGetClient struct {
+	*MockS3Client
+	gets atomic.Int64
+}
+
+func (c *countingGetClient) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	c.gets.Add(1)
+	return c.MockS3Client.GetObject(ctx, params, optFns...)
+}
+
+func TestS3Streamer_Lines(t *testing.T) {
+	lines := checkpointTestLines(2000)
+
+	tests := []struct {
+		name       string
+		data       []byte
+		compressed bool
+	}{
+		{"uncompressed", lines, false},
+		{"gzip", compressForTest(t, lines, Gzip, gzip.DefaultCompression, 0), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			streamer := NewS3Streamer(NewMockS3Client(tt.data))
+			streamer.chunkSize = 4096
+
+			var got bytes.Buffer
+			var n, lastPosition int64
+			for line, err := range streamer.Lines(context.Background(), "test-bucket", "test-key", StreamOptions{}) {
+				if err != nil {
+					t.Fatalf("Lines failed: %v", err)
+				}
+				n++
+				if line.Number != n || line.Offset != int64(got.Len()) {
+					t.Fatalf("Line %d: number %d, offset %d, want offset %d", n, line.Number, line.Offset, got.Len())
+				}
+				if !tt.compressed && line.CompressedPosition != line.Offset {
+					t.Errorf("Line %d: compressed position %d, want %d", n, line.CompressedPosition, line.Offset)
+				}
+				if tt.compressed && (line.CompressedPosition < lastPosition || line.CompressedPosition > int64(len(tt.data))) {
+					t.Errorf("Line %d: compressed position %d after %d", n, line.CompressedPosition, lastPosition)
+				}
+				lastPosition = line.CompressedPosition
+				got.Write(line.Data)
+				got.WriteByte('\n')
+			}
+			if !bytes.Equal(got.Bytes(), lines) {
+				t.Errorf("Iterated %d lines that do not match the object", n)
+			}
+		})
+	}
+}
+
+func TestS3Streamer_LinesBreak(t *testing.T) {
+	lines := checkpointTestLines(20000)
+	client := &countingGetClient{MockS3Client: NewMockS3Client(lines)}
+	streamer := NewS3Streamer(client, WithReadConcurrency(4))
+	streamer.chunkSize = 1024
+
+	var n int
+	for _, err := range streamer.Lines(context.Background(), "test-bucket", "test-key", StreamOptions{}) {
+		if err != nil {
+			t.Fatalf("Lines failed: %v", err)
+		}
+		if n++; n == 3 {
+			break
+		}
+	}
+	// The download stops with the loop instead of reading the whole object
+	gets := client.gets.Load()
+	if total := int64(len(lines)) / 1024; gets >= total {
+		t.Errorf("Made %d range requests after breaking, the whole object is %d chunks", gets, total)
+	}
+	if after := client.gets.Load(); after != gets {
+		t.Errorf("Range requests continued after the loop exited: %d then %d", gets, after)
+	}
+}
+
+func TestS3Streamer_LinesError(t *testing.T) {
+	streamer := NewS3Streamer(NewMockS3Client(checkpointTestLines(100)))
+	errFail := fmt.Errorf("checkpoint store unavailable")
+
+	var errs, lines int
+	for line, err := range streamer.Lines(context.Background(), "test-bucket", "test-key", StreamOptions{
+		CheckpointInterval: 1,
+		OnCheckpoint:       func(Checkpoint) error { return errFail },
+	}) {
+		if err != nil {
+			errs++
+			if line.Data != nil {
+				t.Error("Error paired with a line")
+			}
+			continue
+		}
+		lines++
+	}
+	if errs != 1 || lines != 1 {
+		t.Errorf("Got %d lines and %d errors, want 1 of each", lines, errs)
+	}
+}
@@ -0,0 +1,343 @@
+package s3streamer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// maxManifestSize bounds the manifest.json of an inventory report, which lists one
+// entry per inventory file.
+const maxManifestSize = 64 * 1024 * 1024
+
+// ManifestObject is an object listed by a manifest.
+type ManifestObject struct {
+	Bucket string
+	Key    string
+	// VersionID is the version to read, or empty for the current version.
+	VersionID string
+	// Size is the object size, or 0 when the manifest does not record it.
+	Size int64
+}
+
+// String returns the object as an s3:// URI.
+func (o ManifestObject) String() string {
+	return "s3://" + o.Bucket + "/" + o.Key
+}
+
+// errStopObjects stops reading a manifest when the consumer stops iterating.
+var errStopObjects = errors.New("manifest iteration stopped")
+
+// ParseS3URI parses an s3://bucket/key URI. The key is taken literally, without
+// unescaping.
+func ParseS3URI(uri string) (ManifestObject, error) {
+	rest, ok := strings.CutPrefix(uri, "s3://")
+	if !ok {
+		return ManifestObject{}, fmt.Errorf("invalid S3 URI %q: missing s3:// scheme", uri)
+	}
+	bucket, key, _ := strings.Cut(rest, "/")
+	if bucket == "" || key == "" {
+		return ManifestObject{}, fmt.Errorf("invalid S3 URI %q: missing bucket or key", uri)
+	}
+	return ManifestObject{Bucket: bucket, Key: key}, nil
+}
+
+// ParseURIList returns an iterator over a newline-separated list of s3:// URIs. Blank
+// lines and lines starting with # are ignored. A malformed line ends the iteration
+// with an error naming its line number.
+// Example:
+//
+//	f, err := os.Open("objects.txt")
+//	if err != nil {
+//	    return err
+//	}
+//	defer f.Close()
+//	err = streamer.StreamManifest(ctx, s3streamer.ParseURIList(f), s3streamer.ManifestOptions{}, processLine)
+func ParseURIList(r io.Reader) iter.Seq2[ManifestObject, error] {
+	return func(yield func(ManifestObject, error) bool) {
+		scanner := bufio.NewScanner(r)
+		var lineNum int
+		for scanner.Scan() {
+			lineNum++
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			object, err := ParseS3URI(line)
+			if err != nil {
+				yield(ManifestObject{}, fmt.Errorf("line %d: %w", lineNum, err))
+				return
+			}
+			if !yield(object, nil) {
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			yield(ManifestObject{}, fmt.Errorf("failed to read URI list: %w", err))
+		}
+	}
+}
+
+// inventoryManifest is the manifest.json of an S3 Inventory report.
+type inventoryManifest struct {
+	DestinationBucket string `json:"destinationBucket"`
+	FileFormat        string `json:"fileFormat"`
+	FileSchema        string `json:"fileSchema"`
+	Files             []struct {
+		Key string `json:"key"`
+	} `json:"files"`
+}
+
+// inventoryColumns holds the positions of the inventory fields StreamManifest needs;
+// optional fields are -1 when the report does not include them.
+type inventoryColumns struct {
+	bucket, key, versionID, deleteMarker, size int
+}
+
+// parseInventorySchema locates the columns in a manifest's fileSchema, such as
+// "Bucket, Key, VersionId, IsLatest, IsDeleteMarker, Size".
+func parseInventorySchema(schema string) (inventoryColumns, error) {
+	cols := inventoryColumns{-1, -1, -1, -1, -1}
+	for i, field := range strings.Split(schema, ",") {
+		switch strings.TrimSpace(field) {
+		case "Bucket":
+			cols.bucket = i
+		case "Key":
+			cols.key = i
+		case "VersionId":
+			cols.versionID = i
+		case "IsDeleteMarker":
+			cols.deleteMarker = i
+		case "Size":
+			cols.size = i
+		}
+	}
+	if cols.bucket < 0 || cols.key < 0 {
+		return cols, fmt.Errorf("inventory schema %q has no Bucket and Key fields", schema)
+	}
+	return cols, nil
+}
+
+// object converts an inventory row. It returns false for rows that hold no data to
+// stream: delete markers and empty objects.
+func (cols inventoryColumns) object(record []string) (ManifestObject, bool, error) {
+	field := func(i int) string {
+		if i < 0 || i >= len(record) {
+			return ""
+		}
+		return record[i]
+	}
+	if field(cols.deleteMarker) == "true" {
+		return ManifestObject{}, false, nil
+	}
+
+	// Inventory reports URL-encode keys
+	key, err := url.QueryUnescape(field(cols.key))
+	if err != nil {
+		return ManifestObject{}, false, fmt.Errorf("invalid key %q: %w", field(cols.key), err)
+	}
+	object := ManifestObject{Bucket: field(cols.bucket), Key: key, VersionID: field(cols.versionID)}
+	if size := field(cols.size); size != "" {
+		object.Size, err = strconv.ParseInt(size, 10, 64)
+		if err != nil {
+			return ManifestObject{}, false, fmt.Errorf("invalid size %q for key %q: %w", size, key, err)
+		}
+		if object.Size == 0 {
+			return ManifestObject{}, false, nil
+		}
+	}
+	if object.Bucket == "" || object.Key == "" {
+		return ManifestObject{}, false, fmt.Errorf("inventory row %q has no bucket or key", record)
+	}
+	return object, true, nil
+}
+
+// InventoryObjects returns an iterator over the objects listed by the S3 Inventory
+// report whose manifest.json is at bucket/key. Only CSV reports are supported. The
+// gzipped CSV files are streamed one after another with this streamer's options, so
+// reports of any size use constant memory. S3 writes reports itself, so they are read
+// without the streamer's SSE-C key and client-side decryption. Delete markers and empty objects are
+// skipped; in reports that include all versions, every version is listed.
+// Example:
+//
+//	objects := streamer.InventoryObjects(ctx, "inventory-bucket", "my-bucket/daily/2024-01-01T01-00Z/manifest.json")
+//	err := streamer.StreamManifest(ctx, objects, s3streamer.ManifestOptions{Concurrency: 8}, processLine)
+func (s *S3Streamer) InventoryObjects(ctx context.Context, bucket, key string) iter.Seq2[ManifestObject, error] {
+	return func(yield func(ManifestObject, error) bool) {
+		manifest, err := s.readInventoryManifest(ctx, bucket, key)
+		if err != nil {
+			yield(ManifestObject{}, err)
+			return
+		}
+		cols, err := parseInventorySchema(manifest.FileSchema)
+		if err != nil {
+			yield(ManifestObject{}, fmt.Errorf("invalid inventory manifest s3://%s/%s: %w", bucket, key, err))
+			return
+		}
+
+		// Inventory files are written next to the manifest
+		reports := &S3Streamer{client: s.client, chunkSize: s.chunkSize, opts: withoutObjectEncryption(s.opts)}
+		fileBucket := strings.TrimPrefix(manifest.DestinationBucket, "arn:aws:s3:::")
+		if fileBucket == "" {
+			fileBucket = bucket
+		}
+		for _, file := range manifest.Files {
+			err := reports.StreamWithOptions(ctx, fileBucket, file.Key, StreamOptions{}, func(line []byte, offset int64) error {
+				if len(bytes.TrimSpace(line)) == 0 {
+					return nil
+				}
+				record, err := csv.NewReader(bytes.NewReader(line)).Read()
+				if err != nil {
+					return fmt.Errorf("invalid inventory row at offset %d: %w", offset, err)
+				}
+				object, ok, err := cols.object(record)
+				if err != nil {
+					return fmt.Errorf("invalid inventory row at offset %d: %w", offset, err)
+				}
+				if ok && !yield(object, nil) {
+					return errStopObjects
+				}
+				return nil
+			})
+			if errors.Is(err, errStopObjects) {
+				return
+			}
+			if err != nil {
+				yield(ManifestObject{}, fmt.Errorf("failed to read inventory file s3://%s/%s: %w", fileBucket, file.Key, err))
+				return
+			}
+		}
+	}
+}
+
+// readInventoryManifest downloads and validates an inventory manifest.json.
+func (s *S3Streamer) readInventoryManifest(ctx context.Context, bucket, key string) (*inventoryManifest, error) {
+	resp, err := s.client.GetObject(ctx, &s3.GetObjectInput{Bucket: &bucket, Key: &key})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get inventory manifest s3://%s/%s: %w", bucket, key, err)
+	}
+	defer resp.Body.Close()
+
+	var manifest inventoryManifest
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxManifestSize)).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("failed to decode inventory manifest s3://%s/%s: %w", bucket, key, err)
+	}
+	if !strings.EqualFold(manifest.FileFormat, "CSV") {
+		return nil, fmt.Errorf("unsupported inventory format %q in s3://%s/%s: only CSV is supported", manifest.FileFormat, bucket, key)
+	}
+	return &manifest, nil
+}
+
+// ManifestOptions configures StreamManifest.
+// Example:
+//
+//	opts := s3streamer.ManifestOptions{
+//	    Concurrency:       8,
+//	    SkipFailedObjects: true,
+//	    OnObject: func(r s3streamer.ObjectResult) error {
+//	        if r.Err != nil {
+//	            log.Printf("skipped %s: %v", r.Object, r.Err)
+//	        }
+//	        return nil
+//	    },
+//	}
+type ManifestOptions struct {
+	// Concurrency is the number of objects streamed at once, as in PrefixOptions.
+	// Defaults to streaming one object at a time in manifest order.
+	Concurrency int
+	// SkipFailedObjects reports objects that fail, for example because they were
+	// deleted after the manifest was written, to OnObject and moves on to the next
+	// one instead of stopping the stream. Errors returned by fn count as failures of
+	// the object too. Errors from reading the manifest itself always stop the stream.
+	SkipFailedObjects bool
+	// OnObject is called once for every object when it has been streamed or has
+	// failed. Calls are serialized. Returning an error stops the stream.
+	OnObject func(ObjectResult) error
+	// Stream configures how every object is read, with the restrictions of
+	// PrefixOptions.Stream.
+	Stream StreamOptions
+}
+
+// ObjectResult reports the outcome of one object of a StreamManifest call.
+type ObjectResult struct {
+	Object ManifestObject
+	// Index is the position of the object in the manifest, counted from 0.
+	Index int64
+	// Lines is the number of lines passed to fn.
+	Lines int64
+	// Err is the reason the object failed, or nil if it was streamed completely.
+	Err error
+}
+
+// indexedObject is a manifest object with its position in the manifest.
+type indexedObject struct {
+	ManifestObject
+	index int64
+}
+
+// StreamManifest streams every object listed by objects, such as InventoryObjects or
+// ParseURIList, passing fn each line with the object it came from and its offset within
+// that object. The first error stops the stream unless SkipFailedObjects is set.
+// Example:
+//
+//	err := streamer.StreamManifest(ctx, streamer.InventoryObjects(ctx, bucket, manifestKey), s3streamer.ManifestOptions{
+//	    Concurrency: 8,
+//	    OnObject: func(r s3streamer.ObjectResult) error {
+//	        log.Printf("object %d: %s, %d lines", r.Index, r.Object, r.Lines)
+//	        return nil
+//	    },
+//	}, func(object s3streamer.ManifestObject, line []byte, offset int64) error {
+//	    return process(object.Key, line)
+//	})
+func (s *S3Streamer) StreamManifest(ctx context.Context, objects iter.Seq2[ManifestObject, error], opts ManifestOptions, fn func(object ManifestObject, line []byte, offset int64) error) error {
+	if err := opts.Stream.validateShared(); err != nil {
+		return err
+	}
+
+	indexed := func(yield func(indexedObject, error) bool) {
+		var index int64
+		for object, err := range objects {
+			if !yield(indexedObject{object, index}, err) {
+				return
+			}
+			index++
+		}
+	}
+
+	var mu sync.Mutex // Serializes OnObject
+	return forEachObject(ctx, indexed, opts.Concurrency, func(ctx context.Context, object indexedObject) error {
+		var lines atomic.Int64 // fn may run on several workers
+		streamOpts := opts.Stream
+		streamOpts.VersionID = object.VersionID
+		err := s.StreamWithOptions(ctx, object.Bucket, object.Key, streamOpts, func(line []byte, offset int64) error {
+			lines.Add(1)
+			return fn(object.ManifestObject, line, offset)
+		})
+
+		if opts.OnObject != nil {
+			mu.Lock()
+			cbErr := opts.OnObject(ObjectResult{Object: object.ManifestObject, Index: object.index, Lines: lines.Load(), Err: err})
+			mu.Unlock()
+			if cbErr != nil {
+				return fmt.Errorf("object callback failed for %s: %w", object, cbErr)
+			}
+		}
+		if err != nil && (!opts.SkipFailedObjects || ctx.Err() != nil) {
+			return fmt.Errorf("failed to stream %s: %w", object, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,238 @@
+package s3streamer
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const inventoryTestManifest = `{
+  "sourceBucket": "source-bucket",
+  "destinationBucket": "arn:aws:s3:::inventory-bucket",
+  "version": "2016-11-30",
+  "creationTimestamp": "1704070800000",
+  "fileFormat": "CSV",
+  "fileSchema": "Bucket, Key, VersionId, IsLatest, IsDeleteMarker, Size, LastModifiedDate, ETag",
+  "files": [
+    {"key": "inventory/data/one.csv.gz", "size": 100, "MD5checksum": "0"},
+    {"key": "inventory/data/two.csv.gz", "size": 100, "MD5checksum": "0"}
+  ]
+}`
+
+// inventoryTestObjects returns an inventory report and the objects it lists.
+func inventoryTestObjects(t *testing.T) map[string]string {
+	one := `"source-bucket","logs/a.log","","true","false","6","2024-01-01T00:00:00.000Z","e1"
+"source-bucket","logs/my+file%2Bv2.log","","true","false","4","2024-01-01T00:00:00.000Z","e2"
+"source-bucket","logs/deleted.log","v9","true","true","","2024-01-01T00:00:00.000Z",""
+`
+	two := `"source-bucket","logs/empty.log","","true","false","0","2024-01-01T00:00:00.000Z","e3"
+"source-bucket","logs/b.log","v1","false","false","3","2024-01-01T00:00:00.000Z","e4"
+`
+	return map[string]string{
+		"inventory/manifest.json":       inventoryTestManifest,
+		"inventory/data/one.csv.gz":     string(compressForTest(t, []byte(one), Gzip, gzip.DefaultCompression, 0)),
+		"inventory/data/two.csv.gz":     string(compressForTest(t, []byte(two), Gzip, gzip.DefaultCompression, 0)),
+		"logs/a.log":                    "a1\na2\n",
+		"logs/my file+v2.log":           "m1\n",
+		"logs/b.log":                    "b2\n",
+		"logs/b.log?versionId=v1":       "b1\n",
+		"logs/deleted.log?versionId=v9": "gone\n",
+	}
+}
+
+func TestInventoryObjects(t *testing.T) {
+	streamer := NewS3Streamer(newBucketTestClient(inventoryTestObjects(t)))
+
+	var got []ManifestObject
+	for object, err := range streamer.InventoryObjects(context.Background(), "inventory-bucket", "inventory/manifest.json") {
+		if err != nil {
+			t.Fatalf("InventoryObjects failed: %v", err)
+		}
+		got = append(got, object)
+	}
+	want := []ManifestObject{
+		{Bucket: "source-bucket", Key: "logs/a.log", Size: 6},
+		{Bucket: "source-bucket", Key: "logs/my file+v2.log", Size: 4},
+		{Bucket: "source-bucket", Key: "logs/b.log", VersionID: "v1", Size: 3},
+	}
+	if fmt.Sprintf("%+v", got) != fmt.Sprintf("%+v", want) {
+		t.Errorf("Objects = %+v, want %+v", got, want)
+	}
+}
+
+// plainObjectClient rejects reads that send an SSE-C key, as S3 does for objects
+// stored without one.
+type plainObjectClient struct {
+	*bucketTestClient
+}
+
+func (c *plainObjectClient) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	if params.SSECustomerKey != nil {
+		return nil, fmt.Errorf("HeadObject: the object was not stored with an SSE-C key")
+	}
+	return c.bucketTestClient.HeadObject(ctx, params, optFns...)
+}
+
+func (c *plainObjectClient) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	if params.SSECustomerKey != nil {
+		return nil, fmt.Errorf("GetObject: the object was not stored with an SSE-C key")
+	}
+	return c.bucketTestClient.GetObject(ctx, params, optFns...)
+}
+
+func TestInventoryObjects_EncryptingStreamer(t *testing.T) {
+	// Reports are plain objects even when the listed objects are encrypted
+	client := &plainObjectClient{newBucketTestClient(inventoryTestObjects(t))}
+	streamer := NewS3Streamer(client, WithReadCustomerKey(testCustomerKey(t)), WithClientSideDecryption(testKeyProvider(t)))
+
+	var got int
+	for _, err := range streamer.InventoryObjects(context.Background(), "inventory-bucket", "inventory/manifest.json") {
+		if err != nil {
+			t.Fatalf("InventoryObjects failed: %v", err)
+		}
+		got++
+	}
+	if got != 3 {
+		t.Errorf("Got %d objects, want 3", got)
+	}
+}
+
+func TestInventoryObjects_Errors(t *testing.T) {
+	objects := inventoryTestObjects(t)
+	objects["orc/manifest.json"] = strings.Replace(inventoryTestManifest, `"CSV"`, `"ORC"`, 1)
+	objects["noschema/manifest.json"] = strings.Replace(inventoryTestManifest, "Bucket, Key", "Name", 1)
+	objects["missing/manifest.json"] = strings.Replace(inventoryTestManifest, "two.csv.gz", "three.csv.gz", 1)
+	streamer := NewS3Streamer(newBucketTestClient(objects))
+
+	for _, key := range []string{"orc/manifest.json", "noschema/manifest.json", "missing/manifest.json", "absent/manifest.json"} {
+		var err error
+		for _, err = range streamer.InventoryObjects(context.Background(), "inventory-bucket", key) {
+			if err != nil {
+				break
+			}
+		}
+		if err == nil {
+			t.Errorf("%s: expected error", key)
+		}
+	}
+}
+
+func TestParseURIList(t *testing.T) {
+	list := "s3://bucket-a/path/to/one.json\n\n# comment\n  s3://bucket-b/two.json.gz  \r\n"
+	var got []string
+	for object, err := range ParseURIList(strings.NewReader(list)) {
+		if err != nil {
+			t.Fatalf("ParseURIList failed: %v", err)
+		}
+		got = append(got, object.Bucket+"|"+object.Key)
+	}
+	if fmt.Sprint(got) != "[bucket-a|path/to/one.json bucket-b|two.json.gz]" {
+		t.Errorf("Objects = %v", got)
+	}
+
+	for _, bad := range []string{"https://bucket/key", "s3://bucket", "s3:///key", "s3://bucket/"} {
+		var err error
+		for _, err = range ParseURIList(strings.NewReader("s3://ok/key\n" + bad)) {
+		}
+		if err == nil || !strings.Contains(err.Error(), "line 2") {
+			t.Errorf("%q: expected error on line 2, got %v", bad, err)
+		}
+	}
+}
+
+func TestStreamManifest(t *testing.T) {
+	streamer := NewS3Streamer(newBucketTestClient(inventoryTestObjects(t)))
+
+	for _, concurrency := range []int{1, 3} {
+		t.Run(fmt.Sprintf("concurrency %d", concurrency), func(t *testing.T) {
+			var mu sync.Mutex
+			var lines []string
+			var results []ObjectResult
+			err := streamer.StreamManifest(context.Background(),
+				streamer.InventoryObjects(context.Background(), "inventory-bucket", "inventory/manifest.json"),
+				ManifestOptions{
+					Concurrency: concurrency,
+					OnObject: func(r ObjectResult) error {
+						results = append(results, r)
+						return nil
+					},
+				}, func(object ManifestObject, line []byte, offset int64) error {
+					mu.Lock()
+					defer mu.Unlock()
+					lines = append(lines, fmt.Sprintf("%s@%d:%s", object.Key, offset, line))
+					return nil
+				})
+			if err != nil {
+				t.Fatalf("StreamManifest failed: %v", err)
+			}
+
+			sort.Strings(lines)
+			want := "[logs/a.log@0:a1 logs/a.log@3:a2 logs/b.log@0:b1 logs/my file+v2.log@0:m1]"
+			if fmt.Sprint(lines) != want {
+				t.Errorf("Lines = %v, want %v", lines, want)
+			}
+			sort.Slice(results, func(i, j int) bool { return results[i].Index < results[j].Index })
+			if len(results) != 3 || results[0].Lines != 2 || results[2].Lines != 1 || results[2].Index != 2 {
+				t.Errorf("Results = %+v", results)
+			}
+		})
+	}
+}
+
+func TestStreamManifest_Failures(t *testing.T) {
+	streamer := NewS3Streamer(newBucketTestClient(inventoryTestObjects(t)))
+	list := "s3://b/logs/a.log\ns3://b/logs/missing.log\ns3://b/logs/b.log\n"
+
+	err := streamer.StreamManifest(context.Background(), ParseURIList(strings.NewReader(list)), ManifestOptions{},
+		func(ManifestObject, []byte, int64) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "s3://b/logs/missing.log") {
+		t.Errorf("Expected error naming the missing object, got %v", err)
+	}
+
+	var failed []ObjectResult
+	var streamed int
+	err = streamer.StreamManifest(context.Background(), ParseURIList(strings.NewReader(list)), ManifestOptions{
+		SkipFailedObjects: true,
+		OnObject: func(r ObjectResult) error {
+			if r.Err != nil {
+				failed = append(failed, r)
+			}
+			return nil
+		},
+	}, func(ManifestObject, []byte, int64) error {
+		streamed++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamManifest failed: %v", err)
+	}
+	if len(failed) != 1 || failed[0].Object.Key != "logs/missing.log" || failed[0].Index != 1 {
+		t.Errorf("Failed objects = %+v", failed)
+	}
+	if streamed != 3 {
+		t.Errorf("Streamed %d lines, want 3", streamed)
+	}
+
+	// Errors from the manifest are never skipped
+	errStop := errors.New("stop")
+	err = streamer.StreamManifest(context.Background(), ParseURIList(strings.NewReader("s3://b/logs/a.log\nnot-a-uri\n")), ManifestOptions{
+		SkipFailedObjects: true,
+		OnObject:          func(ObjectResult) error { return nil },
+	}, func(ManifestObject, []byte, int64) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Expected manifest error, got %v", err)
+	}
+	err = streamer.StreamManifest(context.Background(), ParseURIList(strings.NewReader(list)), ManifestOptions{
+		OnObject: func(ObjectResult) error { return errStop },
+	}, func(ManifestObject, []byte, int64) error { return nil })
+	if !errors.Is(err, errStop) {
+		t.Errorf("Expected object callback error, got %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+package s3streamer
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// ObjectOptions describes the object S3Writer creates. The settings are sent with
+// CreateMultipartUpload, or with PutObject for outputs smaller than one part. Zero
+// values leave S3's defaults in place. A writer returned by ResumeS3Writer continues
+// an upload whose settings were fixed when it was created.
+// Example:
+//
+//	opts := s3streamer.ObjectOptions{
+//	    ContentType:  "application/x-ndjson",
+//	    Metadata:     map[string]string{"source": "exporter"},
+//	    Tagging:      map[string]string{"retention": "90d"},
+//	    StorageClass: types.StorageClassStandardIa,
+//	}
+type ObjectOptions struct {
+	ContentType string
+	// ContentEncoding defaults to the codec's content encoding, such as "gzip", when
+	// written through CompressedS3Writer
+	ContentEncoding string
+	CacheControl    string
+	// Metadata is stored as x-amz-meta-* headers
+	Metadata map[string]string
+	// Tagging is the object's tag set, sent URL-encoded in the x-amz-tagging header
+	Tagging      map[string]string
+	StorageClass types.StorageClass
+	ACL          types.ObjectCannedACL
+	Expires      time.Time
+}
+
+// WithObjectOptions sets the content type, metadata, tags, storage class and other
+// settings of the object S3Writer creates.
+// Example:
+//
+//	writer, err := s3streamer.NewCompressedS3Writer(ctx, client, "my-bucket", "output.json.gz", 5*1024*1024,
+//	    s3streamer.Gzip, s3streamer.WithObjectOptions(s3streamer.ObjectOptions{
+//	        ContentType:  "application/x-ndjson",
+//	        StorageClass: types.StorageClassIntelligentTiering,
+//	    }))
+func WithObjectOptions(opts ObjectOptions) WriterOption {
+	return func(cfg *writerConfig) {
+		cfg.object = opts
+	}
+}
+
+// objectFields points at the object settings of a CreateMultipartUpload or PutObject
+// request.
+type objectFields struct {
+	contentType, contentEncoding, cacheControl, tagging **string
+	metadata                                            *map[string]string
+	storageClass                                        *types.StorageClass
+	acl                                                 *types.ObjectCannedACL
+	expires                                             **time.Time
+}
+
+// createObjectFields returns the object settings of a CreateMultipartUpload request.
+func createObjectFields(input *s3.CreateMultipartUploadInput) objectFields {
+	return objectFields{
+		contentType:     &input.ContentType,
+		contentEncoding: &input.ContentEncoding,
+		cacheControl:    &input.CacheControl,
+		tagging:         &input.Tagging,
+		metadata:        &input.Metadata,
+		storageClass:    &input.StorageClass,
+		acl:             &input.ACL,
+		expires:         &input.Expires,
+	}
+}
+
+// putObjectFields returns the object settings of a PutObject request.
+func putObjectFields(input *s3.PutObjectInput) objectFields {
+	return objectFields{
+		contentType:     &input.ContentType,
+		contentEncoding: &input.ContentEncoding,
+		cacheControl:    &input.CacheControl,
+		tagging:         &input.Tagging,
+		metadata:        &input.Metadata,
+		storageClass:    &input.StorageClass,
+		acl:             &input.ACL,
+		expires:         &input.Expires,
+	}
+}
+
+// apply copies the non-zero settings into the request fields.
+func (o ObjectOptions) apply(f objectFields) {
+	setString := func(field **string, value string) {
+		if value != "" {
+			*field = aws.String(value)
+		}
+	}
+	setString(f.contentType, o.ContentType)
+	setString(f.contentEncoding, o.ContentEncoding)
+	setString(f.cacheControl, o.CacheControl)
+
+	if len(o.Tagging) > 0 {
+		tags := make(url.Values, len(o.Tagging))
+		for key, value := range o.Tagging {
+			tags.Set(key, value)
+		}
+		*f.tagging = aws.String(tags.Encode())
+	}
+	if len(o.Metadata) > 0 {
+		*f.metadata = o.Metadata
+	}
+	if o.StorageClass != "" {
+		*f.storageClass = o.StorageClass
+	}
+	if o.ACL != "" {
+		*f.acl = o.ACL
+	}
+	if !o.Expires.IsZero() {
+		*f.expires = aws.Time(o.Expires)
+	}
+}
@@ -0,0 +1,129 @@
+package s3streamer
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestS3Writer_ObjectOptions(t *testing.T) {
+	partSize := int64(5 * 1024 * 1024)
+	expires := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	opts := ObjectOptions{
+		ContentType:     "application/x-ndjson",
+		ContentEncoding: "identity",
+		CacheControl:    "no-cache",
+		Metadata:        map[string]string{"source": "exporter"},
+		Tagging:         map[string]string{"team": "data & ml", "retention": "90d"},
+		StorageClass:    types.StorageClassStandardIa,
+		ACL:             types.ObjectCannedACLBucketOwnerFullControl,
+		Expires:         expires,
+	}
+
+	check := func(t *testing.T, contentType, contentEncoding, cacheControl, tagging *string, metadata map[string]string,
+		storageClass types.StorageClass, acl types.ObjectCannedACL, gotExpires *time.Time) {
+		t.Helper()
+		if aws.ToString(contentType) != opts.ContentType || aws.ToString(contentEncoding) != opts.ContentEncoding ||
+			aws.ToString(cacheControl) != opts.CacheControl {
+			t.Errorf("Headers = %q %q %q", aws.ToString(contentType), aws.ToString(contentEncoding), aws.ToString(cacheControl))
+		}
+		tags, err := url.ParseQuery(aws.ToString(tagging))
+		if err != nil || tags.Get("team") != "data & ml" || tags.Get("retention") != "90d" || len(tags) != 2 {
+			t.Errorf("Tagging = %q", aws.ToString(tagging))
+		}
+		if metadata["source"] != "exporter" {
+			t.Errorf("Metadata = %v", metadata)
+		}
+		if storageClass != opts.StorageClass || acl != opts.ACL {
+			t.Errorf("Storage class %q, ACL %q", storageClass, acl)
+		}
+		if gotExpires == nil || !gotExpires.Equal(expires) {
+			t.Errorf("Expires = %v", gotExpires)
+		}
+	}
+
+	t.Run("multipart", func(t *testing.T) {
+		client := newChecksumRecordingClient()
+		writer, err := NewS3Writer(context.Background(), client, "test-bucket", "test-key", partSize, WithObjectOptions(opts))
+		if err != nil {
+			t.Fatalf("Failed to create S3Writer: %v", err)
+		}
+		writer.Write(sizedTestData(partSize + 1))
+		if err := writer.Close(); err != nil {
+			t.Fatalf("Failed to close writer: %v", err)
+		}
+		in := client.createInput
+		check(t, in.ContentType, in.ContentEncoding, in.CacheControl, in.Tagging, in.Metadata, in.StorageClass, in.ACL, in.Expires)
+	})
+
+	t.Run("single put", func(t *testing.T) {
+		client := newChecksumRecordingClient()
+		writer, err := NewS3Writer(context.Background(), client, "test-bucket", "test-key", partSize, WithObjectOptions(opts))
+		if err != nil {
+			t.Fatalf("Failed to create S3Writer: %v", err)
+		}
+		writer.Write([]byte("small\n"))
+		if err := writer.Close(); err != nil {
+			t.Fatalf("Failed to close writer: %v", err)
+		}
+		in := client.putInput
+		check(t, in.ContentType, in.ContentEncoding, in.CacheControl, in.Tagging, in.Metadata, in.StorageClass, in.ACL, in.Expires)
+	})
+}
+
+func TestS3Writer_DefaultObjectOptions(t *testing.T) {
+	client := newChecksumRecordingClient()
+	writer, err := NewS3Writer(context.Background(), client, "test-bucket", "test-key", 5*1024*1024)
+	if err != nil {
+		t.Fatalf("Failed to create S3Writer: %v", err)
+	}
+	writer.Write([]byte("small\n"))
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Failed to close writer: %v", err)
+	}
+	in := client.putInput
+	if in.ContentType != nil || in.ContentEncoding != nil || in.Tagging != nil || in.Metadata != nil ||
+		in.StorageClass != "" || in.ACL != "" || in.Expires != nil {
+		t.Errorf("Unexpected object settings without options: %+v", in)
+	}
+}
+
+func TestCompressedS3Writer_ContentEncoding(t *testing.T) {
+	tests := []struct {
+		name        string
+		compression Compression
+		opts        ObjectOptions
+		want        string
+	}{
+		{"gzip", Gzip, ObjectOptions{}, "gzip"},
+		{"bzip2", Bzip2, ObjectOptions{}, "bzip2"},
+		{"zstd", Zstd, ObjectOptions{}, "zstd"},
+		{"uncompressed", Uncompressed, ObjectOptions{}, ""},
+		{"explicit", Gzip, ObjectOptions{ContentEncoding: "x-gzip", ContentType: "text/plain"}, "x-gzip"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newChecksumRecordingClient()
+			writer, err := NewCompressedS3Writer(context.Background(), client, "test-bucket", "test-key", 5*1024*1024,
+				tt.compression, WithObjectOptions(tt.opts))
+			if err != nil {
+				t.Fatalf("Failed to create CompressedS3Writer: %v", err)
+			}
+			writer.Write([]byte("hello world\n"))
+			if err := writer.Close(); err != nil {
+				t.Fatalf("Failed to close writer: %v", err)
+			}
+			if got := aws.ToString(client.putInput.ContentEncoding); got != tt.want {
+				t.Errorf("Content-Encoding = %q, want %q", got, tt.want)
+			}
+			if got := aws.ToString(client.putInput.ContentType); got != tt.opts.ContentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.opts.ContentType)
+			}
+		})
+	}
+}
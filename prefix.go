@@ -0,0 +1,228 @@
+package s3streamer
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// PrefixOptions configures StreamPrefix.
+// Example:
+//
+//	opts := s3streamer.PrefixOptions{
+//	    Include:     []string{"*.jsonl.gz"},
+//	    Exclude:     []string{"_*"},
+//	    Concurrency: 4,
+//	}
+type PrefixOptions struct {
+	// Include limits the stream to keys matching at least one of these path.Match
+	// patterns. Patterns are matched against the key with the prefix removed, so
+	// "*.gz" only matches objects directly under the prefix and "*/*.gz" those one
+	// level down. Empty includes every key.
+	Include []string
+	// Exclude skips keys matching any of these patterns, matched like Include.
+	Exclude []string
+	// Concurrency is the number of objects streamed at once. Values above 1 call fn
+	// concurrently for different objects; lines of one object are still delivered
+	// in order. Defaults to streaming one object at a time in key order.
+	Concurrency int
+	// Stream configures how every object is read. Offset, VersionID, Checkpoint,
+	// OnCheckpoint, OnCommit, SeekIndex and StartLine describe a single object and
+	// must not be set.
+	Stream StreamOptions
+	// Cursor resumes a scan from a cursor passed to OnCursor, skipping completed keys
+	// and continuing the key being read from its checkpoint.
+	Cursor *Cursor
+	// OnCursor receives the position of the scan after every object and at every
+	// checkpoint inside the object being read (see Stream.CheckpointInterval). Objects
+	// that cannot be checkpointed, such as zstd, only move the cursor once they are
+	// completed, as do all objects when Concurrency is above 1. Lines processed before
+	// a cursor are not delivered again when resuming from it.
+	OnCursor func(Cursor) error
+}
+
+// StreamPrefix streams every object under prefix as one dataset, passing fn each line
+// with the key of the object it came from and its offset within that object. Keys are
+// listed with ListObjectsV2 before streaming starts and streamed in lexicographic
+// order. Empty objects, including folder markers, are skipped. The first error stops
+// the stream; set OnCursor to be able to resume it.
+//
+// The caller needs s3:ListBucket permission on the bucket.
+// Example:
+//
+//	err := streamer.StreamPrefix(ctx, "my-bucket", "events/dt=2024-01-01/", s3streamer.PrefixOptions{
+//	    Include: []string{"*.jsonl.gz"},
+//	}, func(key string, line []byte, offset int64) error {
+//	    return process(key, line)
+//	})
+func (s *S3Streamer) StreamPrefix(ctx context.Context, bucket, prefix string, opts PrefixOptions, fn func(key string, line []byte, offset int64) error) error {
+	if err := opts.Stream.validateShared(); err != nil {
+		return err
+	}
+
+	objects, err := s.listPrefix(ctx, bucket, prefix, opts)
+	if err != nil {
+		return err
+	}
+	keys := make([]string, len(objects))
+	for i, object := range objects {
+		keys[i] = aws.ToString(object.Key)
+	}
+	tracker := newCursorTracker(opts.Cursor, opts.OnCursor, opts.Concurrency <= 1)
+	return forEachObject(ctx, keySeq(tracker.pending(keys)), opts.Concurrency, func(ctx context.Context, key string) error {
+		err := s.streamTracked(ctx, bucket, key, opts.Stream, tracker, func(line []byte, offset int64) error {
+			return fn(key, line, offset)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to stream s3://%s/%s: %w", bucket, key, err)
+		}
+		return nil
+	})
+}
+
+// listPrefix returns the non-empty objects under prefix that pass the include and
+// exclude patterns, sorted by key.
+func (s *S3Streamer) listPrefix(ctx context.Context, bucket, prefix string, opts PrefixOptions) ([]types.Object, error) {
+	for _, pattern := range append(append([]string{}, opts.Include...), opts.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid key pattern %q: %w", pattern, err)
+		}
+	}
+
+	input := &s3.ListObjectsV2Input{Bucket: &bucket}
+	if prefix != "" {
+		input.Prefix = &prefix
+	}
+	var objects []types.Object
+	for {
+		resp, err := s.client.ListObjectsV2(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list s3://%s/%s: %w", bucket, prefix, err)
+		}
+		for _, object := range resp.Contents {
+			if aws.ToInt64(object.Size) == 0 || !matchKey(strings.TrimPrefix(aws.ToString(object.Key), prefix), opts) {
+				continue
+			}
+			objects = append(objects, object)
+		}
+		if !aws.ToBool(resp.IsTruncated) || resp.NextContinuationToken == nil {
+			break
+		}
+		input.ContinuationToken = resp.NextContinuationToken
+	}
+
+	sort.Slice(objects, func(i, j int) bool {
+		return aws.ToString(objects[i].Key) < aws.ToString(objects[j].Key)
+	})
+	return objects, nil
+}
+
+// validateShared rejects the single-object options listed on PrefixOptions.Stream, for
+// options shared by every object of a multi-object stream.
+func (opts StreamOptions) validateShared() error {
+	if opts.Offset != 0 || opts.VersionID != "" || opts.Checkpoint != nil || opts.OnCheckpoint != nil || opts.OnCommit != nil ||
+		opts.SeekIndex != nil || opts.StartLine != 0 {
+		return fmt.Errorf("offsets, versions, checkpoints, seek indexes and commits cannot be shared by several objects")
+	}
+	return nil
+}
+
+// matchKey reports whether the key, relative to the prefix, passes the include and
+// exclude patterns. The patterns have been validated.
+func matchKey(name string, opts PrefixOptions) bool {
+	for _, pattern := range opts.Exclude {
+		if ok, _ := path.Match(pattern, name); ok {
+			return false
+		}
+	}
+	if len(opts.Include) == 0 {
+		return true
+	}
+	for _, pattern := range opts.Include {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// forEachObject calls stream for every object, in order or on up to concurrency
+// goroutines. The first error from objects or stream cancels the context passed to the
+// other calls and is returned.
+func forEachObject[T any](ctx context.Context, objects iter.Seq2[T, error], concurrency int, stream func(context.Context, T) error) error {
+	if concurrency <= 1 {
+		for object, err := range objects {
+			if err != nil {
+				return err
+			}
+			if err := stream(ctx, object); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var once sync.Once
+	var firstErr error
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+	queue := make(chan T)
+	var wg sync.WaitGroup
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for object := range queue {
+				if err := stream(ctx, object); err != nil {
+					fail(err)
+				}
+			}
+		}()
+	}
+
+feed:
+	for object, err := range objects {
+		if err != nil {
+			fail(err)
+			break
+		}
+		select {
+		case queue <- object:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// keySeq returns the keys as a sequence for forEachObject.
+func keySeq(keys []string) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		for _, key := range keys {
+			if !yield(key, nil) {
+				return
+			}
+		}
+	}
+}
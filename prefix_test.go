@@ -0,0 +1,208 @@
+package s3streamer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// bucketTestClient serves several objects from one bucket, listing them in pages of
+// pageSize keys. Keys of the form "key?versionId=v" hold older versions of key.
+type bucketTestClient struct {
+	*MockS3Client // Unused methods
+	objects       map[string]*MockS3Client
+	pageSize      int
+	listCalls     int
+}
+
+func newBucketTestClient(objects map[string]string) *bucketTestClient {
+	client := &bucketTestClient{MockS3Client: NewMockS3Client(nil), objects: map[string]*MockS3Client{}, pageSize: 2}
+	for key, data := range objects {
+		client.objects[key] = NewMockS3Client([]byte(data))
+		if _, version, ok := strings.Cut(key, "?versionId="); ok {
+			client.objects[key].versionID = version
+		}
+	}
+	return client
+}
+
+func (c *bucketTestClient) object(key, versionID *string) (*MockS3Client, error) {
+	name := aws.ToString(key)
+	if versionID != nil {
+		name += "?versionId=" + *versionID
+	}
+	object, ok := c.objects[name]
+	if !ok {
+		return nil, &types.NoSuchKey{}
+	}
+	return object, nil
+}
+
+func (c *bucketTestClient) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	object, err := c.object(params.Key, params.VersionId)
+	if err != nil {
+		return nil, err
+	}
+	return object.GetObject(ctx, params, optFns...)
+}
+
+func (c *bucketTestClient) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	object, err := c.object(params.Key, params.VersionId)
+	if err != nil {
+		return nil, err
+	}
+	return object.HeadObject(ctx, params, optFns...)
+}
+
+// ListObjectsV2 lists keys in order, using the last key of a page as its continuation token.
+func (c *bucketTestClient) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	c.listCalls++
+	var keys []string
+	for key := range c.objects {
+		if strings.HasPrefix(key, aws.ToString(params.Prefix)) && key > aws.ToString(params.ContinuationToken) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	output := &s3.ListObjectsV2Output{IsTruncated: aws.Bool(len(keys) > c.pageSize)}
+	if len(keys) > c.pageSize {
+		keys = keys[:c.pageSize]
+		output.NextContinuationToken = aws.String(keys[len(keys)-1])
+	}
+	for _, key := range keys {
+		output.Contents = append(output.Contents, types.Object{
+			Key:  aws.String(key),
+			Size: aws.Int64(int64(len(c.objects[key].data))),
+		})
+	}
+	return output, nil
+}
+
+var prefixTestObjects = map[string]string{
+	"logs/":                   "",
+	"logs/b.log":              "b1\nb2\n",
+	"logs/a.log":              "a1\na2\na3\n",
+	"logs/_SUCCESS":           "",
+	"logs/c.tmp":              "tmp\n",
+	"logs/nested/d.log":       "d1\n",
+	"other/e.log":             "e1\n",
+	"logs/zz-manifest.json":   "{}\n",
+	"logs/nested/deep/f.log":  "f1\n",
+	"logs/nested/_index.json": "{}\n",
+}
+
+func TestStreamPrefix(t *testing.T) {
+	client := newBucketTestClient(prefixTestObjects)
+	streamer := NewS3Streamer(client)
+
+	var got []string
+	err := streamer.StreamPrefix(context.Background(), "test-bucket", "logs/", PrefixOptions{
+		Include: []string{"*.log", "*/*.log"},
+	}, func(key string, line []byte, offset int64) error {
+		got = append(got, fmt.Sprintf("%s@%d:%s", key, offset, line))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamPrefix failed: %v", err)
+	}
+
+	want := []string{
+		"logs/a.log@0:a1", "logs/a.log@3:a2", "logs/a.log@6:a3",
+		"logs/b.log@0:b1", "logs/b.log@3:b2",
+		"logs/nested/d.log@0:d1",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Lines = %v, want %v", got, want)
+	}
+	if client.listCalls < 2 {
+		t.Errorf("Listing used %d pages, want several", client.listCalls)
+	}
+}
+
+func TestStreamPrefix_Exclude(t *testing.T) {
+	streamer := NewS3Streamer(newBucketTestClient(prefixTestObjects))
+
+	keys := map[string]bool{}
+	err := streamer.StreamPrefix(context.Background(), "test-bucket", "logs/", PrefixOptions{
+		Exclude: []string{"*.tmp", "*.json", "*/*.json"},
+	}, func(key string, line []byte, offset int64) error {
+		keys[key] = true
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamPrefix failed: %v", err)
+	}
+	for _, key := range []string{"logs/a.log", "logs/b.log", "logs/nested/d.log", "logs/nested/deep/f.log"} {
+		if !keys[key] {
+			t.Errorf("Missing %s", key)
+		}
+	}
+	if len(keys) != 4 {
+		t.Errorf("Streamed %d keys, want 4: %v", len(keys), keys)
+	}
+}
+
+func TestStreamPrefix_Concurrency(t *testing.T) {
+	objects := map[string]string{}
+	for i := range 20 {
+		objects[fmt.Sprintf("data/part-%02d", i)] = string(checkpointTestLines(50))
+	}
+	streamer := NewS3Streamer(newBucketTestClient(objects))
+
+	var mu sync.Mutex
+	lines := map[string][]int64{}
+	err := streamer.StreamPrefix(context.Background(), "test-bucket", "data/", PrefixOptions{Concurrency: 4},
+		func(key string, line []byte, offset int64) error {
+			mu.Lock()
+			defer mu.Unlock()
+			lines[key] = append(lines[key], offset)
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("StreamPrefix failed: %v", err)
+	}
+	if len(lines) != 20 {
+		t.Fatalf("Streamed %d objects, want 20", len(lines))
+	}
+	for key, offsets := range lines {
+		inOrder := sort.SliceIsSorted(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+		if len(offsets) != 50 || !inOrder {
+			t.Errorf("%s: %d lines, in order %v", key, len(offsets), inOrder)
+		}
+	}
+}
+
+func TestStreamPrefix_Errors(t *testing.T) {
+	streamer := NewS3Streamer(newBucketTestClient(prefixTestObjects))
+	errBad := errors.New("bad line")
+
+	for _, concurrency := range []int{1, 3} {
+		err := streamer.StreamPrefix(context.Background(), "test-bucket", "logs/", PrefixOptions{Concurrency: concurrency},
+			func(key string, line []byte, offset int64) error {
+				if string(line) == "b2" {
+					return errBad
+				}
+				return nil
+			})
+		if !errors.Is(err, errBad) || !strings.Contains(err.Error(), "s3://test-bucket/logs/b.log") {
+			t.Errorf("Concurrency %d: expected error naming the key, got %v", concurrency, err)
+		}
+	}
+
+	noop := func(string, []byte, int64) error { return nil }
+	if err := streamer.StreamPrefix(context.Background(), "test-bucket", "logs/", PrefixOptions{Include: []string{"["}}, noop); err == nil {
+		t.Error("Expected error for an invalid pattern")
+	}
+	if err := streamer.StreamPrefix(context.Background(), "test-bucket", "logs/", PrefixOptions{Stream: StreamOptions{Offset: 5}}, noop); err == nil {
+		t.Error("Expected error for a per-object offset")
+	}
+}
@@ -0,0 +1,226 @@
+package s3streamer
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// defaultCacheSize is the number of chunks ReadAt keeps when WithCacheSize is not used.
+const defaultCacheSize = 4
+
+var errClosedChunkStreamer = errors.New("cannot read from closed ChunkStreamer")
+
+// WithCacheSize sets how many chunks ChunkStreamer.ReadAt keeps in its LRU cache.
+// Random-access readers tend to revisit a few regions, such as a zip central
+// directory or parquet footer, so a small cache avoids most repeated requests.
+// Memory usage is bounded by roughly n × chunkSize. Values below 1 are treated as 1.
+// Example:
+//
+//	streamer := s3streamer.NewChunkStreamer(ctx, client, "my-bucket", "archive.zip", 0, size, 1024*1024,
+//	    s3streamer.WithCacheSize(16))
+func WithCacheSize(n int) ReaderOption {
+	return func(cfg *readerConfig) {
+		if n < 1 {
+			n = 1
+		}
+		cfg.cacheSize = n
+	}
+}
+
+// Size returns the number of bytes the ChunkStreamer covers, which is the size to pass
+// to readers that take an io.ReaderAt.
+// Example:
+//
+//	zr, err := zip.NewReader(streamer, streamer.Size())
+func (c *ChunkStreamer) Size() int64 {
+	return c.size
+}
+
+// Seek implements io.Seeker. Offsets are relative to the start of the range the
+// ChunkStreamer was created for. Seeking discards the read-ahead window and cancels its
+// in-flight requests unless the target is already buffered; seeking past the end is
+// allowed and makes the next Read return io.EOF. Seeking after a failed Read clears the
+// error, so reading can be retried from any position.
+// Example:
+//
+//	streamer := s3streamer.NewChunkStreamer(ctx, client, "my-bucket", "data.bin", 0, size, 5*1024*1024)
+//	if _, err := streamer.Seek(-1024, io.SeekEnd); err != nil {
+//	    return err
+//	}
+//	trailer, err := io.ReadAll(streamer)
+func (c *ChunkStreamer) Seek(offset int64, whence int) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return 0, fmt.Errorf("cannot seek closed ChunkStreamer")
+	}
+
+	var target int64
+	switch whence {
+	case io.SeekStart:
+		target = c.offset + offset
+	case io.SeekCurrent:
+		target = c.pos + offset
+	case io.SeekEnd:
+		target = c.offset + c.size + offset
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+	if target < c.offset {
+		return 0, fmt.Errorf("seek to negative position %d", target-c.offset)
+	}
+
+	// Skipping forward within the current chunk needs no new requests
+	if c.err == nil && target >= c.pos && target-c.pos <= int64(len(c.buffer)) {
+		c.buffer = c.buffer[target-c.pos:]
+		c.pos = target
+		return target - c.offset, nil
+	}
+
+	// Abandon the read-ahead window; its requests finish quickly once cancelled
+	c.fetchCancel()
+	c.fetchCtx, c.fetchCancel = context.WithCancel(c.ctx)
+	c.window = nil
+	c.buffer = nil
+	c.err = c.ctx.Err() // Only Close or the caller's context stop a ChunkStreamer for good
+	c.eof = false
+	c.currentOffset = target
+	c.pos = target
+	return target - c.offset, nil
+}
+
+// ReadAt implements io.ReaderAt. Offsets are relative to the start of the range the
+// ChunkStreamer was created for. Reads are served from chunk-aligned blocks kept in a
+// small LRU cache (see WithCacheSize) that is independent of the Read position, and
+// concurrent callers asking for the same block share a single request. ReadAt is safe
+// to call from multiple goroutines.
+// Example:
+//
+//	streamer := s3streamer.NewChunkStreamer(ctx, client, "my-bucket", "archive.zip", 0, size, 1024*1024)
+//	defer streamer.Close()
+//	zr, err := zip.NewReader(streamer, streamer.Size())
+func (c *ChunkStreamer) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %d", off)
+	}
+	if off >= c.size {
+		return 0, io.EOF
+	}
+
+	n := 0
+	for n < len(p) && off < c.size {
+		index := off / c.chunkSize
+		block, err := c.block(index)
+		if err != nil {
+			return n, err
+		}
+		copied := copy(p[n:], block[off-index*c.chunkSize:])
+		n += copied
+		off += int64(copied)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// block returns the chunk-aligned block with the given index, from the cache if possible.
+func (c *ChunkStreamer) block(index int64) ([]byte, error) {
+	entry, owner, err := c.cache.get(index)
+	if err != nil {
+		return nil, err
+	}
+
+	if owner {
+		start := c.offset + index*c.chunkSize
+		end := min(start+c.chunkSize, c.offset+c.size) - 1
+		entry.data, entry.err = c.fetchRange(c.ctx, start, end)
+		if entry.err != nil {
+			c.cache.remove(entry) // Let a later call try again
+		}
+		close(entry.done)
+		return entry.data, entry.err
+	}
+
+	select {
+	case <-entry.done:
+		return entry.data, entry.err
+	case <-c.ctx.Done():
+		return nil, c.ctx.Err()
+	}
+}
+
+// blockCache is an LRU cache of blocks, keyed by block index.
+type blockCache struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[int64]*list.Element
+	order    list.List // Most recently used at the front
+	closed   bool
+}
+
+// cacheEntry is a cached block whose data is published by closing done.
+type cacheEntry struct {
+	index int64
+	data  []byte
+	err   error
+	done  chan struct{}
+}
+
+func newBlockCache(capacity int) *blockCache {
+	return &blockCache{
+		capacity: capacity,
+		entries:  make(map[int64]*list.Element),
+	}
+}
+
+// get returns the entry for index. If owner is true the entry was just created and the
+// caller must fill it in and close done; otherwise the caller waits on done.
+func (bc *blockCache) get(index int64) (entry *cacheEntry, owner bool, err error) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	if bc.closed {
+		return nil, false, errClosedChunkStreamer
+	}
+	if elem, ok := bc.entries[index]; ok {
+		bc.order.MoveToFront(elem)
+		return elem.Value.(*cacheEntry), false, nil
+	}
+
+	entry = &cacheEntry{index: index, done: make(chan struct{})}
+	bc.entries[index] = bc.order.PushFront(entry)
+	for bc.order.Len() > bc.capacity {
+		// Evicted entries stay valid for callers already holding them
+		oldest := bc.order.Back()
+		bc.order.Remove(oldest)
+		delete(bc.entries, oldest.Value.(*cacheEntry).index)
+	}
+	return entry, true, nil
+}
+
+// remove drops entry from the cache if it is still present.
+func (bc *blockCache) remove(entry *cacheEntry) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	if elem, ok := bc.entries[entry.index]; ok && elem.Value == entry {
+		bc.order.Remove(elem)
+		delete(bc.entries, entry.index)
+	}
+}
+
+// clear empties the cache and rejects further use.
+func (bc *blockCache) clear() {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	bc.closed = true
+	bc.entries = make(map[int64]*list.Element)
+	bc.order.Init()
+}
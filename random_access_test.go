@@ -0,0 +1,272 @@
+package s3streamer
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestChunkStreamerReadAt(t *testing.T) {
+	testData := sizedTestData(1000)
+	client := NewMockS3Client(testData)
+	streamer := NewChunkStreamer(context.Background(), client, "test-bucket", "test-key", 0, int64(len(testData)), 64)
+	defer streamer.Close()
+
+	rng := rand.New(rand.NewPCG(5, 6))
+	for i := 0; i < 200; i++ {
+		off := rng.Int64N(int64(len(testData)))
+		buf := make([]byte, rng.IntN(300))
+
+		n, err := streamer.ReadAt(buf, off)
+		want := testData[off:min(off+int64(len(buf)), int64(len(testData)))]
+		if n != len(want) {
+			t.Fatalf("ReadAt(%d bytes, %d) = %d bytes, want %d", len(buf), off, n, len(want))
+		}
+		if !bytes.Equal(buf[:n], want) {
+			t.Fatalf("ReadAt(%d bytes, %d) returned wrong data", len(buf), off)
+		}
+		if n < len(buf) && err != io.EOF {
+			t.Fatalf("Short ReadAt returned %v, want io.EOF", err)
+		}
+		if n == len(buf) && err != nil {
+			t.Fatalf("Full ReadAt returned %v", err)
+		}
+	}
+
+	if _, err := streamer.ReadAt(make([]byte, 1), int64(len(testData))); err != io.EOF {
+		t.Errorf("ReadAt at end returned %v, want io.EOF", err)
+	}
+	if _, err := streamer.ReadAt(make([]byte, 1), -1); err == nil {
+		t.Error("Expected error for negative offset")
+	}
+}
+
+func TestChunkStreamerReadAtUsesCache(t *testing.T) {
+	testData := sizedTestData(1000)
+	client := NewMockS3Client(testData)
+	streamer := NewChunkStreamer(context.Background(), client, "test-bucket", "test-key", 0, int64(len(testData)), 100,
+		WithCacheSize(2))
+	defer streamer.Close()
+
+	buf := make([]byte, 10)
+	read := func(off int64) {
+		t.Helper()
+		if _, err := streamer.ReadAt(buf, off); err != nil {
+			t.Fatalf("ReadAt(%d) failed: %v", off, err)
+		}
+	}
+
+	read(0)
+	read(50)  // Same block
+	read(950) // Second block
+	read(5)   // Still cached
+	if got := client.getCallCount; got != 2 {
+		t.Errorf("GetObject call count = %d, want 2", got)
+	}
+
+	read(500) // Evicts block 9, the least recently used
+	read(955)
+	if got := client.getCallCount; got != 4 {
+		t.Errorf("GetObject call count after eviction = %d, want 4", got)
+	}
+}
+
+func TestChunkStreamerReadAtConcurrent(t *testing.T) {
+	testData := sizedTestData(4096)
+	client := &blockingMockS3Client{MockS3Client: NewMockS3Client(testData), delay: 20 * time.Millisecond}
+	streamer := NewChunkStreamer(context.Background(), client, "test-bucket", "test-key", 0, int64(len(testData)), 1024)
+	defer streamer.Close()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			off := int64(i%4) * 1024
+			buf := make([]byte, 1024)
+			if _, err := streamer.ReadAt(buf, off); err != nil {
+				errs <- err
+				return
+			}
+			if !bytes.Equal(buf, testData[off:off+1024]) {
+				errs <- fmt.Errorf("wrong data at offset %d", off)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	// Callers asking for the same block share one request
+	if got := client.getCallCount; got != 4 {
+		t.Errorf("GetObject call count = %d, want 4", got)
+	}
+}
+
+func TestChunkStreamerSeek(t *testing.T) {
+	testData := sizedTestData(1000)
+	client := NewMockS3Client(testData)
+	streamer := NewChunkStreamer(context.Background(), client, "test-bucket", "test-key", 100, 800, 64,
+		WithReadConcurrency(3))
+	defer streamer.Close()
+
+	buf := make([]byte, 10)
+	readAndCheck := func(want []byte) {
+		t.Helper()
+		if _, err := io.ReadFull(streamer, buf[:len(want)]); err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+		if !bytes.Equal(buf[:len(want)], want) {
+			t.Fatalf("Read %v, want %v", buf[:len(want)], want)
+		}
+	}
+
+	readAndCheck(testData[100:110])
+
+	// Offsets are relative to the start of the streamer's range
+	pos, err := streamer.Seek(500, io.SeekStart)
+	if err != nil || pos != 500 {
+		t.Fatalf("Seek(500, SeekStart) = %d, %v", pos, err)
+	}
+	readAndCheck(testData[600:610])
+
+	pos, err = streamer.Seek(-20, io.SeekCurrent)
+	if err != nil || pos != 490 {
+		t.Fatalf("Seek(-20, SeekCurrent) = %d, %v", pos, err)
+	}
+	readAndCheck(testData[590:600])
+
+	// Forward within the buffered chunk
+	pos, err = streamer.Seek(5, io.SeekCurrent)
+	if err != nil || pos != 505 {
+		t.Fatalf("Seek(5, SeekCurrent) = %d, %v", pos, err)
+	}
+	readAndCheck(testData[605:615])
+
+	pos, err = streamer.Seek(-10, io.SeekEnd)
+	if err != nil || pos != 790 {
+		t.Fatalf("Seek(-10, SeekEnd) = %d, %v", pos, err)
+	}
+	rest, err := io.ReadAll(streamer)
+	if err != nil || !bytes.Equal(rest, testData[890:900]) {
+		t.Fatalf("ReadAll after SeekEnd = %v, %v", rest, err)
+	}
+
+	// Seeking past the end is allowed; the next Read reports EOF
+	if _, err := streamer.Seek(10, io.SeekEnd); err != nil {
+		t.Fatalf("Seek past end failed: %v", err)
+	}
+	if n, err := streamer.Read(buf); n != 0 || err != io.EOF {
+		t.Errorf("Read past end = %d, %v, want 0, io.EOF", n, err)
+	}
+
+	if _, err := streamer.Seek(-1, io.SeekStart); err == nil {
+		t.Error("Expected error for negative position")
+	}
+	if _, err := streamer.Seek(0, 42); err == nil {
+		t.Error("Expected error for invalid whence")
+	}
+}
+
+func TestChunkStreamerSeekAfterFailedRead(t *testing.T) {
+	testData := sizedTestData(1000)
+	client := &flakyMockS3Client{
+		MockS3Client: NewMockS3Client(testData),
+		failures:     1,
+		getErr:       fmt.Errorf("read: %w", syscall.ECONNRESET),
+	}
+	streamer := NewChunkStreamer(context.Background(), client, "test-bucket", "test-key", 0, int64(len(testData)), 64,
+		WithRetryPolicy(fastRetryPolicy(1)))
+	defer streamer.Close()
+
+	buf := make([]byte, 10)
+	if _, err := streamer.Read(buf); err == nil {
+		t.Fatal("Expected the first Read to fail")
+	}
+
+	// A failed Read does not stop random access
+	if _, err := streamer.ReadAt(buf, 500); err != nil || !bytes.Equal(buf, testData[500:510]) {
+		t.Fatalf("ReadAt after failed Read = %v, %v", buf, err)
+	}
+
+	// Seeking, even to the current position, retries the read
+	if _, err := streamer.Seek(0, io.SeekCurrent); err != nil {
+		t.Fatalf("Seek failed: %v", err)
+	}
+	if _, err := io.ReadFull(streamer, buf); err != nil || !bytes.Equal(buf, testData[:10]) {
+		t.Fatalf("Read after Seek = %v, %v", buf, err)
+	}
+	if _, err := streamer.Seek(200, io.SeekStart); err != nil {
+		t.Fatalf("Seek failed: %v", err)
+	}
+	if _, err := io.ReadFull(streamer, buf); err != nil || !bytes.Equal(buf, testData[200:210]) {
+		t.Fatalf("Read after Seek = %v, %v", buf, err)
+	}
+}
+
+func TestChunkStreamerClosedRandomAccess(t *testing.T) {
+	testData := sizedTestData(100)
+	streamer := NewChunkStreamer(context.Background(), NewMockS3Client(testData), "test-bucket", "test-key", 0, 100, 10)
+	streamer.Close()
+
+	if _, err := streamer.ReadAt(make([]byte, 1), 0); err == nil {
+		t.Error("Expected error from ReadAt after Close")
+	}
+	if _, err := streamer.Seek(0, io.SeekStart); err == nil {
+		t.Error("Expected error from Seek after Close")
+	}
+}
+
+func TestChunkStreamerWithZipReader(t *testing.T) {
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	files := map[string]string{
+		"a.txt":        "first file",
+		"dir/b.json":   `{"hello":"world"}`,
+		"dir/c/d.json": string(bytes.Repeat([]byte("x"), 5000)),
+	}
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("Failed to create zip entry: %v", err)
+		}
+		w.Write([]byte(content))
+	}
+	zw.Close()
+
+	client := NewMockS3Client(archive.Bytes())
+	streamer := NewChunkStreamer(context.Background(), client, "test-bucket", "test-key", 0, int64(archive.Len()), 256)
+	defer streamer.Close()
+
+	zr, err := zip.NewReader(streamer, streamer.Size())
+	if err != nil {
+		t.Fatalf("Failed to open zip: %v", err)
+	}
+	if len(zr.File) != len(files) {
+		t.Fatalf("Zip has %d files, want %d", len(zr.File), len(files))
+	}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", f.Name, err)
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", f.Name, err)
+		}
+		if string(content) != files[f.Name] {
+			t.Errorf("Content of %s does not match", f.Name)
+		}
+	}
+}
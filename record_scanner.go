@@ -0,0 +1,226 @@
+package s3streamer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// DefaultMaxRecordSize is the largest record Stream buffers unless
+// StreamOptions.MaxRecordSize is set.
+const DefaultMaxRecordSize = 10 * 1024 * 1024
+
+// minMaxRecordSize leaves room for the longest length prefix.
+const minMaxRecordSize = 64
+
+// OversizePolicy decides what Stream does with a record longer than
+// StreamOptions.MaxRecordSize.
+type OversizePolicy int
+
+const (
+	// FailOversizeRecords stops the stream with a *RecordTooLargeError (the default).
+	FailOversizeRecords OversizePolicy = iota
+	// SkipOversizeRecords drops oversized records, reports each to
+	// StreamOptions.OnSkippedRecord and continues with the next record.
+	SkipOversizeRecords
+	// FragmentOversizeRecords delivers oversized records in fragments of at most
+	// MaxRecordSize bytes, each with its own offset. Lines from Lines mark every
+	// fragment but the last as Partial and share the record's line number.
+	FragmentOversizeRecords
+)
+
+// RecordTooLargeError reports a record longer than StreamOptions.MaxRecordSize.
+type RecordTooLargeError struct {
+	Offset int64 // Offset of the record's frame in the decompressed stream
+	Size   int64 // Length of the frame, or 0 if the stream failed before its end was found
+	Limit  int   // The MaxRecordSize in effect
+}
+
+// Error implements the error interface.
+func (e *RecordTooLargeError) Error() string {
+	if e.Size > 0 {
+		return fmt.Sprintf("record at offset %d is %d bytes, exceeding the maximum record size of %d bytes", e.Offset, e.Size, e.Limit)
+	}
+	return fmt.Sprintf("record at offset %d exceeds the maximum record size of %d bytes", e.Offset, e.Limit)
+}
+
+// recordScanner splits a stream into records with a Framing and tracks the stream
+// offset of every record it returns. Records longer than max are handled according
+// to policy instead of failing with bufio.ErrTooLong.
+type recordScanner struct {
+	*bufio.Scanner
+	framing   Framing
+	max       int
+	policy    OversizePolicy
+	onSkipped func(*RecordTooLargeError) error
+	bounds    *Split // Oversized records starting outside it are skipped silently
+
+	pos     int64 // Stream offset of the first byte passed to the next split call
+	start   int64 // Offset of the last record returned
+	end     int64 // Offset of the byte after the last record returned
+	partial bool  // The last record returned is a fragment and more follow
+
+	oversized   bool  // Inside an oversized record
+	outside     bool  // The oversized record starts outside the split
+	recordStart int64 // Offset of the oversized record
+	remaining   int64 // Bytes left of an oversized length-prefixed record
+}
+
+// newRecordScanner returns a recordScanner over r whose first byte is at stream offset pos.
+func newRecordScanner(r io.Reader, pos int64, opts StreamOptions) (*recordScanner, error) {
+	max := opts.MaxRecordSize
+	if max == 0 {
+		max = DefaultMaxRecordSize
+	}
+	if max < minMaxRecordSize {
+		return nil, fmt.Errorf("max record size must be at least %d bytes, got %d", minMaxRecordSize, max)
+	}
+
+	rs := &recordScanner{
+		Scanner:   bufio.NewScanner(r),
+		framing:   opts.Framing,
+		max:       max,
+		policy:    opts.OversizePolicy,
+		onSkipped: opts.OnSkippedRecord,
+		bounds:    opts.split,
+		pos:       pos,
+	}
+	// Use a larger buffer size for better performance with large lines
+	initial := 1024 * 1024
+	if max < initial {
+		initial = max
+	}
+	rs.Buffer(make([]byte, initial), max)
+	rs.Split(rs.split)
+	return rs, nil
+}
+
+// split wraps the framing's split function, recording offsets and catching records
+// that do not fit in the buffer before the Scanner gives up on them.
+func (rs *recordScanner) split(data []byte, atEOF bool) (int, []byte, error) {
+	if rs.oversized {
+		return rs.continueRecord(data, atEOF)
+	}
+
+	advance, token, err := rs.framing.split(data, atEOF)
+	if err == nil && advance == 0 && token == nil && !atEOF && len(data) >= rs.max {
+		return rs.startRecord(data)
+	}
+	return rs.emit(advance, token, false), token, err
+}
+
+// emit records the offsets of a returned record and advances pos.
+func (rs *recordScanner) emit(advance int, token []byte, partial bool) int {
+	if token != nil {
+		rs.start = rs.pos
+		rs.end = rs.pos + int64(advance)
+		rs.partial = partial
+	}
+	rs.pos += int64(advance)
+	return advance
+}
+
+// startRecord handles the start of a record that fills the whole buffer.
+func (rs *recordScanner) startRecord(data []byte) (int, []byte, error) {
+	tooLarge := &RecordTooLargeError{Offset: rs.pos, Limit: rs.max}
+	var header int
+	if rs.framing.kind == lengthPrefixedFrames {
+		var length uint64
+		header, length, _ = rs.framing.header(data) // The prefix fits in the buffer
+		tooLarge.Size = int64(header) + int64(length)
+		rs.remaining = tooLarge.Size
+	}
+	// Another split is responsible for records that start outside this one
+	rs.outside = rs.bounds != nil && (rs.pos < rs.bounds.Start || rs.pos >= rs.bounds.End)
+	if !rs.skipping() && rs.policy != FragmentOversizeRecords {
+		return 0, nil, tooLarge
+	}
+
+	rs.oversized = true
+	rs.recordStart = rs.pos
+	if rs.skipping() {
+		rs.remaining -= int64(len(data))
+		return rs.emit(len(data), nil, false), nil, nil
+	}
+
+	// The first fragment holds the record without its RS or length prefix
+	fragment := data
+	switch rs.framing.kind {
+	case jsonSeqFrames:
+		fragment = data[1:]
+	case lengthPrefixedFrames:
+		fragment = data[header:]
+	}
+	fragment, n := rs.holdBackCR(fragment, len(data))
+	rs.remaining -= int64(n)
+	return rs.emit(n, fragment, true), fragment, nil
+}
+
+// holdBackCR keeps a trailing CR of a line fragment for the next fragment, where it
+// may turn out to be part of a CRLF. n is the number of bytes the fragment covers.
+func (rs *recordScanner) holdBackCR(fragment []byte, n int) ([]byte, int) {
+	if rs.framing.kind == lineFrames && len(fragment) > 0 && fragment[len(fragment)-1] == '\r' {
+		return fragment[:len(fragment)-1], n - 1
+	}
+	return fragment, n
+}
+
+// continueRecord handles data that continues an oversized record.
+func (rs *recordScanner) continueRecord(data []byte, atEOF bool) (int, []byte, error) {
+	var advance int
+	var record []byte
+	var found bool
+	if rs.framing.kind == lengthPrefixedFrames {
+		advance = len(data)
+		if int64(advance) >= rs.remaining {
+			advance, found = int(rs.remaining), true
+		} else if atEOF {
+			return 0, nil, errTruncatedRecord
+		}
+		record = data[:advance]
+	} else {
+		advance, record, found = rs.framing.tail(data, atEOF)
+	}
+
+	if found {
+		rs.oversized = false
+		if rs.skipping() {
+			return rs.skipped(advance)
+		}
+		if record == nil {
+			record = data[:0] // The final fragment is delivered even if it is empty
+		}
+		return rs.emit(advance, record, false), record, nil
+	}
+
+	// The record goes on past data
+	if rs.skipping() {
+		rs.remaining -= int64(len(data))
+		return rs.emit(len(data), nil, false), nil, nil
+	}
+	if len(data) < rs.max {
+		return 0, nil, nil // Wait for a full fragment
+	}
+	fragment, n := rs.holdBackCR(data, len(data))
+	rs.remaining -= int64(n)
+	return rs.emit(n, fragment, true), fragment, nil
+}
+
+// skipping reports whether the current oversized record is being skipped.
+func (rs *recordScanner) skipping() bool {
+	return rs.policy == SkipOversizeRecords || rs.outside
+}
+
+// skipped finishes skipping an oversized record whose last advance bytes are at the
+// start of the current data, and reports it.
+func (rs *recordScanner) skipped(advance int) (int, []byte, error) {
+	rs.emit(advance, nil, false)
+	if rs.onSkipped == nil || rs.outside {
+		return advance, nil, nil
+	}
+	err := rs.onSkipped(&RecordTooLargeError{Offset: rs.recordStart, Size: rs.pos - rs.recordStart, Limit: rs.max})
+	if err != nil {
+		return 0, nil, fmt.Errorf("skipped record callback failed: %w", err)
+	}
+	return advance, nil, nil
+}
@@ -0,0 +1,174 @@
+package s3streamer
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// oversizeTestData returns framed records where the third is much larger than 100 bytes,
+// and the offset of every frame.
+func oversizeTestData(framing Framing) ([]byte, []string, []int64) {
+	records := []string{"first", "second", strings.Repeat("big ", 80), "fourth", ""}
+	if framing.kind == jsonSeqFrames {
+		records = records[:4] // Empty JSON texts are skipped
+	}
+
+	var data []byte
+	var starts []int64
+	for _, record := range records {
+		starts = append(starts, int64(len(data)))
+		switch framing.kind {
+		case lineFrames:
+			data = append(data, record+"\r\n"...)
+		case delimitedFrames:
+			data = append(data, record+"\x00"...)
+		case jsonSeqFrames:
+			data = append(data, "\x1e"+record+"\n"...)
+		case lengthPrefixedFrames:
+			data = binary.AppendUvarint(data, uint64(len(record)))
+			data = append(data, record...)
+		}
+	}
+	return data, records, starts
+}
+
+var oversizeTestFramings = []struct {
+	name    string
+	framing Framing
+}{
+	{"CRLF lines", LineFraming()},
+	{"NUL", DelimitedFraming(0)},
+	{"RFC 7464", JSONSeqFraming()},
+	{"varint", LengthPrefixedFraming(VarintPrefix)},
+}
+
+func TestStreamWithOptions_OversizeFail(t *testing.T) {
+	for _, tt := range oversizeTestFramings {
+		t.Run(tt.name, func(t *testing.T) {
+			data, records, starts := oversizeTestData(tt.framing)
+			got, _, err := streamRecords(t, data, StreamOptions{Framing: tt.framing, MaxRecordSize: 100})
+
+			var tooLarge *RecordTooLargeError
+			if !errors.As(err, &tooLarge) {
+				t.Fatalf("Expected *RecordTooLargeError, got %v", err)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(records[:2]) {
+				t.Errorf("Delivered %q before failing", got)
+			}
+			if tooLarge.Offset != starts[2] || tooLarge.Limit != 100 {
+				t.Errorf("Error offset %d, limit %d, want offset %d", tooLarge.Offset, tooLarge.Limit, starts[2])
+			}
+		})
+	}
+}
+
+func TestStreamWithOptions_OversizeSkip(t *testing.T) {
+	for _, tt := range oversizeTestFramings {
+		t.Run(tt.name, func(t *testing.T) {
+			data, records, starts := oversizeTestData(tt.framing)
+			var skipped []RecordTooLargeError
+			got, offsets, err := streamRecords(t, data, StreamOptions{
+				Framing:        tt.framing,
+				MaxRecordSize:  100,
+				OversizePolicy: SkipOversizeRecords,
+				OnSkippedRecord: func(err *RecordTooLargeError) error {
+					skipped = append(skipped, *err)
+					return nil
+				},
+			})
+			if err != nil {
+				t.Fatalf("Stream failed: %v", err)
+			}
+
+			want := append(append([]string{}, records[:2]...), records[3:]...)
+			wantOffsets := append(append([]int64{}, starts[:2]...), starts[3:]...)
+			if fmt.Sprint(got) != fmt.Sprint(want) || fmt.Sprint(offsets) != fmt.Sprint(wantOffsets) {
+				t.Errorf("Records = %q at %v, want %q at %v", got, offsets, want, wantOffsets)
+			}
+			if len(skipped) != 1 {
+				t.Fatalf("Reported %d skipped records, want 1", len(skipped))
+			}
+			if skipped[0].Offset != starts[2] || skipped[0].Size != starts[3]-starts[2] {
+				t.Errorf("Skipped frame %d+%d, want %d+%d", skipped[0].Offset, skipped[0].Size, starts[2], starts[3]-starts[2])
+			}
+		})
+	}
+}
+
+func TestStreamWithOptions_OversizeSkipCallbackError(t *testing.T) {
+	data, _, _ := oversizeTestData(LineFraming())
+	errStop := errors.New("stop")
+	_, _, err := streamRecords(t, data, StreamOptions{
+		MaxRecordSize:   100,
+		OversizePolicy:  SkipOversizeRecords,
+		OnSkippedRecord: func(*RecordTooLargeError) error { return errStop },
+	})
+	if !errors.Is(err, errStop) {
+		t.Errorf("Expected callback error, got %v", err)
+	}
+}
+
+func TestLines_OversizeFragments(t *testing.T) {
+	for _, tt := range oversizeTestFramings {
+		t.Run(tt.name, func(t *testing.T) {
+			data, records, _ := oversizeTestData(tt.framing)
+			streamer := NewS3Streamer(NewMockS3Client(data))
+			streamer.chunkSize = 7
+
+			var got []string
+			var current bytes.Buffer
+			var fragments int
+			next := int64(0)
+			for line, err := range streamer.Lines(context.Background(), "test-bucket", "test-key", StreamOptions{
+				Framing:        tt.framing,
+				MaxRecordSize:  100,
+				OversizePolicy: FragmentOversizeRecords,
+			}) {
+				if err != nil {
+					t.Fatalf("Lines failed: %v", err)
+				}
+				if len(line.Data) > 100 {
+					t.Errorf("Fragment of %d bytes", len(line.Data))
+				}
+				if line.Number != int64(len(got)+1) {
+					t.Errorf("Line number %d, want %d", line.Number, len(got)+1)
+				}
+				if line.Offset < next {
+					t.Errorf("Offset %d overlaps the previous record ending at %d", line.Offset, next)
+				}
+				next = line.Offset + int64(len(line.Data))
+				current.Write(line.Data)
+				fragments++
+				if !line.Partial {
+					got = append(got, current.String())
+					current.Reset()
+				}
+			}
+			if fmt.Sprint(got) != fmt.Sprint(records) {
+				t.Errorf("Records = %q, want %q", got, records)
+			}
+			if fragments <= len(records) {
+				t.Errorf("Oversized record was not fragmented")
+			}
+		})
+	}
+}
+
+func TestStreamWithOptions_MaxRecordSize(t *testing.T) {
+	data := []byte(strings.Repeat("x", 200) + "\nshort\n")
+	if _, _, err := streamRecords(t, data, StreamOptions{MaxRecordSize: 10}); err == nil {
+		t.Error("Expected error for a max record size below 64")
+	}
+	records, _, err := streamRecords(t, data, StreamOptions{MaxRecordSize: 201})
+	if err != nil || len(records) != 2 {
+		t.Errorf("A frame of exactly MaxRecordSize bytes failed: %v", err)
+	}
+	if _, _, err := streamRecords(t, data, StreamOptions{MaxRecordSize: 200}); err == nil {
+		t.Error("Expected error for a frame one byte over MaxRecordSize")
+	}
+}
@@ -0,0 +1,144 @@
+package s3streamer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+)
+
+// RetryPolicy controls how ChunkStreamer retries a ranged GetObject that fails or whose
+// body is cut short. Retries resume from the first missing byte, so a connection reset
+// halfway through a chunk only re-requests the remaining tail of that chunk.
+// Example:
+//
+//	policy := s3streamer.DefaultRetryPolicy()
+//	policy.MaxAttempts = 10
+//	streamer := s3streamer.NewS3Streamer(client, s3streamer.WithRetryPolicy(policy))
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts per chunk, including the first.
+	// Values of 1 or less disable retries.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between attempts.
+	MaxBackoff time.Duration
+	// Multiplier grows the delay after each attempt. Values below 1 are treated as 2.
+	Multiplier float64
+	// Jitter randomly shortens each delay by up to this fraction (0 to 1).
+	Jitter float64
+	// Retryable classifies errors. If nil, IsRetryableError is used.
+	Retryable func(error) bool
+}
+
+// DefaultRetryPolicy returns the policy used when no WithRetryPolicy option is given:
+// three attempts with exponential backoff starting at 200ms and capped at 5s.
+// Example:
+//
+//	policy := s3streamer.DefaultRetryPolicy()
+//	policy.MaxAttempts = 5
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 200 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.5,
+	}
+}
+
+// NoRetry returns a policy that gives up after the first failed attempt.
+// Example:
+//
+//	streamer := s3streamer.NewS3Streamer(client, s3streamer.WithRetryPolicy(s3streamer.NoRetry()))
+func NoRetry() RetryPolicy {
+	return RetryPolicy{MaxAttempts: 1}
+}
+
+// WithRetryPolicy sets the retry policy used for every ranged GetObject request.
+// Example:
+//
+//	streamer := s3streamer.NewChunkStreamer(ctx, client, "my-bucket", "data.json.gz", 0, size, 5*1024*1024,
+//	    s3streamer.WithRetryPolicy(s3streamer.DefaultRetryPolicy()))
+func WithRetryPolicy(policy RetryPolicy) ReaderOption {
+	return func(cfg *readerConfig) {
+		cfg.retry = policy
+	}
+}
+
+// IsRetryableError reports whether err is a transient failure worth retrying.
+// Connection resets, truncated bodies, throttling and 5xx responses are retryable;
+// cancellations and client errors are not.
+// Example:
+//
+//	policy := s3streamer.DefaultRetryPolicy()
+//	policy.Retryable = func(err error) bool {
+//	    return s3streamer.IsRetryableError(err) || errors.Is(err, errMyTransient)
+//	}
+func IsRetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	return retry.IsErrorRetryables(retry.DefaultRetryables).IsErrorRetryable(err) == aws.TrueTernary
+}
+
+// retryable applies the policy's classifier.
+func (p RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsRetryableError(err)
+}
+
+// backoff returns the delay to wait before the nth retry (1 for the first retry).
+func (p RetryPolicy) backoff(n int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+
+	delay := float64(p.InitialBackoff)
+	for i := 1; i < n; i++ {
+		delay *= multiplier
+		if p.MaxBackoff > 0 && delay >= float64(p.MaxBackoff) {
+			break
+		}
+	}
+	if p.MaxBackoff > 0 && delay > float64(p.MaxBackoff) {
+		delay = float64(p.MaxBackoff)
+	}
+
+	jitter := p.Jitter
+	if jitter > 1 {
+		jitter = 1
+	}
+	if jitter > 0 {
+		delay -= delay * jitter * rand.Float64()
+	}
+	return time.Duration(delay)
+}
+
+// sleep waits for d or until ctx is done, whichever happens first.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
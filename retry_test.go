@@ -0,0 +1,273 @@
+package s3streamer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// truncatedBody yields data and then fails with err, like a connection reset mid-body.
+type truncatedBody struct {
+	data []byte
+	err  error
+}
+
+func (b *truncatedBody) Read(p []byte) (int, error) {
+	if len(b.data) == 0 {
+		return 0, b.err
+	}
+	n := copy(p, b.data)
+	b.data = b.data[n:]
+	return n, nil
+}
+
+func (b *truncatedBody) Close() error { return nil }
+
+// flakyMockS3Client serves ranges from MockS3Client but fails the first failures
+// GetObject calls, either outright (getErr) or by cutting the body short after cut bytes.
+type flakyMockS3Client struct {
+	*MockS3Client
+	failures int
+	getErr   error
+	cut      int
+	bodyErr  error
+
+	mu     sync.Mutex
+	ranges []string
+}
+
+func (m *flakyMockS3Client) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	// Like the SDK, a cancelled context fails the request
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	m.ranges = append(m.ranges, *params.Range)
+	fail := m.failures > 0
+	if fail {
+		m.failures--
+	}
+	m.mu.Unlock()
+
+	if fail && m.getErr != nil {
+		return nil, m.getErr
+	}
+
+	resp, err := m.MockS3Client.GetObject(ctx, params, optFns...)
+	if err != nil || !fail {
+		return resp, err
+	}
+
+	data, _ := io.ReadAll(resp.Body)
+	if m.cut < len(data) {
+		data = data[:m.cut]
+	}
+	resp.Body = &truncatedBody{data: data, err: m.bodyErr}
+	return resp, nil
+}
+
+// fastRetryPolicy retries quickly so tests don't sleep.
+func fastRetryPolicy(attempts int) RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    attempts,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     2 * time.Millisecond,
+	}
+}
+
+func TestChunkStreamerRetryResumesTruncatedBody(t *testing.T) {
+	testData := bytes.Repeat([]byte("0123456789"), 10) // 100 bytes
+	client := &flakyMockS3Client{
+		MockS3Client: NewMockS3Client(testData),
+		failures:     1,
+		cut:          40,
+		bodyErr:      syscall.ECONNRESET,
+	}
+
+	streamer := NewChunkStreamer(context.Background(), client, "test-bucket", "test-key", 0, int64(len(testData)), 100,
+		WithRetryPolicy(fastRetryPolicy(3)))
+	defer streamer.Close()
+
+	result, err := io.ReadAll(streamer)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !bytes.Equal(result, testData) {
+		t.Errorf("Data mismatch. Expected %q, got %q", testData, result)
+	}
+
+	// The retry must only ask for the bytes that were not received
+	want := []string{"bytes=0-99", "bytes=40-99"}
+	if len(client.ranges) != len(want) {
+		t.Fatalf("Requested ranges = %v, want %v", client.ranges, want)
+	}
+	for i := range want {
+		if client.ranges[i] != want[i] {
+			t.Errorf("Range %d = %q, want %q", i, client.ranges[i], want[i])
+		}
+	}
+}
+
+func TestChunkStreamerRetryShortBodyWithoutError(t *testing.T) {
+	testData := []byte("a body that ends early without reporting an error")
+	client := &flakyMockS3Client{
+		MockS3Client: NewMockS3Client(testData),
+		failures:     2,
+		cut:          10,
+		bodyErr:      io.EOF,
+	}
+
+	streamer := NewChunkStreamer(context.Background(), client, "test-bucket", "test-key", 0, int64(len(testData)), 1024,
+		WithRetryPolicy(fastRetryPolicy(3)))
+	defer streamer.Close()
+
+	result, err := io.ReadAll(streamer)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !bytes.Equal(result, testData) {
+		t.Errorf("Data mismatch. Expected %q, got %q", testData, result)
+	}
+	if got, want := len(client.ranges), 3; got != want {
+		t.Errorf("GetObject call count = %d, want %d", got, want)
+	}
+	if got, want := client.ranges[2], fmt.Sprintf("bytes=20-%d", len(testData)-1); got != want {
+		t.Errorf("Final range = %q, want %q", got, want)
+	}
+}
+
+func TestChunkStreamerRetryGivesUp(t *testing.T) {
+	testData := []byte("never delivered")
+	client := &flakyMockS3Client{
+		MockS3Client: NewMockS3Client(testData),
+		failures:     10,
+		getErr:       fmt.Errorf("read: %w", syscall.ECONNRESET),
+	}
+
+	streamer := NewChunkStreamer(context.Background(), client, "test-bucket", "test-key", 0, int64(len(testData)), 1024,
+		WithRetryPolicy(fastRetryPolicy(4)))
+	defer streamer.Close()
+
+	_, err := io.ReadAll(streamer)
+	if err == nil {
+		t.Fatal("Expected error after exhausting retries")
+	}
+	if !strings.Contains(err.Error(), "gave up after 4 attempts") {
+		t.Errorf("Expected attempt count in error, got %v", err)
+	}
+	if !errors.Is(err, syscall.ECONNRESET) {
+		t.Errorf("Expected wrapped ECONNRESET, got %v", err)
+	}
+	if got, want := len(client.ranges), 4; got != want {
+		t.Errorf("GetObject call count = %d, want %d", got, want)
+	}
+}
+
+func TestChunkStreamerRetrySkipsPermanentErrors(t *testing.T) {
+	testData := []byte("never delivered")
+	client := &flakyMockS3Client{
+		MockS3Client: NewMockS3Client(testData),
+		failures:     10,
+		getErr:       errors.New("access denied"),
+	}
+
+	streamer := NewChunkStreamer(context.Background(), client, "test-bucket", "test-key", 0, int64(len(testData)), 1024,
+		WithRetryPolicy(fastRetryPolicy(5)))
+	defer streamer.Close()
+
+	if _, err := io.ReadAll(streamer); err == nil {
+		t.Fatal("Expected error for permanent failure")
+	}
+	if got, want := len(client.ranges), 1; got != want {
+		t.Errorf("GetObject call count = %d, want %d", got, want)
+	}
+}
+
+func TestChunkStreamerRetryCustomClassifier(t *testing.T) {
+	errFlaky := errors.New("flaky backend")
+	testData := []byte("delivered on the second attempt")
+	client := &flakyMockS3Client{
+		MockS3Client: NewMockS3Client(testData),
+		failures:     1,
+		getErr:       errFlaky,
+	}
+
+	policy := fastRetryPolicy(2)
+	policy.Retryable = func(err error) bool { return errors.Is(err, errFlaky) }
+
+	streamer := NewChunkStreamer(context.Background(), client, "test-bucket", "test-key", 0, int64(len(testData)), 1024,
+		WithRetryPolicy(policy))
+	defer streamer.Close()
+
+	result, err := io.ReadAll(streamer)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !bytes.Equal(result, testData) {
+		t.Errorf("Data mismatch. Expected %q, got %q", testData, result)
+	}
+}
+
+func TestIsRetryableError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"unexpected EOF", fmt.Errorf("body: %w", io.ErrUnexpectedEOF), true},
+		{"connection reset", fmt.Errorf("read: %w", syscall.ECONNRESET), true},
+		{"cancelled", context.Canceled, false},
+		{"deadline", fmt.Errorf("wrapped: %w", context.DeadlineExceeded), false},
+		{"generic", errors.New("access denied"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryableError(tt.err); got != tt.want {
+				t.Errorf("IsRetryableError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+		Multiplier:     2,
+	}
+
+	want := []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second,
+		time.Second,
+	}
+	for i, w := range want {
+		if got := policy.backoff(i + 1); got != w {
+			t.Errorf("backoff(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+
+	// Jitter only ever shortens the delay
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		got := policy.backoff(2)
+		if got < 100*time.Millisecond || got > 200*time.Millisecond {
+			t.Fatalf("Jittered backoff = %v, want within [100ms, 200ms]", got)
+		}
+	}
+}
@@ -2,11 +2,11 @@
 package s3streamer
 
 import (
-	"bufio"
 	"context"
 	"fmt"
 	"io"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 )
 
@@ -22,6 +22,10 @@ type S3Client interface {
 	UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error)
 	CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error)
 	AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error)
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	ListParts(ctx context.Context, params *s3.ListPartsInput, optFns ...func(*s3.Options)) (*s3.ListPartsOutput, error)
+	GetObjectAttributes(ctx context.Context, params *s3.GetObjectAttributesInput, optFns ...func(*s3.Options)) (*s3.GetObjectAttributesOutput, error)
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
 }
 
 // Streamer interface defines the contract for streaming data from S3.
@@ -45,22 +49,83 @@ type Streamer interface {
 type S3Streamer struct {
 	client    S3Client
 	chunkSize int64 // Size of each chunk to download
+	opts      []ReaderOption
 }
 
 // NewS3Streamer creates a new S3Streamer instance with configurable chunk size.
+// Reader options are applied to every ChunkStreamer created by Stream.
 // Example:
 //
 //	client := s3.NewFromConfig(cfg)
-//	streamer := s3streamer.NewS3Streamer(client)
-func NewS3Streamer(client S3Client) *S3Streamer {
+//	streamer := s3streamer.NewS3Streamer(client, s3streamer.WithReadConcurrency(4))
+func NewS3Streamer(client S3Client, opts ...ReaderOption) *S3Streamer {
 	return &S3Streamer{
 		client:    client,
 		chunkSize: 5 * 1024 * 1024, // 5MB chunks
+		opts:      opts,
 	}
 }
 
+// StreamOptions configures StreamWithOptions.
+// Example:
+//
+//	opts := s3streamer.StreamOptions{
+//	    Checkpoint:   previous, // nil to start from the beginning
+//	    OnCheckpoint: saveCheckpoint,
+//	}
+type StreamOptions struct {
+	// Offset is the byte offset in the object to start reading from. Non-zero offsets
+	// are only valid for uncompressed objects. Ignored when Checkpoint is set. With
+	// SeekIndex, it is a decompressed offset and streaming starts at the first line
+	// that starts at or after it.
+	Offset int64
+	// VersionID reads a specific version of the object instead of the current one.
+	VersionID string
+	// Checkpoint resumes a previous stream at the line where the checkpoint was taken.
+	Checkpoint *Checkpoint
+	// SeekIndex is the index of an object written with WithSeekableBlocks, from
+	// LoadSeekIndex. Reading starts at the block holding Offset or StartLine rather
+	// than at the start of the object. Cannot be combined with Checkpoint.
+	SeekIndex *SeekIndex
+	// StartLine is the 1-based number of the first line to stream. Requires SeekIndex.
+	StartLine int64
+	// OnCheckpoint receives a checkpoint roughly every CheckpointInterval decompressed
+	// bytes, after the callback has returned for every line before it. Returning an
+	// error stops the stream.
+	OnCheckpoint func(Checkpoint) error
+	// CheckpointInterval is the approximate number of decompressed bytes between
+	// checkpoints. Defaults to DefaultCheckpointInterval.
+	CheckpointInterval int64
+	// Framing splits the stream into records. Defaults to lines ending in LF or CRLF.
+	// Resume a stream with the framing it was read with.
+	Framing Framing
+	// MaxRecordSize is the largest frame, including its delimiter or length prefix,
+	// that is buffered whole. Defaults to DefaultMaxRecordSize; at least 64.
+	MaxRecordSize int
+	// OversizePolicy decides what happens to frames longer than MaxRecordSize.
+	// Defaults to FailOversizeRecords.
+	OversizePolicy OversizePolicy
+	// OnSkippedRecord is called for every record dropped by SkipOversizeRecords.
+	// Returning an error stops the stream.
+	OnSkippedRecord func(*RecordTooLargeError) error
+	// Workers is the number of goroutines that call fn. Above 1, records are copied
+	// and processed concurrently and out of order; fn must be safe for concurrent use.
+	// Defaults to calling fn serially on the reading goroutine.
+	Workers int
+	// OnCommit receives the committed offset: every record before it has been
+	// processed. It only moves forward, and checkpoints are emitted once it passes
+	// them. It runs on the reading goroutine. Returning an error stops the stream.
+	OnCommit func(offset int64) error
+
+	split *Split // Set by StreamSplit to bound the records delivered
+}
+
 // Stream downloads data from S3 in chunks, decompresses it if needed, and processes each line.
 // The callback function receives both the line data and its byte offset within the decompressed stream.
+// All range requests are pinned to the ETag and VersionId returned by HeadObject; if the object
+// is overwritten mid-stream, Stream fails with an *ObjectChangedError. With
+// WithChecksumVerification, Stream reads the object to the end and fails with a
+// *ChecksumMismatchError if it does not match its stored checksum.
 // Example:
 //
 //	streamer := s3streamer.NewS3Streamer(client)
@@ -69,12 +134,85 @@ func NewS3Streamer(client S3Client) *S3Streamer {
 //	    return nil
 //	})
 func (s *S3Streamer) Stream(ctx context.Context, bucket, key string, offset int64, fn func([]byte, int64) error) error {
+	return s.StreamWithOptions(ctx, bucket, key, StreamOptions{Offset: offset}, func(line []byte, lineOffset int64) error {
+		return fn(line, lineOffset-offset)
+	})
+}
+
+// StreamWithOptions is like Stream but can emit checkpoints and resume from one, which
+// works for gzip and bzip2 objects as well as uncompressed ones. Offsets passed to fn
+// are absolute positions in the decompressed stream, so they stay meaningful across resumes.
+// Example:
+//
+//	var last *s3streamer.Checkpoint
+//	err := streamer.StreamWithOptions(ctx, "my-bucket", "data.json.gz", s3streamer.StreamOptions{
+//	    OnCheckpoint: func(cp s3streamer.Checkpoint) error {
+//	        last = &cp
+//	        return nil
+//	    },
+//	}, processLine)
+//	if err != nil && last != nil {
+//	    // Retry later without reprocessing the lines before the checkpoint
+//	    err = streamer.StreamWithOptions(ctx, "my-bucket", "data.json.gz", s3streamer.StreamOptions{Checkpoint: last}, processLine)
+//	}
+func (s *S3Streamer) StreamWithOptions(ctx context.Context, bucket, key string, opts StreamOptions, fn func([]byte, int64) error) error {
+	return s.streamLines(ctx, bucket, key, opts, func(line Line) error {
+		return fn(line.Data, line.Offset)
+	})
+}
+
+// streamLines implements StreamWithOptions and Lines, passing fn every line with its
+// position.
+func (s *S3Streamer) streamLines(ctx context.Context, bucket, key string, opts StreamOptions, fn func(Line) error) error {
+	cfg := newReaderConfig(s.opts)
+	cp := opts.Checkpoint
+	if cp != nil {
+		if err := cp.validate(); err != nil {
+			return err
+		}
+	}
+	if cfg.decryption != nil && (cp != nil || opts.OnCheckpoint != nil) {
+		return fmt.Errorf("%w for client-side encrypted objects", errCheckpointsUnsupported)
+	}
+
+	// A seek index turns the requested position into a checkpoint at its block;
+	// the lines before the position are then skipped
+	var seekOffset int64
+	if idx := opts.SeekIndex; idx != nil {
+		if cp != nil || cfg.decryption != nil {
+			return fmt.Errorf("seek indexes cannot be combined with checkpoints or client-side encryption")
+		}
+		var block SeekBlock
+		var err error
+		if opts.StartLine > 0 {
+			block, err = idx.LocateLine(opts.StartLine)
+		} else {
+			block, err = idx.Locate(opts.Offset)
+		}
+		if err != nil {
+			return err
+		}
+		seekCheckpoint := idx.checkpoint(block)
+		cp, seekOffset = &seekCheckpoint, opts.Offset
+	} else if opts.StartLine != 0 {
+		return fmt.Errorf("StartLine requires a SeekIndex")
+	}
+	if opts.Workers > 1 && opts.OversizePolicy == FragmentOversizeRecords {
+		return fmt.Errorf("fragmented records cannot be processed by multiple workers")
+	}
 
 	// Get the object size first
-	headResp, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+	headInput := &s3.HeadObjectInput{
 		Bucket: &bucket,
 		Key:    &key,
-	})
+	}
+	if opts.VersionID != "" {
+		headInput.VersionId = &opts.VersionID
+	} else if cp != nil && cp.VersionID != "" {
+		headInput.VersionId = &cp.VersionID // Resume the version the checkpoint was taken from
+	}
+	cfg.customerKey.apply(&headInput.SSECustomerAlgorithm, &headInput.SSECustomerKey, &headInput.SSECustomerKeyMD5)
+	headResp, err := s.client.HeadObject(ctx, headInput)
 	if err != nil {
 		return fmt.Errorf("failed to get object metadata: %w", err)
 	}
@@ -88,84 +226,250 @@ func (s *S3Streamer) Stream(ctx context.Context, bucket, key string, offset int6
 		return fmt.Errorf("object is empty")
 	}
 
+	offset := opts.Offset
+	if opts.split != nil {
+		if err := objectChanged(bucket, key, opts.split.ETag, opts.split.VersionID, headResp); err != nil {
+			return err
+		}
+		if opts.split.Start >= totalSize {
+			return nil // The split lies past the end of the object
+		}
+	}
+	if cp != nil {
+		if err := cp.objectChanged(bucket, key, headResp); err != nil {
+			return err
+		}
+		offset = cp.CompressedOffset
+		if cp.Compression == Uncompressed && offset >= totalSize {
+			return nil // The checkpoint was taken after the last line
+		}
+	}
+
 	if offset >= totalSize {
 		return fmt.Errorf("offset %d exceeds object size %d", offset, totalSize)
 	}
 
-	// Get a small sample to detect compression type
-	detectionChunkSize := int64(512) // 512 bytes should be enough to detect compression
-	endOffset := offset + detectionChunkSize - 1
-	if endOffset >= totalSize {
-		endOffset = totalSize - 1
+	// Encrypted objects are read from the start of the chunk holding the offset
+	readOffset := offset
+	var header *EncryptionHeader
+	var chunkStart int64
+	if cfg.decryption != nil {
+		header, err = s.readEncryptionHeader(ctx, bucket, key, totalSize, headResp)
+		if err != nil {
+			return err
+		}
+		chunkStart, readOffset = header.ChunkStart(offset)
+		if readOffset >= totalSize {
+			return fmt.Errorf("offset %d exceeds the encrypted object", offset)
+		}
 	}
 
-	rangeHeader := fmt.Sprintf("bytes=%d-%d", offset, endOffset)
-	resp, err := s.client.GetObject(ctx, &s3.GetObjectInput{
-		Bucket: &bucket,
-		Key:    &key,
-		Range:  &rangeHeader,
-	})
-	if err != nil {
-		return fmt.Errorf("failed to download detection chunk (%s): %w", rangeHeader, err)
+	// Create the streamer up front so the detection request shares its retry policy
+	// and is pinned to the same object version as every later range request
+	remainingSize := totalSize - readOffset
+	chunkStreamer := NewChunkStreamer(ctx, s.client, bucket, key, readOffset, remainingSize, s.chunkSize, s.readerOptions(headResp)...)
+	if chunkStreamer == nil {
+		return fmt.Errorf("failed to create chunk streamer: invalid parameters")
 	}
+	defer chunkStreamer.Close()
 
-	// Read just enough to detect compression
-	sampleData := make([]byte, 512)
-	n, err := io.ReadAtLeast(resp.Body, sampleData, 1)
-	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
-		resp.Body.Close()
-		return fmt.Errorf("failed to read sample data: %w", err)
-	}
-	sampleData = sampleData[:n]
+	var compression Compression
+	if cp != nil {
+		// A checkpoint usually points into the middle of the compressed data
+		compression = cp.Compression
+	} else if header == nil {
+		// Get a small sample to detect compression type. Splits start anywhere, so
+		// check that the object is uncompressed at its start.
+		detectionOffset := offset
+		if opts.split != nil {
+			detectionOffset = 0
+		}
+		detectionChunkSize := int64(512) // 512 bytes should be enough to detect compression
+		endOffset := detectionOffset + detectionChunkSize - 1
+		if endOffset >= totalSize {
+			endOffset = totalSize - 1
+		}
 
-	// Close the detection response as we'll create a new stream from the beginning
-	resp.Body.Close()
+		sampleData, err := chunkStreamer.fetchRange(ctx, detectionOffset, endOffset)
+		if err != nil {
+			return fmt.Errorf("failed to download detection chunk: %w", err)
+		}
 
-	// Detect compression from the sample (for logging/debugging purposes)
-	compression := DetectCompression(sampleData)
+		// Detect compression from the sample (for logging/debugging purposes)
+		compression = DetectCompression(sampleData)
+		if opts.split != nil && compression != Uncompressed {
+			return fmt.Errorf("cannot split %s objects: compressed streams must be read from the start", compression)
+		}
+	}
 	compressionType := "none"
 	if compression != Uncompressed {
 		compressionType = compression.Extension()
 	}
 
-	// Start a fresh download from the offset
-	remainingSize := totalSize - offset
-	chunkStreamer := NewChunkStreamer(ctx, s.client, bucket, key, offset, remainingSize, s.chunkSize)
-	if chunkStreamer == nil {
-		return fmt.Errorf("failed to create chunk streamer: invalid parameters")
+	// Decompress the stream if needed, or pass through as-is. Checkpoints need a
+	// decoder that can report and restart at block boundaries.
+	var reader io.Reader
+	var source checkpointReader
+	currentOffset := offset
+	var lineNum int64
+	if cp != nil || opts.OnCheckpoint != nil {
+		source, err = newCheckpointReader(chunkStreamer, compression, offset, cp, opts.CheckpointInterval)
+		if err != nil {
+			return fmt.Errorf("failed to process data stream (type: %s): %w", compressionType, err)
+		}
+		reader = source
+
+		if cp != nil {
+			// Decoding restarts at the block boundary; skip to the line boundary
+			if _, err := io.CopyN(io.Discard, source, cp.Offset-cp.BlockOffset); err != nil {
+				return fmt.Errorf("failed to resume from checkpoint: %w", err)
+			}
+			currentOffset = cp.Offset
+			lineNum = cp.Line
+		}
+	} else if header != nil {
+		reader, err = s.decrypt(ctx, header, chunkStreamer, cfg.decryption, chunkStart, offset)
+		if err != nil {
+			return err
+		}
+	} else {
+		reader, err = Decompress(chunkStreamer)
+		if err != nil {
+			return fmt.Errorf("failed to process data stream (type: %s): %w", compressionType, err)
+		}
 	}
 
-	// Decompress the stream if needed, or pass through as-is
-	reader, err := Decompress(chunkStreamer)
+	// Process the file record by record, tracking the exact offset of every frame
+	scanner, err := newRecordScanner(reader, currentOffset, opts)
 	if err != nil {
-		// Clean up the chunk streamer if decompression fails
-		chunkStreamer.Close()
-		return fmt.Errorf("failed to process data stream (type: %s): %w", compressionType, err)
+		return err
 	}
 
-	// Process the file line by line with offset tracking
-	scanner := bufio.NewScanner(reader)
-	// Use a larger buffer size for better performance with large lines
-	scanner.Buffer(make([]byte, 1024*1024), 10*1024*1024) // 10MB max line size
+	var pool *linePool
+	if opts.Workers > 1 {
+		pool = newLinePool(opts.Workers, fn, opts.OnCommit, opts.OnCheckpoint)
+		defer pool.close()
+	}
 
-	var currentOffset int64 = 0
-	lineNum := 0
+	continued := false // The previous record was a fragment of the current one
+	skipping := false  // The record comes before the position of a seek index
 	for scanner.Scan() {
-		lineNum++
-		lineData := scanner.Bytes()
-		lineOffset := currentOffset
+		if opts.split != nil && !continued {
+			if scanner.start < opts.split.Start {
+				continue // The end of a record that the previous split delivers
+			}
+			if scanner.start >= opts.split.End {
+				break // The rest belongs to the next split
+			}
+		}
+		if !continued {
+			lineNum++
+			skipping = scanner.start < seekOffset || lineNum < opts.StartLine
+		}
+		continued = scanner.partial
+		currentOffset = scanner.end
+		if skipping {
+			continue
+		}
+
+		line := Line{Data: scanner.Bytes(), Offset: scanner.start, Number: lineNum, Partial: scanner.partial, CompressedPosition: scanner.start}
+		if header != nil || compression != Uncompressed {
+			line.CompressedPosition = chunkStreamer.position()
+		}
 
-		// Update offset for next line (include the line content + newline)
-		currentOffset += int64(len(lineData)) + 1 // +1 for newline character
+		// Checkpoints are only taken between records
+		var next *Checkpoint
+		if opts.OnCheckpoint != nil && !line.Partial {
+			if cp, ok := source.checkpoint(currentOffset); ok {
+				cp.ETag = aws.ToString(headResp.ETag)
+				cp.VersionID = aws.ToString(headResp.VersionId)
+				cp.Offset = currentOffset
+				cp.Line = lineNum
+				next = &cp
+			}
+		}
 
-		if err := fn(lineData, lineOffset); err != nil {
+		if pool != nil {
+			// The pool commits and emits the checkpoint once every line before it is done
+			if err := pool.submit(line, currentOffset, next); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := fn(line); err != nil {
 			return fmt.Errorf("error processing line %d: %w", lineNum, err)
 		}
+		if opts.OnCommit != nil && !line.Partial {
+			if err := opts.OnCommit(currentOffset); err != nil {
+				return fmt.Errorf("commit callback failed at offset %d: %w", currentOffset, err)
+			}
+		}
+		if next != nil {
+			if err := opts.OnCheckpoint(*next); err != nil {
+				return fmt.Errorf("checkpoint callback failed at line %d: %w", lineNum, err)
+			}
+		}
 	}
 
 	if err := scanner.Err(); err != nil {
 		return fmt.Errorf("error scanning lines: %w", err)
 	}
+	if pool != nil {
+		if err := pool.wait(); err != nil {
+			return err
+		}
+	}
+
+	// Decoders may stop before the end of the object; read the rest so that its
+	// checksum is compared. Splits only verify the parts they read.
+	if chunkStreamer.cfg.verifyChecksums && opts.split == nil {
+		if _, err := io.Copy(io.Discard, chunkStreamer); err != nil {
+			return fmt.Errorf("failed to verify object checksum: %w", err)
+		}
+	}
 
 	return nil
 }
+
+// readEncryptionHeader reads the client-side encryption header at the start of the
+// object described by head.
+func (s *S3Streamer) readEncryptionHeader(ctx context.Context, bucket, key string, totalSize int64, head *s3.HeadObjectOutput) (*EncryptionHeader, error) {
+	// The header is small; read it in small chunks rather than a full streaming chunk
+	headerStreamer := NewChunkStreamer(ctx, s.client, bucket, key, 0, totalSize, 4096, s.readerOptions(head)...)
+	if headerStreamer == nil {
+		return nil, fmt.Errorf("failed to create chunk streamer: invalid parameters")
+	}
+	defer headerStreamer.Close()
+
+	header, err := ReadEncryptionHeader(headerStreamer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client-side encryption header: %w", err)
+	}
+	return header, nil
+}
+
+// decrypt returns the decompressed plaintext of an encrypted object from offset. r is
+// positioned at the chunk that starts at plaintext offset chunkStart.
+func (s *S3Streamer) decrypt(ctx context.Context, header *EncryptionHeader, r io.Reader, provider KeyProvider, chunkStart, offset int64) (io.Reader, error) {
+	plaintext, err := header.NewReader(ctx, r, provider, chunkStart)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.CopyN(io.Discard, plaintext, offset-chunkStart); err != nil {
+		return nil, fmt.Errorf("failed to skip to offset %d: %w", offset, err)
+	}
+	reader, err := Decompress(plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to process decrypted data stream: %w", err)
+	}
+	return reader, nil
+}
+
+// readerOptions returns the streamer's reader options followed by a pin to the object
+// version described by head, so that all range requests read the same bytes.
+func (s *S3Streamer) readerOptions(head *s3.HeadObjectOutput) []ReaderOption {
+	opts := make([]ReaderOption, 0, len(s.opts)+1)
+	opts = append(opts, s.opts...)
+	return append(opts, WithObjectVersion(aws.ToString(head.ETag), aws.ToString(head.VersionId)))
+}
@@ -9,9 +9,11 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/klauspost/compress/zstd"
 )
 
 // TestData represents a simple test record structure
@@ -66,16 +68,72 @@ func prepareTestData(t testing.TB, count int, compression Compression) []byte {
 		return compressedBuf.Bytes()
 	}
 
+	// Compress with zstd
+	if compression == Zstd {
+		var compressedBuf bytes.Buffer
+		zw, err := zstd.NewWriter(&compressedBuf)
+		if err != nil {
+			t.Fatalf("Failed to create zstd writer: %v", err)
+		}
+		if _, err := zw.Write(buf.Bytes()); err != nil {
+			t.Fatalf("Failed to compress with zstd: %v", err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatalf("Failed to close zstd writer: %v", err)
+		}
+		return compressedBuf.Bytes()
+	}
+
 	t.Fatalf("Unsupported compression type: %v", compression)
 	return nil
 }
 
+// sizedTestData returns exactly size bytes of deterministic text lines; the last line
+// is cut short unless it happens to fit.
+func sizedTestData(size int64) []byte {
+	data := make([]byte, 0, size+64)
+	for i := 0; int64(len(data)) < size; i++ {
+		data = fmt.Appendf(data, "line %d of the test object\n", i)
+	}
+	return data[:size]
+}
+
 // MockS3Client implements a mock S3 client that supports range requests
 type MockS3Client struct {
 	data          []byte
 	contentLength int64
+	etag          string // Optional ETag reported by HeadObject and enforced via If-Match
+	versionID     string // Optional VersionId reported by HeadObject and GetObject
 	getCallCount  int
 	headCallCount int
+	mu            sync.Mutex // Guards the call counters and object state for concurrent readers
+}
+
+// preconditionFailedError mimics the HTTP 412 error S3 returns when If-Match fails
+type preconditionFailedError struct{}
+
+func (preconditionFailedError) Error() string {
+	return "api error PreconditionFailed: At least one of the pre-conditions you specified did not hold"
+}
+
+func (preconditionFailedError) HTTPStatusCode() int { return 412 }
+
+// setObject replaces the mock object's contents and identity, simulating an overwrite
+func (m *MockS3Client) setObject(data []byte, etag, versionID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data = data
+	m.contentLength = int64(len(data))
+	m.etag = etag
+	m.versionID = versionID
+}
+
+// optionalString returns nil for empty strings, matching how S3 omits absent headers
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
 }
 
 // NewMockS3Client creates a new mock S3 client with the given data
@@ -88,38 +146,52 @@ func NewMockS3Client(data []byte) *MockS3Client {
 
 // GetObject implements the S3Client interface
 func (m *MockS3Client) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	m.mu.Lock()
 	m.getCallCount++
+	data, contentLength, etag, versionID := m.data, m.contentLength, m.etag, m.versionID
+	m.mu.Unlock()
+
+	if params.IfMatch != nil && etag != "" && *params.IfMatch != etag {
+		return nil, preconditionFailedError{}
+	}
 
 	// Parse range if specified
-	var start, end int64 = 0, m.contentLength - 1
+	var start, end int64 = 0, contentLength - 1
 	if params.Range != nil {
 		var parseErr error
-		start, end, parseErr = parseRangeHeader(*params.Range, m.contentLength)
+		start, end, parseErr = parseRangeHeader(*params.Range, contentLength)
 		if parseErr != nil {
 			return nil, parseErr
 		}
 	}
 
 	// Validate range
-	if start < 0 || start >= m.contentLength || end < start || end >= m.contentLength {
-		return nil, fmt.Errorf("invalid range: %d-%d (content length: %d)", start, end, m.contentLength)
+	if start < 0 || start >= contentLength || end < start || end >= contentLength {
+		return nil, fmt.Errorf("invalid range: %d-%d (content length: %d)", start, end, contentLength)
 	}
 
 	// Extract data for this range
-	rangeData := m.data[start : end+1]
+	rangeData := data[start : end+1]
 	rangeLength := int64(len(rangeData))
 
 	return &s3.GetObjectOutput{
 		Body:          io.NopCloser(bytes.NewReader(rangeData)),
 		ContentLength: &rangeLength,
+		ETag:          optionalString(etag),
+		VersionId:     optionalString(versionID),
 	}, nil
 }
 
 // HeadObject implements the S3Client interface
 func (m *MockS3Client) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.headCallCount++
+	contentLength := m.contentLength
 	return &s3.HeadObjectOutput{
-		ContentLength: &m.contentLength,
+		ContentLength: &contentLength,
+		ETag:          optionalString(m.etag),
+		VersionId:     optionalString(m.versionID),
 	}, nil
 }
 
@@ -143,6 +215,26 @@ func (m *MockS3Client) AbortMultipartUpload(ctx context.Context, params *s3.Abor
 	return nil, fmt.Errorf("AbortMultipartUpload not implemented in mock reader client")
 }
 
+// PutObject implements the S3Client interface (not used in reader tests)
+func (m *MockS3Client) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	return nil, fmt.Errorf("PutObject not implemented in mock reader client")
+}
+
+// ListParts implements the S3Client interface (not used in reader tests)
+func (m *MockS3Client) ListParts(ctx context.Context, params *s3.ListPartsInput, optFns ...func(*s3.Options)) (*s3.ListPartsOutput, error) {
+	return nil, fmt.Errorf("ListParts not implemented in mock reader client")
+}
+
+// GetObjectAttributes implements the S3Client interface (not used in reader tests)
+func (m *MockS3Client) GetObjectAttributes(ctx context.Context, params *s3.GetObjectAttributesInput, optFns ...func(*s3.Options)) (*s3.GetObjectAttributesOutput, error) {
+	return nil, fmt.Errorf("GetObjectAttributes not implemented in mock reader client")
+}
+
+// ListObjectsV2 implements the S3Client interface (not used in reader tests)
+func (m *MockS3Client) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	return nil, fmt.Errorf("ListObjectsV2 not implemented in mock reader client")
+}
+
 // parseRangeHeader parses S3 range header formats like "bytes=0-499" or "bytes=500-"
 func parseRangeHeader(rangeHeader string, contentLength int64) (int64, int64, error) {
 	var start, end int64
@@ -279,6 +371,33 @@ func TestS3StreamerGzipped(t *testing.T) {
 	}
 }
 
+func TestS3StreamerZstd(t *testing.T) {
+	testData := prepareTestData(t, 50, Zstd)
+	mockClient := NewMockS3Client(testData)
+	streamer := NewS3Streamer(mockClient)
+	streamer.chunkSize = 256
+
+	var records []TestData
+	err := streamer.Stream(context.Background(), "test-bucket", "test-key", 0, func(line []byte, offset int64) error {
+		var record TestData
+		if err := json.Unmarshal(line, &record); err != nil {
+			return err
+		}
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if got, want := len(records), 50; got != want {
+		t.Fatalf("Record count = %d, want %d", got, want)
+	}
+	if got, want := records[49].ID, "id-0049"; got != want {
+		t.Errorf("Last record ID = %s, want %s", got, want)
+	}
+}
+
 func TestS3StreamerWithOffset(t *testing.T) {
 	// Prepare a larger set of test data
 	testData := prepareTestData(t, 100, Uncompressed)
@@ -3,10 +3,12 @@ package s3streamer
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"fmt"
 	"sort"
 	"sync"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
@@ -19,15 +21,82 @@ func min(a, b int64) int64 {
 	return b
 }
 
+// WriterOption configures optional behaviour of S3Writer and CompressedS3Writer.
+// Example:
+//
+//	writer, err := s3streamer.NewCompressedS3Writer(ctx, client, "my-bucket", "output.json.zst", 5*1024*1024,
+//	    s3streamer.Zstd, s3streamer.WithCompressionLevel(19))
+type WriterOption func(*writerConfig)
+
+// writerConfig holds the settings shared by S3Writer and CompressedS3Writer.
+type writerConfig struct {
+	compressionLevel    int                     // Codec-specific level, only used when compressionLevelSet
+	compressionLevelSet bool                    // False means each codec's default level
+	uploadConcurrency   int                     // Parts uploaded in parallel; 1 uploads synchronously
+	checksum            types.ChecksumAlgorithm // Empty sends no checksums
+	object              ObjectOptions           // Settings of the created object
+	kms                 *KMSEncryption          // SSE-KMS settings, if set
+	customerKey         *CustomerKey            // SSE-C key, if set
+	encryption          KeyProvider             // Client-side encryption, if set
+	seekBlockSize       int                     // Seekable gzip block size, 0 for a single stream
+}
+
+// newWriterConfig applies opts on top of the defaults.
+func newWriterConfig(opts []WriterOption) writerConfig {
+	cfg := writerConfig{uploadConcurrency: 1}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&cfg)
+		}
+	}
+	return cfg
+}
+
+// WithCompressionLevel sets the compression level used by CompressedS3Writer. The
+// meaning depends on the codec: gzip accepts -2 (Huffman only) to 9, bzip2 accepts
+// 1 to 9 and zstd accepts the zstd command line levels 1 to 22. Invalid levels are
+// reported by NewCompressedS3Writer. S3Writer ignores this option.
+// Example:
+//
+//	writer, err := s3streamer.NewCompressedS3Writer(ctx, client, "my-bucket", "output.json.gz", 5*1024*1024,
+//	    s3streamer.Gzip, s3streamer.WithCompressionLevel(gzip.BestCompression))
+func WithCompressionLevel(level int) WriterOption {
+	return func(cfg *writerConfig) {
+		cfg.compressionLevel = level
+		cfg.compressionLevelSet = true
+	}
+}
+
+// WithUploadConcurrency sets how many parts S3Writer uploads in parallel. Full parts are
+// handed to background uploads and Write continues filling the next part, so the
+// producer only waits when n uploads are already in flight. Memory usage is bounded by
+// (n+1) × partSize. Close waits for every in-flight part before completing the upload.
+// Values of 1 or less upload each part synchronously, which is the default.
+// Example:
+//
+//	writer, err := s3streamer.NewS3Writer(ctx, client, "my-bucket", "output.json", 8*1024*1024,
+//	    s3streamer.WithUploadConcurrency(4))
+func WithUploadConcurrency(n int) WriterOption {
+	return func(cfg *writerConfig) {
+		if n < 1 {
+			n = 1
+		}
+		cfg.uploadConcurrency = n
+	}
+}
+
 // S3Writer implements io.Writer for streaming data to S3 using multipart uploads.
 // It automatically handles multipart upload creation, part uploads, and completion.
+// The multipart upload only starts once a full part has been written; smaller
+// outputs, including empty ones, are stored with a single PutObject request on Close.
 //
 // Thread Safety: S3Writer is safe for concurrent use by multiple goroutines.
 // All methods are protected by an internal mutex.
 //
 // Memory Usage: The writer maintains an internal buffer that grows up to the
 // configured part size before uploading. Memory usage is proportional to the
-// part size, not the total data size.
+// part size, not the total data size. With WithUploadConcurrency(n) up to n
+// further parts may be held while they upload.
 //
 // Error Handling: Once an error occurs, the writer becomes unusable and all
 // subsequent operations will return the same error. Use Abort() to clean up
@@ -48,6 +117,7 @@ type S3Writer struct {
 	key        string
 	partSize   int64
 	ctx        context.Context
+	cfg        writerConfig
 	uploadID   *string
 	buffer     *bytes.Buffer
 	partNumber int32
@@ -55,10 +125,24 @@ type S3Writer struct {
 	mu         sync.Mutex
 	closed     bool
 	err        error
+
+	// Background part uploads, used when uploadConcurrency > 1
+	uploadCtx    context.Context
+	uploadCancel context.CancelFunc
+	uploadSlots  chan struct{} // Holds a token per in-flight part
+	uploads      sync.WaitGroup
+	partsMu      sync.Mutex       // Guards parts, partBytes and uploadErr while uploads are in flight
+	partBytes    map[int32]int64  // Size of each uploaded part, for State
+	partSums     map[int32][]byte // Raw checksum of each uploaded part, with WithChecksum
+	uploadErr    error            // First background upload failure
+
+	objectChecksum ObjectChecksum // Set by a successful Close, with WithChecksum
+	etag           string         // ETag of the object, set by a successful Close
 }
 
 // NewS3Writer creates a new S3Writer for uploading data to S3 using multipart uploads.
 // The writer will buffer data until it reaches partSize bytes, then upload a part.
+// No request is made until the first part is full or the writer is closed.
 //
 // Parameters:
 //   - ctx: Context for request lifecycle and cancellation
@@ -66,15 +150,15 @@ type S3Writer struct {
 //   - bucket: S3 bucket name (must not be empty)
 //   - key: S3 object key (must not be empty)
 //   - partSize: Size of each part in bytes (minimum 5MiB, automatically adjusted)
+//   - opts: Optional WriterOption values
 //
-// Returns an error if required parameters are invalid or if the initial
-// multipart upload creation fails.
+// Returns an error if required parameters are invalid.
 //
 // Example:
 //
 //	writer := s3streamer.NewS3Writer(ctx, client, "my-bucket", "output.json.gz", 5*1024*1024)
 //	defer writer.Close()
-func NewS3Writer(ctx context.Context, client S3Client, bucket, key string, partSize int64) (*S3Writer, error) {
+func NewS3Writer(ctx context.Context, client S3Client, bucket, key string, partSize int64, opts ...WriterOption) (*S3Writer, error) {
 	// Validate required parameters
 	if ctx == nil {
 		return nil, fmt.Errorf("context cannot be nil")
@@ -94,20 +178,33 @@ func NewS3Writer(ctx context.Context, client S3Client, bucket, key string, partS
 		return nil, fmt.Errorf("part size must be at least 5MiB (5242880 bytes), got %d bytes", partSize)
 	}
 
+	cfg := newWriterConfig(opts)
+	if err := validateChecksumAlgorithm(cfg.checksum); err != nil {
+		return nil, err
+	}
+	if cfg.kms != nil && cfg.customerKey != nil {
+		return nil, fmt.Errorf("SSE-KMS and SSE-C encryption cannot be combined")
+	}
+	if cfg.encryption != nil {
+		return nil, fmt.Errorf("client-side encryption requires NewEncryptedS3Writer or NewCompressedS3Writer")
+	}
+
 	writer := &S3Writer{
 		client:     client,
 		bucket:     bucket,
 		key:        key,
 		partSize:   partSize,
 		ctx:        ctx,
+		cfg:        cfg,
 		buffer:     bytes.NewBuffer(make([]byte, 0, min(partSize, 1024*1024))), // Cap initial buffer at 1MiB
 		partNumber: 1,
 		parts:      make([]types.CompletedPart, 0),
+		partBytes:  make(map[int32]int64),
+		partSums:   make(map[int32][]byte),
 	}
-
-	// Initiate multipart upload
-	if err := writer.initMultipartUpload(); err != nil {
-		return nil, fmt.Errorf("failed to initiate multipart upload: %w", err)
+	writer.uploadCtx, writer.uploadCancel = context.WithCancel(ctx)
+	if writer.cfg.uploadConcurrency > 1 {
+		writer.uploadSlots = make(chan struct{}, writer.cfg.uploadConcurrency)
 	}
 
 	return writer, nil
@@ -180,7 +277,9 @@ func (w *S3Writer) Write(p []byte) (int, error) {
 }
 
 // Close finalizes the multipart upload by uploading any remaining buffered data
-// and completing the multipart upload. This method must be called to ensure
+// and completing the multipart upload. If no part was uploaded yet, the buffered
+// data is stored with a single PutObject request instead, so closing a writer
+// without writes creates an empty object. This method must be called to ensure
 // all data is written to S3. The operation respects context cancellation.
 // Example:
 //
@@ -199,6 +298,7 @@ func (w *S3Writer) Close() error {
 	case <-w.ctx.Done():
 		if !w.closed {
 			w.closed = true
+			w.waitForUploads()
 			w.abortMultipartUpload() // Clean up on cancellation
 		}
 		return w.ctx.Err()
@@ -210,17 +310,35 @@ func (w *S3Writer) Close() error {
 	}
 
 	w.closed = true
+	defer w.uploadCancel() // Background uploads have all finished once Close returns
+
+	// Everything fits in a single part, so skip the multipart upload entirely
+	if w.uploadID == nil {
+		if err := w.putObject(); err != nil {
+			w.err = err
+			return err
+		}
+		return nil
+	}
 
 	// Upload any remaining data in the buffer
 	if w.buffer.Len() > 0 {
 		if err := w.uploadPart(); err != nil {
 			w.err = err
+			w.waitForUploads()
 			// Attempt to abort the multipart upload on error
 			w.abortMultipartUpload() // Ignore abort errors during cleanup
 			return err
 		}
 	}
 
+	// Wait for parts still uploading in the background
+	if err := w.waitForUploads(); err != nil {
+		w.err = err
+		w.abortMultipartUpload() // Ignore abort errors during cleanup
+		return err
+	}
+
 	// Complete the multipart upload
 	if err := w.completeMultipartUpload(); err != nil {
 		w.err = err
@@ -232,8 +350,9 @@ func (w *S3Writer) Close() error {
 	return nil
 }
 
-// Abort cancels the multipart upload and cleans up any uploaded parts.
-// This is useful for error handling or when you need to cancel an upload.
+// Abort cancels the multipart upload and cleans up any uploaded parts. Buffered data
+// that was never uploaded is discarded. This is useful for error handling or when you
+// need to cancel an upload.
 // Example:
 //
 //	writer := s3streamer.NewS3Writer(ctx, client, "my-bucket", "output.json.gz", 5*1024*1024)
@@ -250,15 +369,31 @@ func (w *S3Writer) Abort() error {
 		w.closed = true
 	}
 
+	// Stop background uploads so no part lands after the abort
+	w.uploadCancel()
+	w.uploads.Wait()
+	w.buffer.Reset()
+
 	return w.abortMultipartUpload()
 }
 
 // initMultipartUpload initiates a new multipart upload session
 func (w *S3Writer) initMultipartUpload() error {
-	resp, err := w.client.CreateMultipartUpload(w.ctx, &s3.CreateMultipartUploadInput{
+	input := &s3.CreateMultipartUploadInput{
 		Bucket: &w.bucket,
 		Key:    &w.key,
+	}
+	w.cfg.object.apply(createObjectFields(input))
+	w.cfg.applyEncryption(encryptionFields{
+		&input.ServerSideEncryption, &input.SSEKMSKeyId, &input.SSEKMSEncryptionContext, &input.BucketKeyEnabled,
+		&input.SSECustomerAlgorithm, &input.SSECustomerKey, &input.SSECustomerKeyMD5,
 	})
+	if w.cfg.checksum != "" {
+		input.ChecksumAlgorithm = w.cfg.checksum
+		input.ChecksumType = checksumType(w.cfg.checksum)
+	}
+
+	resp, err := w.client.CreateMultipartUpload(w.ctx, input)
 	if err != nil {
 		return fmt.Errorf("failed to create multipart upload: %w", err)
 	}
@@ -267,50 +402,176 @@ func (w *S3Writer) initMultipartUpload() error {
 	return nil
 }
 
-// uploadPart uploads the current buffer as a part and resets the buffer
+// uploadPart uploads the current buffer as a part and resets the buffer. With upload
+// concurrency the part is handed to a background upload once a slot is free.
 func (w *S3Writer) uploadPart() error {
 	if w.buffer.Len() == 0 {
 		return nil
 	}
 
+	// Surface failures of earlier background uploads
+	if err := w.backgroundErr(); err != nil {
+		return err
+	}
+
 	// AWS S3 has a maximum of 10,000 parts per multipart upload
 	if w.partNumber > 10000 {
 		return fmt.Errorf("exceeded maximum number of parts (10,000) for multipart upload")
 	}
 
-	// Create a copy of the buffer data
-	data := make([]byte, w.buffer.Len())
-	copy(data, w.buffer.Bytes())
+	// The first full part starts the multipart upload
+	if w.uploadID == nil {
+		if err := w.initMultipartUpload(); err != nil {
+			return fmt.Errorf("failed to initiate multipart upload: %w", err)
+		}
+	}
+
+	partNumber := w.partNumber
+	if w.uploadSlots == nil {
+		// Create a copy of the buffer data
+		data := make([]byte, w.buffer.Len())
+		copy(data, w.buffer.Bytes())
+		if err := w.putPart(w.ctx, partNumber, data); err != nil {
+			return err
+		}
 
+		// Reset buffer and increment part number for next part
+		w.buffer.Reset()
+		w.partNumber++
+		return nil
+	}
+
+	// Wait for a free upload slot; this bounds memory to (concurrency+1) parts
+	select {
+	case w.uploadSlots <- struct{}{}:
+	case <-w.uploadCtx.Done():
+		if err := w.backgroundErr(); err != nil {
+			return err
+		}
+		return w.uploadCtx.Err()
+	}
+
+	// Hand the buffer to the upload and continue in a fresh one
+	data := w.buffer.Bytes()
+	w.buffer = bytes.NewBuffer(make([]byte, 0, min(w.partSize, 1024*1024)))
+	w.partNumber++
+
+	w.uploads.Add(1)
+	go func() {
+		defer w.uploads.Done()
+		defer func() { <-w.uploadSlots }()
+
+		if err := w.putPart(w.uploadCtx, partNumber, data); err != nil {
+			w.partsMu.Lock()
+			if w.uploadErr == nil {
+				w.uploadErr = err
+			}
+			w.partsMu.Unlock()
+			w.uploadCancel() // Fail fast instead of finishing parts that cannot be completed
+		}
+	}()
+	return nil
+}
+
+// putPart uploads data as the given part and records it for completion.
+func (w *S3Writer) putPart(ctx context.Context, partNumber int32, data []byte) error {
 	contentLength := int64(len(data))
-	resp, err := w.client.UploadPart(w.ctx, &s3.UploadPartInput{
+	input := &s3.UploadPartInput{
 		Bucket:        &w.bucket,
 		Key:           &w.key,
-		PartNumber:    &w.partNumber,
+		PartNumber:    &partNumber,
 		UploadId:      w.uploadID,
 		Body:          bytes.NewReader(data),
 		ContentLength: &contentLength,
-	})
+	}
+	w.cfg.customerKey.apply(&input.SSECustomerAlgorithm, &input.SSECustomerKey, &input.SSECustomerKeyMD5)
+
+	// S3 verifies the checksum and rejects the part if the body was corrupted
+	var sum []byte
+	completed := types.CompletedPart{PartNumber: &partNumber}
+	if w.cfg.checksum != "" {
+		sum = computeChecksum(w.cfg.checksum, data)
+		encoded := base64.StdEncoding.EncodeToString(sum)
+		input.ChecksumAlgorithm = w.cfg.checksum
+		checksumFields{&input.ChecksumCRC32, &input.ChecksumCRC32C, &input.ChecksumCRC64NVME, &input.ChecksumSHA1, &input.ChecksumSHA256}.set(w.cfg.checksum, encoded)
+		checksumFields{&completed.ChecksumCRC32, &completed.ChecksumCRC32C, &completed.ChecksumCRC64NVME, &completed.ChecksumSHA1, &completed.ChecksumSHA256}.set(w.cfg.checksum, encoded)
+	}
+
+	resp, err := w.client.UploadPart(ctx, input)
 	if err != nil {
-		return fmt.Errorf("failed to upload part %d: %w", w.partNumber, err)
+		return fmt.Errorf("failed to upload part %d: %w", partNumber, err)
 	}
 
 	// Ensure we have a valid ETag
 	if resp.ETag == nil || *resp.ETag == "" {
-		return fmt.Errorf("received empty ETag for part %d", w.partNumber)
+		return fmt.Errorf("received empty ETag for part %d", partNumber)
+	}
+
+	// Store the completed part info; parts may finish out of order
+	completed.ETag = resp.ETag
+	w.partsMu.Lock()
+	w.parts = append(w.parts, completed)
+	w.partBytes[partNumber] = contentLength
+	if sum != nil {
+		w.partSums[partNumber] = sum
 	}
+	w.partsMu.Unlock()
+
+	return nil
+}
+
+// backgroundErr returns the first failure of a background part upload.
+func (w *S3Writer) backgroundErr() error {
+	w.partsMu.Lock()
+	defer w.partsMu.Unlock()
+	return w.uploadErr
+}
+
+// waitForUploads blocks until every background part upload has finished and returns
+// the first failure.
+func (w *S3Writer) waitForUploads() error {
+	w.uploads.Wait()
+	return w.backgroundErr()
+}
 
-	// Store the completed part info with current part number
-	currentPartNumber := w.partNumber
-	w.parts = append(w.parts, types.CompletedPart{
-		ETag:       resp.ETag,
-		PartNumber: &currentPartNumber,
+// putObject stores the buffered data as the whole object with a single request
+func (w *S3Writer) putObject() error {
+	data := w.buffer.Bytes()
+	contentLength := int64(len(data))
+	input := &s3.PutObjectInput{
+		Bucket:        &w.bucket,
+		Key:           &w.key,
+		Body:          bytes.NewReader(data),
+		ContentLength: &contentLength,
+	}
+	w.cfg.object.apply(putObjectFields(input))
+	w.cfg.applyEncryption(encryptionFields{
+		&input.ServerSideEncryption, &input.SSEKMSKeyId, &input.SSEKMSEncryptionContext, &input.BucketKeyEnabled,
+		&input.SSECustomerAlgorithm, &input.SSECustomerKey, &input.SSECustomerKeyMD5,
 	})
 
-	// Reset buffer and increment part number for next part
-	w.buffer.Reset()
-	w.partNumber++
+	var checksum string
+	if w.cfg.checksum != "" {
+		checksum = base64.StdEncoding.EncodeToString(computeChecksum(w.cfg.checksum, data))
+		input.ChecksumAlgorithm = w.cfg.checksum
+		checksumFields{&input.ChecksumCRC32, &input.ChecksumCRC32C, &input.ChecksumCRC64NVME, &input.ChecksumSHA1, &input.ChecksumSHA256}.set(w.cfg.checksum, checksum)
+	}
+
+	resp, err := w.client.PutObject(w.ctx, input)
+	if err != nil {
+		return fmt.Errorf("failed to put object: %w", err)
+	}
+	w.etag = aws.ToString(resp.ETag)
 
+	// A single request always yields a checksum of the whole object
+	if w.cfg.checksum != "" {
+		if reported := (checksumFields{&resp.ChecksumCRC32, &resp.ChecksumCRC32C, &resp.ChecksumCRC64NVME, &resp.ChecksumSHA1, &resp.ChecksumSHA256}).get(w.cfg.checksum); reported != "" {
+			checksum = reported
+		}
+		w.objectChecksum = ObjectChecksum{Algorithm: w.cfg.checksum, Type: types.ChecksumTypeFullObject, Value: checksum}
+	}
+
+	w.buffer.Reset()
 	return nil
 }
 
@@ -339,17 +600,44 @@ func (w *S3Writer) completeMultipartUpload() error {
 		}
 	}
 
-	_, err := w.client.CompleteMultipartUpload(w.ctx, &s3.CompleteMultipartUploadInput{
+	input := &s3.CompleteMultipartUploadInput{
 		Bucket:   &w.bucket,
 		Key:      &w.key,
 		UploadId: w.uploadID,
 		MultipartUpload: &types.CompletedMultipartUpload{
 			Parts: w.parts,
 		},
-	})
+	}
+	w.cfg.customerKey.apply(&input.SSECustomerAlgorithm, &input.SSECustomerKey, &input.SSECustomerKeyMD5)
+
+	// The expected object checksum lets S3 verify the assembled object
+	var checksum string
+	if w.cfg.checksum != "" {
+		sums := make([][]byte, len(w.parts))
+		sizes := make([]int64, len(w.parts))
+		for i, part := range w.parts {
+			sums[i] = w.partSums[*part.PartNumber]
+			sizes[i] = w.partBytes[*part.PartNumber]
+		}
+		checksum = combineChecksums(w.cfg.checksum, sums, sizes)
+		input.ChecksumType = checksumType(w.cfg.checksum)
+		if input.ChecksumType == types.ChecksumTypeFullObject {
+			checksumFields{&input.ChecksumCRC32, &input.ChecksumCRC32C, &input.ChecksumCRC64NVME, &input.ChecksumSHA1, &input.ChecksumSHA256}.set(w.cfg.checksum, checksum)
+		}
+	}
+
+	resp, err := w.client.CompleteMultipartUpload(w.ctx, input)
 	if err != nil {
 		return fmt.Errorf("failed to complete multipart upload with %d parts: %w", len(w.parts), err)
 	}
+	w.etag = aws.ToString(resp.ETag)
+
+	if w.cfg.checksum != "" {
+		if reported := (checksumFields{&resp.ChecksumCRC32, &resp.ChecksumCRC32C, &resp.ChecksumCRC64NVME, &resp.ChecksumSHA1, &resp.ChecksumSHA256}).get(w.cfg.checksum); reported != "" {
+			checksum = reported
+		}
+		w.objectChecksum = ObjectChecksum{Algorithm: w.cfg.checksum, Type: checksumType(w.cfg.checksum), Value: checksum}
+	}
 
 	return nil
 }
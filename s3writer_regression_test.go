@@ -72,8 +72,8 @@ func TestS3Writer_PartNumberIncrement(t *testing.T) {
 			name:          "single part smaller than part size",
 			dataSize:      3 * 1024 * 1024, // 3MB
 			partSize:      5 * 1024 * 1024, // 5MB
-			expectedParts: 1,
-			description:   "Tests the original bug scenario - single part upload",
+			expectedParts: 0,
+			description:   "Tests the original bug scenario - stored with a single PutObject",
 		},
 		{
 			name:          "exactly part size",
@@ -100,7 +100,7 @@ func TestS3Writer_PartNumberIncrement(t *testing.T) {
 			name:          "minimum part size with small data",
 			dataSize:      1024 * 1024,     // 1MB
 			partSize:      5 * 1024 * 1024, // 5MB (minimum)
-			expectedParts: 1,
+			expectedParts: 0,
 			description:   "Small data with minimum part size",
 		},
 	}
@@ -114,6 +114,7 @@ func TestS3Writer_PartNumberIncrement(t *testing.T) {
 			completionPartNumbers = nil
 			mock.uploadedParts = make(map[int32][]byte)
 			mock.completed = false
+			mock.putObject = false
 
 			// Create writer
 			writer, err := NewS3Writer(ctx, mock, "test-bucket", "test-key", tc.partSize)
@@ -139,6 +140,17 @@ func TestS3Writer_PartNumberIncrement(t *testing.T) {
 				t.Fatalf("Failed to close writer: %v", err)
 			}
 
+			// Payloads smaller than a part skip the multipart upload
+			if tc.expectedParts == 0 {
+				if !mock.putObject || mock.completed || len(uploadedPartNumbers) != 0 {
+					t.Fatal("Expected a single PutObject without a multipart upload")
+				}
+				if !bytes.Equal(testData, mock.GetUploadedData()) {
+					t.Error("Stored data does not match original data")
+				}
+				return
+			}
+
 			// Verify the upload was completed
 			if !mock.completed {
 				t.Fatal("Upload was not completed")
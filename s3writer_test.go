@@ -5,10 +5,16 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
 // mockS3ClientWriter extends the existing mock to support writer operations
@@ -19,12 +25,19 @@ type mockS3ClientWriter struct {
 	uploadPartFunc              func(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error)
 	completeMultipartUploadFunc func(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error)
 	abortMultipartUploadFunc    func(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error)
+	putObjectFunc               func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	listPartsFunc               func(ctx context.Context, params *s3.ListPartsInput, optFns ...func(*s3.Options)) (*s3.ListPartsOutput, error)
 
 	// Storage for uploaded data
+	mu            sync.Mutex // Guards uploadedParts during concurrent part uploads
 	uploadedParts map[int32][]byte
 	uploadID      string
 	completed     bool
 	aborted       bool
+	putObject     bool // Set when the object was stored with a single PutObject
+
+	// Checksums sent with each part, returned by ListParts
+	partChecksums map[int32]types.Part
 }
 
 func (m *mockS3ClientWriter) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
@@ -64,7 +77,17 @@ func (m *mockS3ClientWriter) UploadPart(ctx context.Context, params *s3.UploadPa
 		return nil, err
 	}
 
+	m.mu.Lock()
 	m.uploadedParts[*params.PartNumber] = data
+	if m.partChecksums == nil {
+		m.partChecksums = make(map[int32]types.Part)
+	}
+	m.partChecksums[*params.PartNumber] = types.Part{
+		ChecksumCRC32C:    params.ChecksumCRC32C,
+		ChecksumCRC64NVME: params.ChecksumCRC64NVME,
+		ChecksumSHA256:    params.ChecksumSHA256,
+	}
+	m.mu.Unlock()
 	etag := fmt.Sprintf("\"etag-part-%d\"", *params.PartNumber)
 
 	return &s3.UploadPartOutput{
@@ -90,8 +113,63 @@ func (m *mockS3ClientWriter) AbortMultipartUpload(ctx context.Context, params *s
 	return &s3.AbortMultipartUploadOutput{}, nil
 }
 
+func (m *mockS3ClientWriter) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	if m.putObjectFunc != nil {
+		return m.putObjectFunc(ctx, params, optFns...)
+	}
+
+	data, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// Stored as part 1 so GetUploadedData works for both upload paths
+	m.mu.Lock()
+	m.uploadedParts = map[int32][]byte{1: data}
+	m.mu.Unlock()
+	m.putObject = true
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (m *mockS3ClientWriter) ListParts(ctx context.Context, params *s3.ListPartsInput, optFns ...func(*s3.Options)) (*s3.ListPartsOutput, error) {
+	if m.listPartsFunc != nil {
+		return m.listPartsFunc(ctx, params, optFns...)
+	}
+	if m.uploadID == "" || aws.ToString(params.UploadId) != m.uploadID {
+		return nil, fmt.Errorf("NoSuchUpload: upload %s does not exist", aws.ToString(params.UploadId))
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	resp := &s3.ListPartsOutput{UploadId: params.UploadId}
+	for number, data := range m.uploadedParts {
+		etag := fmt.Sprintf("\"etag-part-%d\"", number)
+		part := m.partChecksums[number]
+		part.PartNumber = aws.Int32(number)
+		part.ETag = aws.String(etag)
+		part.Size = aws.Int64(int64(len(data)))
+		resp.Parts = append(resp.Parts, part)
+	}
+	sort.Slice(resp.Parts, func(i, j int) bool {
+		return *resp.Parts[i].PartNumber < *resp.Parts[j].PartNumber
+	})
+	return resp, nil
+}
+
+func (m *mockS3ClientWriter) GetObjectAttributes(ctx context.Context, params *s3.GetObjectAttributesInput, optFns ...func(*s3.Options)) (*s3.GetObjectAttributesOutput, error) {
+	return nil, fmt.Errorf("GetObjectAttributes not implemented")
+}
+
+func (m *mockS3ClientWriter) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	return nil, fmt.Errorf("ListObjectsV2 not implemented")
+}
+
 // GetUploadedData returns all uploaded data concatenated in order
 func (m *mockS3ClientWriter) GetUploadedData() []byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	var result []byte
 	for i := int32(1); i <= int32(len(m.uploadedParts)); i++ {
 		if data, exists := m.uploadedParts[i]; exists {
@@ -126,8 +204,12 @@ func TestS3Writer_BasicWrite(t *testing.T) {
 		t.Fatalf("Failed to close writer: %v", err)
 	}
 
-	if !mock.completed {
-		t.Error("Multipart upload was not completed")
+	// Less than a part is stored with a single request
+	if !mock.putObject {
+		t.Error("Object was not stored with PutObject")
+	}
+	if mock.uploadID != "" {
+		t.Error("Multipart upload should not be started for a small payload")
 	}
 
 	uploadedData := mock.GetUploadedData()
@@ -225,9 +307,15 @@ func TestS3Writer_ErrorHandling(t *testing.T) {
 		},
 	}
 
-	_, err := NewS3Writer(ctx, mock, "test-bucket", "test-key", 5*1024*1024)
+	// The multipart upload starts with the first full part
+	writer, err := NewS3Writer(ctx, mock, "test-bucket", "test-key", 5*1024*1024)
+	if err != nil {
+		t.Fatalf("Failed to create S3Writer: %v", err)
+	}
+
+	_, err = writer.Write(bytes.Repeat([]byte("x"), 6*1024*1024))
 	if err == nil {
-		t.Fatal("Expected error when creating S3Writer with failing S3 client")
+		t.Fatal("Expected error when starting the multipart upload fails")
 	}
 
 	if !strings.Contains(err.Error(), "failed to initiate multipart upload") {
@@ -271,18 +359,23 @@ func TestS3Writer_CloseWithoutWrites(t *testing.T) {
 		t.Fatalf("Failed to create S3Writer: %v", err)
 	}
 
-	err = writer.Close()
-	if err == nil {
-		t.Fatal("Expected error when closing writer without writes, but got nil")
+	var putLength int64 = -1
+	mock.putObjectFunc = func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+		putLength = *params.ContentLength
+		return &s3.PutObjectOutput{}, nil
 	}
 
-	// Should get an error about no parts uploaded
-	if err.Error() != "no parts uploaded for multipart upload" {
-		t.Errorf("Expected 'no parts uploaded' error, got: %v", err)
+	// Closing without writes creates an empty object
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Failed to close writer without writes: %v", err)
 	}
 
-	if mock.completed {
-		t.Error("Multipart upload should not be completed when no data was written")
+	if putLength != 0 {
+		t.Errorf("Expected a zero-byte PutObject, got content length %d", putLength)
+	}
+
+	if mock.uploadID != "" || mock.completed {
+		t.Error("Multipart upload should not be used when no data was written")
 	}
 }
 
@@ -308,6 +401,42 @@ func TestS3Writer_Abort(t *testing.T) {
 		t.Fatalf("Failed to abort upload: %v", err)
 	}
 
+	// Nothing reached S3, so there is no multipart upload to abort
+	if mock.aborted {
+		t.Error("No multipart upload should have been started")
+	}
+
+	if mock.completed || mock.putObject {
+		t.Error("Object should not be stored after abort")
+	}
+
+	// Buffered data is discarded
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close after abort failed: %v", err)
+	}
+	if mock.putObject {
+		t.Error("Close after abort should not store the object")
+	}
+}
+
+func TestS3Writer_AbortStartedUpload(t *testing.T) {
+	ctx := context.Background()
+	mock := &mockS3ClientWriter{}
+
+	writer, err := NewS3Writer(ctx, mock, "test-bucket", "test-key", 5*1024*1024)
+	if err != nil {
+		t.Fatalf("Failed to create S3Writer: %v", err)
+	}
+
+	// A full part starts the multipart upload
+	if _, err := writer.Write(bytes.Repeat([]byte("x"), 6*1024*1024)); err != nil {
+		t.Fatalf("Failed to write data: %v", err)
+	}
+
+	if err := writer.Abort(); err != nil {
+		t.Fatalf("Failed to abort upload: %v", err)
+	}
+
 	if !mock.aborted {
 		t.Error("Multipart upload was not aborted")
 	}
@@ -317,6 +446,34 @@ func TestS3Writer_Abort(t *testing.T) {
 	}
 }
 
+func TestS3Writer_PutObjectError(t *testing.T) {
+	ctx := context.Background()
+	mock := &mockS3ClientWriter{
+		putObjectFunc: func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+			return nil, fmt.Errorf("simulated put error")
+		},
+	}
+
+	writer, err := NewS3Writer(ctx, mock, "test-bucket", "test-key", 5*1024*1024)
+	if err != nil {
+		t.Fatalf("Failed to create S3Writer: %v", err)
+	}
+
+	if _, err := writer.Write([]byte("small payload")); err != nil {
+		t.Fatalf("Failed to write data: %v", err)
+	}
+
+	err = writer.Close()
+	if err == nil || !strings.Contains(err.Error(), "failed to put object") {
+		t.Fatalf("Expected put object error, got: %v", err)
+	}
+
+	// The error is sticky
+	if err2 := writer.Close(); err2 == nil {
+		t.Error("Expected second Close to return the error")
+	}
+}
+
 func TestS3Writer_WriteAfterClose(t *testing.T) {
 	ctx := context.Background()
 	mock := &mockS3ClientWriter{}
@@ -690,3 +847,184 @@ func BenchmarkS3WriterChunkedWrites(b *testing.B) {
 		})
 	}
 }
+
+func TestS3Writer_UploadConcurrency(t *testing.T) {
+	ctx := context.Background()
+	mock := &mockS3ClientWriter{}
+
+	var inFlight, maxInFlight atomic.Int32
+	mock.uploadPartFunc = func(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			seen := maxInFlight.Load()
+			if n <= seen || maxInFlight.CompareAndSwap(seen, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+
+		data, err := io.ReadAll(params.Body)
+		if err != nil {
+			return nil, err
+		}
+		mock.mu.Lock()
+		mock.uploadedParts[*params.PartNumber] = data
+		mock.mu.Unlock()
+		etag := fmt.Sprintf("\"etag-part-%d\"", *params.PartNumber)
+		return &s3.UploadPartOutput{ETag: &etag}, nil
+	}
+
+	var completedParts []int32
+	mock.completeMultipartUploadFunc = func(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+		// Every part must have finished before completion
+		if inFlight.Load() != 0 {
+			t.Error("CompleteMultipartUpload called with parts still in flight")
+		}
+		for _, part := range params.MultipartUpload.Parts {
+			completedParts = append(completedParts, *part.PartNumber)
+		}
+		mock.completed = true
+		return &s3.CompleteMultipartUploadOutput{}, nil
+	}
+
+	partSize := int64(5 * 1024 * 1024)
+	writer, err := NewS3Writer(ctx, mock, "test-bucket", "test-key", partSize, WithUploadConcurrency(3))
+	if err != nil {
+		t.Fatalf("Failed to create S3Writer: %v", err)
+	}
+
+	// Eight full parts and a short tail, written in uneven pieces
+	testData := make([]byte, 8*partSize+1234)
+	for i := range testData {
+		testData[i] = byte(i % 251)
+	}
+	for rest := testData; len(rest) > 0; {
+		n := min(int64(len(rest)), 3*1024*1024+17)
+		if _, err := writer.Write(rest[:n]); err != nil {
+			t.Fatalf("Failed to write data: %v", err)
+		}
+		rest = rest[n:]
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Failed to close writer: %v", err)
+	}
+
+	if !bytes.Equal(mock.GetUploadedData(), testData) {
+		t.Error("Uploaded data does not match written data")
+	}
+	if got := maxInFlight.Load(); got < 2 || got > 3 {
+		t.Errorf("Max parts in flight = %d, want 2 to 3", got)
+	}
+	if len(completedParts) != 9 {
+		t.Fatalf("Completed %d parts, want 9", len(completedParts))
+	}
+	for i, number := range completedParts {
+		if number != int32(i+1) {
+			t.Errorf("Completed part %d has number %d", i, number)
+		}
+	}
+}
+
+func TestS3Writer_UploadConcurrencyBoundsBufferedParts(t *testing.T) {
+	ctx := context.Background()
+	mock := &mockS3ClientWriter{}
+
+	release := make(chan struct{})
+	var started atomic.Int32
+	mock.uploadPartFunc = func(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+		started.Add(1)
+		<-release
+		etag := fmt.Sprintf("\"etag-part-%d\"", *params.PartNumber)
+		return &s3.UploadPartOutput{ETag: &etag}, nil
+	}
+
+	partSize := int64(5 * 1024 * 1024)
+	writer, err := NewS3Writer(ctx, mock, "test-bucket", "test-key", partSize, WithUploadConcurrency(2))
+	if err != nil {
+		t.Fatalf("Failed to create S3Writer: %v", err)
+	}
+
+	// Two parts upload in the background and a third fills the buffer
+	part := make([]byte, partSize)
+	for i := 0; i < 2; i++ {
+		if _, err := writer.Write(part); err != nil {
+			t.Fatalf("Failed to write part %d: %v", i+1, err)
+		}
+	}
+	if _, err := writer.Write(part[:partSize-1]); err != nil {
+		t.Fatalf("Failed to fill buffer: %v", err)
+	}
+
+	// Completing the third part needs a free slot, so Write must wait
+	done := make(chan error, 1)
+	go func() {
+		_, err := writer.Write([]byte{0})
+		done <- err
+	}()
+	select {
+	case <-done:
+		t.Fatal("Write did not wait for a free upload slot")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if got := started.Load(); got != 2 {
+		t.Errorf("Started %d uploads, want 2", got)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Failed to close writer: %v", err)
+	}
+	if !mock.completed {
+		t.Error("Expected multipart upload to be completed")
+	}
+}
+
+func TestS3Writer_UploadConcurrencyError(t *testing.T) {
+	ctx := context.Background()
+	mock := &mockS3ClientWriter{}
+
+	mock.uploadPartFunc = func(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+		if *params.PartNumber == 2 {
+			return nil, fmt.Errorf("simulated upload error")
+		}
+		select {
+		case <-time.After(10 * time.Millisecond):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		etag := fmt.Sprintf("\"etag-part-%d\"", *params.PartNumber)
+		return &s3.UploadPartOutput{ETag: &etag}, nil
+	}
+
+	partSize := int64(5 * 1024 * 1024)
+	writer, err := NewS3Writer(ctx, mock, "test-bucket", "test-key", partSize, WithUploadConcurrency(4))
+	if err != nil {
+		t.Fatalf("Failed to create S3Writer: %v", err)
+	}
+
+	// The failure surfaces from a later Write or from Close
+	part := make([]byte, partSize)
+	var writeErr error
+	for i := 0; i < 6 && writeErr == nil; i++ {
+		_, writeErr = writer.Write(part)
+	}
+	closeErr := writer.Close()
+
+	err = writeErr
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil || !strings.Contains(err.Error(), "failed to upload part 2") {
+		t.Fatalf("Expected part 2 upload error, got write error %v and close error %v", writeErr, closeErr)
+	}
+	if mock.completed {
+		t.Error("Upload should not be completed after a part failed")
+	}
+	if !mock.aborted {
+		t.Error("Expected multipart upload to be aborted")
+	}
+}
@@ -0,0 +1,289 @@
+package s3streamer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// DefaultSeekBlockSize is the uncompressed size of the blocks written with
+// WithSeekableBlocks when no size is given.
+const DefaultSeekBlockSize = 1024 * 1024
+
+// seekIndexVersion is the version of the SeekIndex format written by this package.
+const seekIndexVersion = 1
+
+// maxSeekIndexSize bounds the sidecar index read by LoadSeekIndex.
+const maxSeekIndexSize = 256 * 1024 * 1024
+
+// WithSeekableBlocks makes CompressedS3Writer write gzip output as a series of
+// independent gzip members of about blockSize uncompressed bytes, like BGZF. Every
+// member ends at a line boundary, so lines never span members; a line longer than
+// blockSize gets a member of its own. When the writer closes, a SeekIndex of the
+// members is uploaded next to the object, at SeekIndexKey(key). Any gzip reader can
+// still read the object from the start; with the index, StreamWithOptions starts at
+// any line or decompressed offset by reading from the member that holds it.
+//
+// Smaller blocks make seeking cheaper and compress worse. Blocks of 0 or less use
+// DefaultSeekBlockSize. Only Gzip supports seekable blocks, and not together with
+// client-side encryption.
+// Example:
+//
+//	writer, err := s3streamer.NewCompressedS3Writer(ctx, client, "my-bucket", "events.json.gz", 8*1024*1024,
+//	    s3streamer.Gzip, s3streamer.WithSeekableBlocks(256*1024))
+func WithSeekableBlocks(blockSize int) WriterOption {
+	return func(cfg *writerConfig) {
+		if blockSize <= 0 {
+			blockSize = DefaultSeekBlockSize
+		}
+		cfg.seekBlockSize = blockSize
+	}
+}
+
+// SeekIndexKey returns the key of the index uploaded with an object written with
+// WithSeekableBlocks.
+func SeekIndexKey(key string) string {
+	return key + ".idx"
+}
+
+// SeekIndex lists the independent gzip members of an object written with
+// WithSeekableBlocks. It is stored as JSON at SeekIndexKey of the object.
+type SeekIndex struct {
+	Version int `json:"version"`
+	// ETag is the ETag of the object the index describes, if S3 reported one.
+	// Streaming with an index of a different object version fails with an
+	// *ObjectChangedError.
+	ETag string `json:"etag,omitempty"`
+	// Size and DecompressedSize are the compressed and decompressed sizes of the object.
+	Size             int64 `json:"size"`
+	DecompressedSize int64 `json:"decompressed_size"`
+	// Blocks are the members in object order.
+	Blocks []SeekBlock `json:"blocks"`
+}
+
+// SeekBlock is a gzip member of a seekable object. The first line of every block
+// starts at its Offset.
+type SeekBlock struct {
+	// CompressedOffset is where the member starts in the object.
+	CompressedOffset int64 `json:"compressed_offset"`
+	// Offset is the decompressed offset of the first byte of the block.
+	Offset int64 `json:"offset"`
+	// Line is the number of lines before the block.
+	Line int64 `json:"line"`
+}
+
+// Locate returns the block holding the decompressed offset. Decompress the object from
+// the block's CompressedOffset and skip offset-Offset bytes to reach it, for example
+// with a ChunkStreamer and gzip.NewReader.
+func (idx *SeekIndex) Locate(offset int64) (SeekBlock, error) {
+	if offset < 0 || offset >= idx.DecompressedSize {
+		return SeekBlock{}, fmt.Errorf("offset %d is outside the decompressed size %d", offset, idx.DecompressedSize)
+	}
+	i := sort.Search(len(idx.Blocks), func(i int) bool { return idx.Blocks[i].Offset > offset })
+	return idx.Blocks[i-1], nil
+}
+
+// LocateLine returns the block holding the line with the 1-based number line.
+func (idx *SeekIndex) LocateLine(line int64) (SeekBlock, error) {
+	if line < 1 {
+		return SeekBlock{}, fmt.Errorf("invalid line number %d", line)
+	}
+	i := sort.Search(len(idx.Blocks), func(i int) bool { return idx.Blocks[i].Line >= line })
+	return idx.Blocks[i-1], nil
+}
+
+// validate rejects indexes that cannot describe a seekable object.
+func (idx *SeekIndex) validate() error {
+	if idx.Version != seekIndexVersion {
+		return fmt.Errorf("unsupported seek index version %d", idx.Version)
+	}
+	if len(idx.Blocks) == 0 || idx.Blocks[0] != (SeekBlock{}) {
+		return fmt.Errorf("invalid seek index: the first block must start the object")
+	}
+	for i := 1; i < len(idx.Blocks); i++ {
+		prev, block := idx.Blocks[i-1], idx.Blocks[i]
+		if block.CompressedOffset <= prev.CompressedOffset || block.Offset <= prev.Offset || block.Line < prev.Line {
+			return fmt.Errorf("invalid seek index: block %d does not follow block %d", i, i-1)
+		}
+	}
+	return nil
+}
+
+// checkpoint returns a checkpoint at the start of block.
+func (idx *SeekIndex) checkpoint(block SeekBlock) Checkpoint {
+	return Checkpoint{
+		Compression:      Gzip,
+		ETag:             idx.ETag,
+		CompressedOffset: block.CompressedOffset,
+		MemberStart:      true,
+		BlockOffset:      block.Offset,
+		Offset:           block.Offset,
+		Line:             block.Line,
+	}
+}
+
+// LoadSeekIndex reads the index of the seekable object at bucket/key from
+// SeekIndexKey(key).
+// Example:
+//
+//	idx, err := streamer.LoadSeekIndex(ctx, "my-bucket", "events.json.gz")
+//	if err != nil {
+//	    return err
+//	}
+//	err = streamer.StreamWithOptions(ctx, "my-bucket", "events.json.gz", s3streamer.StreamOptions{
+//	    SeekIndex: idx,
+//	    StartLine: 1_000_000,
+//	}, processLine)
+func (s *S3Streamer) LoadSeekIndex(ctx context.Context, bucket, key string) (*SeekIndex, error) {
+	indexKey := SeekIndexKey(key)
+	input := &s3.GetObjectInput{Bucket: &bucket, Key: &indexKey}
+	cfg := newReaderConfig(s.opts)
+	cfg.customerKey.apply(&input.SSECustomerAlgorithm, &input.SSECustomerKey, &input.SSECustomerKeyMD5)
+	resp, err := s.client.GetObject(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get seek index s3://%s/%s: %w", bucket, indexKey, err)
+	}
+	defer resp.Body.Close()
+
+	var idx SeekIndex
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxSeekIndexSize)).Decode(&idx); err != nil {
+		return nil, fmt.Errorf("failed to decode seek index s3://%s/%s: %w", bucket, indexKey, err)
+	}
+	if err := idx.validate(); err != nil {
+		return nil, err
+	}
+	return &idx, nil
+}
+
+// seekableGzipWriter compresses into independent gzip members that end at line
+// boundaries, recording where each one starts.
+type seekableGzipWriter struct {
+	out       io.Writer
+	gz        *gzip.Writer
+	blockSize int
+	buf       []byte // Uncompressed data of the next blocks
+	scanned   int    // Length of the start of buf known to hold no line end
+	index     SeekIndex
+	lines     int64 // Lines in the blocks written so far
+}
+
+// newSeekableGzipWriter returns a seekableGzipWriter that writes to w.
+func newSeekableGzipWriter(w io.Writer, level, blockSize int) (*seekableGzipWriter, error) {
+	sw := &seekableGzipWriter{blockSize: blockSize, index: SeekIndex{Version: seekIndexVersion}}
+	sw.out = writerFunc(func(p []byte) (int, error) {
+		n, err := w.Write(p)
+		sw.index.Size += int64(n)
+		return n, err
+	})
+	gz, err := newGzipWriter(sw.out, level)
+	if err != nil {
+		return nil, err
+	}
+	sw.gz = gz.(*gzip.Writer)
+	return sw, nil
+}
+
+// writerFunc adapts a function to io.Writer.
+type writerFunc func([]byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+// Write buffers p and writes every complete block. p is consumed even if writing a
+// block fails.
+func (sw *seekableGzipWriter) Write(p []byte) (int, error) {
+	sw.buf = append(sw.buf, p...)
+	for len(sw.buf) >= sw.blockSize {
+		// End the block after the last line that fits, or after the first line if
+		// none does. Bytes already scanned are not searched again, so a long line
+		// arriving in small writes is scanned once.
+		end := -1
+		if sw.scanned < sw.blockSize {
+			if i := bytes.LastIndexByte(sw.buf[sw.scanned:sw.blockSize], '\n'); i >= 0 {
+				end = sw.scanned + i + 1
+			}
+		}
+		if end < 0 {
+			from := max(sw.scanned, sw.blockSize)
+			i := bytes.IndexByte(sw.buf[from:], '\n')
+			if i < 0 {
+				sw.scanned = len(sw.buf)
+				break // Wait for the end of the line
+			}
+			end = from + i + 1
+		}
+		if err := sw.writeBlock(sw.buf[:end]); err != nil {
+			return len(p), err
+		}
+		sw.buf = sw.buf[:copy(sw.buf, sw.buf[end:])]
+		sw.scanned = 0
+	}
+	return len(p), nil
+}
+
+// writeBlock compresses data as one gzip member.
+func (sw *seekableGzipWriter) writeBlock(data []byte) error {
+	sw.index.Blocks = append(sw.index.Blocks, SeekBlock{
+		CompressedOffset: sw.index.Size,
+		Offset:           sw.index.DecompressedSize,
+		Line:             sw.lines,
+	})
+	sw.gz.Reset(sw.out)
+	if _, err := sw.gz.Write(data); err != nil {
+		return err
+	}
+	if err := sw.gz.Close(); err != nil {
+		return err
+	}
+	sw.index.DecompressedSize += int64(len(data))
+	sw.lines += int64(bytes.Count(data, []byte{'\n'}))
+	return nil
+}
+
+// Close writes the last block. Output with no data still gets an empty member, so
+// that it is valid gzip.
+func (sw *seekableGzipWriter) Close() error {
+	if len(sw.buf) > 0 || len(sw.index.Blocks) == 0 {
+		if err := sw.writeBlock(sw.buf); err != nil {
+			return err
+		}
+		sw.buf = nil
+	}
+	return nil
+}
+
+// uploadSeekIndex stores the index of a closed seekable object next to it.
+func (cw *CompressedS3Writer) uploadSeekIndex() error {
+	idx := cw.seekable.index
+	idx.ETag = cw.s3Writer.etag
+
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return fmt.Errorf("failed to encode seek index: %w", err)
+	}
+	w := cw.s3Writer
+	object := w.cfg.object
+	object.ContentType, object.ContentEncoding = "application/json", ""
+	indexWriter, err := NewS3Writer(w.ctx, w.client, w.bucket, SeekIndexKey(w.key), w.partSize, func(cfg *writerConfig) {
+		*cfg = w.cfg
+		cfg.object = object
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload seek index: %w", err)
+	}
+	if _, err := indexWriter.Write(data); err != nil {
+		indexWriter.Abort()
+		return fmt.Errorf("failed to upload seek index: %w", err)
+	}
+	if err := indexWriter.Close(); err != nil {
+		return fmt.Errorf("failed to upload seek index: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,298 @@
+package s3streamer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// seekableTestData returns lines that include one longer than the test block size.
+func seekableTestData() []byte {
+	data := checkpointTestLines(300)
+	return append(data, append(bytes.Repeat([]byte("x"), 700), "\nlast\n"...)...)
+}
+
+// seekableTestClient serves an object written with WithSeekableBlocks and its index,
+// recording the ranges requested from the object.
+type seekableTestClient struct {
+	*bucketTestClient
+	mu     sync.Mutex
+	ranges []string
+}
+
+func (c *seekableTestClient) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	if aws.ToString(params.Key) == "data.gz" {
+		c.mu.Lock()
+		c.ranges = append(c.ranges, aws.ToString(params.Range))
+		c.mu.Unlock()
+	}
+	return c.bucketTestClient.GetObject(ctx, params, optFns...)
+}
+
+// writeSeekableTestObject writes data to data.gz with WithSeekableBlocks and returns a
+// client serving the uploaded object and index.
+func writeSeekableTestObject(t *testing.T, data []byte, blockSize int) *seekableTestClient {
+	t.Helper()
+	uploads := map[string]*s3.PutObjectInput{}
+	bodies := map[string]string{}
+	mock := &mockS3ClientWriter{
+		putObjectFunc: func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+			body, err := io.ReadAll(params.Body)
+			if err != nil {
+				return nil, err
+			}
+			uploads[*params.Key], bodies[*params.Key] = params, string(body)
+			return &s3.PutObjectOutput{ETag: aws.String(fmt.Sprintf(`"etag-%d"`, len(body)))}, nil
+		},
+	}
+
+	writer, err := NewCompressedS3Writer(context.Background(), mock, "test-bucket", "data.gz", 5*1024*1024, Gzip, WithSeekableBlocks(blockSize))
+	if err != nil {
+		t.Fatalf("Failed to create writer: %v", err)
+	}
+	// Write in uneven pieces so that blocks do not follow the writes
+	for rest := data; len(rest) > 0; {
+		n := min(int64(len(rest)), 97)
+		if _, err := writer.Write(rest[:n]); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		rest = rest[n:]
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if got := aws.ToString(uploads["data.gz"].ContentEncoding); got != "gzip" {
+		t.Errorf("Object Content-Encoding = %q, want gzip", got)
+	}
+	index := uploads[SeekIndexKey("data.gz")]
+	if index == nil {
+		t.Fatal("The seek index was not uploaded")
+	}
+	if aws.ToString(index.ContentType) != "application/json" || index.ContentEncoding != nil {
+		t.Errorf("Index uploaded as %q with encoding %q", aws.ToString(index.ContentType), aws.ToString(index.ContentEncoding))
+	}
+
+	client := &seekableTestClient{bucketTestClient: newBucketTestClient(bodies)}
+	client.objects["data.gz"].etag = fmt.Sprintf(`"etag-%d"`, len(bodies["data.gz"]))
+	return client
+}
+
+func TestWithSeekableBlocks(t *testing.T) {
+	data := seekableTestData()
+	client := writeSeekableTestObject(t, data, 256)
+	object := client.objects["data.gz"].data
+
+	// Any gzip reader still reads the whole object
+	reader, err := gzip.NewReader(bytes.NewReader(object))
+	if err != nil {
+		t.Fatalf("Failed to open gzip stream: %v", err)
+	}
+	if decompressed, err := io.ReadAll(reader); err != nil || !bytes.Equal(decompressed, data) {
+		t.Fatalf("Decompressed %d bytes (%v), want %d", len(decompressed), err, len(data))
+	}
+
+	var idx SeekIndex
+	if err := json.Unmarshal(client.objects[SeekIndexKey("data.gz")].data, &idx); err != nil {
+		t.Fatalf("Failed to decode index: %v", err)
+	}
+	if idx.Size != int64(len(object)) || idx.DecompressedSize != int64(len(data)) || len(idx.Blocks) < 10 {
+		t.Fatalf("Index = %+v", idx)
+	}
+	if idx.ETag != client.objects["data.gz"].etag {
+		t.Errorf("Index ETag = %q, want %q", idx.ETag, client.objects["data.gz"].etag)
+	}
+
+	// Every block is a gzip member of whole lines
+	for i, block := range idx.Blocks {
+		end := idx.DecompressedSize
+		if i+1 < len(idx.Blocks) {
+			end = idx.Blocks[i+1].Offset
+		}
+		member, err := gzip.NewReader(bytes.NewReader(object[block.CompressedOffset:]))
+		if err != nil {
+			t.Fatalf("Block %d: %v", i, err)
+		}
+		member.Multistream(false)
+		got, err := io.ReadAll(member)
+		if err != nil || !bytes.Equal(got, data[block.Offset:end]) {
+			t.Fatalf("Block %d does not decompress to bytes [%d, %d): %v", i, block.Offset, end, err)
+		}
+		if !bytes.HasSuffix(got, []byte("\n")) || int64(bytes.Count(data[:block.Offset], []byte("\n"))) != block.Line {
+			t.Errorf("Block %d = %+v is not aligned to lines", i, block)
+		}
+		if end-block.Offset > 256 && bytes.Count(got, []byte("\n")) != 1 {
+			t.Errorf("Block %d holds %d bytes", i, end-block.Offset)
+		}
+	}
+}
+
+func TestSeekableGzipWriter_LongLine(t *testing.T) {
+	var out bytes.Buffer
+	sw, err := newSeekableGzipWriter(&out, gzip.DefaultCompression, 256)
+	if err != nil {
+		t.Fatalf("Failed to create writer: %v", err)
+	}
+
+	// While a long line is incomplete, each write only scans the new bytes
+	piece := bytes.Repeat([]byte("x"), 100)
+	for i := 0; i < 100; i++ {
+		if _, err := sw.Write(piece); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		if (len(sw.buf) >= 256 && sw.scanned != len(sw.buf)) || len(sw.index.Blocks) != 0 {
+			t.Fatalf("After %d writes: scanned %d of %d buffered bytes, %d blocks", i+1, sw.scanned, len(sw.buf), len(sw.index.Blocks))
+		}
+	}
+	if _, err := sw.Write([]byte("\nnext\n")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if len(sw.index.Blocks) != 1 || sw.index.DecompressedSize != 10001 || string(sw.buf) != "next\n" || sw.scanned != 0 {
+		t.Errorf("Index %+v, buffered %q, scanned %d", sw.index, sw.buf, sw.scanned)
+	}
+
+	// A failed block still consumes the write
+	failing, err := newSeekableGzipWriter(writerFunc(func(p []byte) (int, error) {
+		return 0, errors.New("upload failed")
+	}), gzip.DefaultCompression, 8)
+	if err != nil {
+		t.Fatalf("Failed to create writer: %v", err)
+	}
+	if n, err := failing.Write([]byte("one\ntwo\nthree\n")); err == nil || n != 14 {
+		t.Errorf("Write = %d, %v, want 14 and an error", n, err)
+	}
+}
+
+func TestWithSeekableBlocks_Empty(t *testing.T) {
+	client := writeSeekableTestObject(t, nil, 0)
+	reader, err := gzip.NewReader(bytes.NewReader(client.objects["data.gz"].data))
+	if err != nil {
+		t.Fatalf("Empty output is not gzip: %v", err)
+	}
+	if data, err := io.ReadAll(reader); err != nil || len(data) != 0 {
+		t.Errorf("Read %q, %v", data, err)
+	}
+}
+
+func TestStreamWithOptions_SeekIndex(t *testing.T) {
+	data := seekableTestData()
+	client := writeSeekableTestObject(t, data, 256)
+	streamer := NewS3Streamer(client)
+	streamer.chunkSize = 100
+	ctx := context.Background()
+
+	idx, err := streamer.LoadSeekIndex(ctx, "test-bucket", "data.gz")
+	if err != nil {
+		t.Fatalf("LoadSeekIndex failed: %v", err)
+	}
+	collect := func(opts StreamOptions) ([]Line, error) {
+		var lines []Line
+		err := streamer.streamLines(ctx, "test-bucket", "data.gz", opts, func(line Line) error {
+			line.Data = bytes.Clone(line.Data)
+			lines = append(lines, line)
+			return nil
+		})
+		return lines, err
+	}
+	all, err := collect(StreamOptions{})
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	format := func(lines []Line) string {
+		var b strings.Builder
+		for _, line := range lines {
+			fmt.Fprintf(&b, "%d@%d:%s\n", line.Number, line.Offset, line.Data)
+		}
+		return b.String()
+	}
+
+	block := idx.Blocks[len(idx.Blocks)/2]
+	for _, start := range []int64{1, 2, block.Line, block.Line + 1, block.Line + 2, int64(len(all)), int64(len(all)) + 5} {
+		client.ranges = nil
+		got, err := collect(StreamOptions{SeekIndex: idx, StartLine: start})
+		if err != nil {
+			t.Fatalf("StartLine %d: %v", start, err)
+		}
+		want := all[min(start-1, int64(len(all))):]
+		if format(got) != format(want) {
+			t.Errorf("StartLine %d: got %d lines, want %d", start, len(got), len(want))
+		}
+
+		// Reading begins at the member holding the line
+		located, _ := idx.LocateLine(start)
+		if prefix := fmt.Sprintf("bytes=%d-", located.CompressedOffset); len(client.ranges) == 0 || !strings.HasPrefix(client.ranges[0], prefix) {
+			t.Errorf("StartLine %d: requested %v, want a range from %d", start, client.ranges, located.CompressedOffset)
+		}
+	}
+
+	for _, offset := range []int64{0, 1, block.Offset, block.Offset + 1, idx.DecompressedSize - 1} {
+		got, err := collect(StreamOptions{SeekIndex: idx, Offset: offset})
+		if err != nil {
+			t.Fatalf("Offset %d: %v", offset, err)
+		}
+		var want []Line
+		for _, line := range all {
+			if line.Offset >= offset {
+				want = append(want, line)
+			}
+		}
+		if format(got) != format(want) {
+			t.Errorf("Offset %d: got %d lines, want %d", offset, len(got), len(want))
+		}
+	}
+}
+
+func TestStreamWithOptions_SeekIndexErrors(t *testing.T) {
+	client := writeSeekableTestObject(t, seekableTestData(), 256)
+	streamer := NewS3Streamer(client)
+	ctx := context.Background()
+	noop := func([]byte, int64) error { return nil }
+
+	idx, err := streamer.LoadSeekIndex(ctx, "test-bucket", "data.gz")
+	if err != nil {
+		t.Fatalf("LoadSeekIndex failed: %v", err)
+	}
+	for _, opts := range []StreamOptions{
+		{StartLine: 3},
+		{SeekIndex: idx, Offset: idx.DecompressedSize},
+		{SeekIndex: idx, Checkpoint: &Checkpoint{Compression: Gzip}},
+	} {
+		if err := streamer.StreamWithOptions(ctx, "test-bucket", "data.gz", opts, noop); err == nil {
+			t.Errorf("Expected error for %+v", opts)
+		}
+	}
+
+	// The index is pinned to the object it was written with
+	client.objects["data.gz"].setObject(client.objects["data.gz"].data, `"overwritten"`, "")
+	var changed *ObjectChangedError
+	if err := streamer.StreamWithOptions(ctx, "test-bucket", "data.gz", StreamOptions{SeekIndex: idx, StartLine: 5}, noop); !errors.As(err, &changed) {
+		t.Errorf("Expected *ObjectChangedError, got %v", err)
+	}
+
+	client.objects[SeekIndexKey("data.gz")].setObject([]byte(`{"version":2,"blocks":[{}]}`), "", "")
+	if _, err := streamer.LoadSeekIndex(ctx, "test-bucket", "data.gz"); err == nil {
+		t.Error("Expected an unsupported index version to be rejected")
+	}
+
+	// Only unencrypted gzip output can be seekable
+	if _, err := NewCompressedS3Writer(ctx, &mockS3ClientWriter{}, "test-bucket", "data", 5*1024*1024, Uncompressed, WithSeekableBlocks(0)); err == nil {
+		t.Error("Expected seekable uncompressed output to be rejected")
+	}
+	if _, err := NewCompressedS3Writer(ctx, &mockS3ClientWriter{}, "test-bucket", "data.zst", 5*1024*1024, Zstd, WithSeekableBlocks(0)); err == nil {
+		t.Error("Expected seekable zstd output to be rejected")
+	}
+	keys := testKeyProvider(t)
+	if _, err := NewCompressedS3Writer(ctx, &mockS3ClientWriter{}, "test-bucket", "data.gz", 5*1024*1024, Gzip, WithSeekableBlocks(0), WithClientSideEncryption(keys)); err == nil {
+		t.Error("Expected seekable encrypted output to be rejected")
+	}
+}
@@ -0,0 +1,137 @@
+package s3streamer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Split is a byte range of an uncompressed object that StreamSplit reads. Every record
+// belongs to the split its first byte falls in, so the splits of PlanSplits deliver
+// each record of the object exactly once between them. Splits are safe to serialize
+// with encoding/json and hand to other workers.
+type Split struct {
+	// Start and End are the byte range [Start, End) in which records start.
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+	// ETag and VersionID identify the object version the split was planned for.
+	// Streaming a different version fails with an *ObjectChangedError.
+	ETag      string `json:"etag,omitempty"`
+	VersionID string `json:"version_id,omitempty"`
+}
+
+// PlanSplits divides the uncompressed object at bucket/key into n byte ranges of
+// nearly equal size, pinned to its current version. Objects smaller than n bytes get
+// one split per byte. Compressed objects cannot be split and return an error.
+// Example:
+//
+//	splits, err := streamer.PlanSplits(ctx, "my-bucket", "events.jsonl", 64)
+//	if err != nil {
+//	    return err
+//	}
+//	for _, split := range splits {
+//	    queue.Send(split) // Each worker calls StreamSplit with one split
+//	}
+func (s *S3Streamer) PlanSplits(ctx context.Context, bucket, key string, n int) ([]Split, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("split count must be at least 1, got %d", n)
+	}
+	cfg := newReaderConfig(s.opts)
+	if cfg.decryption != nil {
+		return nil, fmt.Errorf("cannot split client-side encrypted objects")
+	}
+
+	headInput := &s3.HeadObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+	}
+	cfg.customerKey.apply(&headInput.SSECustomerAlgorithm, &headInput.SSECustomerKey, &headInput.SSECustomerKeyMD5)
+	headResp, err := s.client.HeadObject(ctx, headInput)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object metadata: %w", err)
+	}
+	if headResp.ContentLength == nil {
+		return nil, fmt.Errorf("content length is missing from object metadata")
+	}
+	size := *headResp.ContentLength
+	if size == 0 {
+		return nil, fmt.Errorf("object is empty")
+	}
+
+	// Check the object can be split before handing out work
+	chunkStreamer := NewChunkStreamer(ctx, s.client, bucket, key, 0, size, s.chunkSize, s.readerOptions(headResp)...)
+	if chunkStreamer == nil {
+		return nil, fmt.Errorf("failed to create chunk streamer: invalid parameters")
+	}
+	defer chunkStreamer.Close()
+	end := int64(511)
+	if end >= size {
+		end = size - 1
+	}
+	sample, err := chunkStreamer.fetchRange(ctx, 0, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download detection chunk: %w", err)
+	}
+	if compression := DetectCompression(sample); compression != Uncompressed {
+		return nil, fmt.Errorf("cannot split %s objects: compressed streams must be read from the start", compression)
+	}
+
+	if int64(n) > size {
+		n = int(size)
+	}
+	splits := make([]Split, n)
+	for i := range splits {
+		splits[i] = Split{
+			Start:     size * int64(i) / int64(n),
+			End:       size * int64(i+1) / int64(n),
+			ETag:      aws.ToString(headResp.ETag),
+			VersionID: aws.ToString(headResp.VersionId),
+		}
+	}
+	return splits, nil
+}
+
+// StreamSplit is like StreamWithOptions but only delivers the records that start inside
+// split, with Hadoop-style split semantics: unless the split starts the object, the
+// record in progress at split.Start is skipped because the previous split delivers it,
+// and the last record that starts before split.End is read to its end even if that lies
+// past the split. Offsets passed to fn are absolute positions in the object.
+//
+// Only line and delimited framings can be split, since their records can be found from
+// any byte. Oversized records are reported, skipped or failed only by the split they
+// start in. To resume an interrupted split, stream Split{Start: offset, End: split.End}
+// with an offset from OnCommit or a checkpoint. With WithChecksumVerification, only
+// the parts read by the split are verified.
+// Example:
+//
+//	err := streamer.StreamSplit(ctx, "my-bucket", "events.jsonl", split, s3streamer.StreamOptions{},
+//	    func(line []byte, offset int64) error {
+//	        return process(line)
+//	    })
+func (s *S3Streamer) StreamSplit(ctx context.Context, bucket, key string, split Split, opts StreamOptions, fn func([]byte, int64) error) error {
+	switch {
+	case split.Start < 0 || split.End < split.Start:
+		return fmt.Errorf("invalid split [%d, %d)", split.Start, split.End)
+	case opts.Offset != 0 || opts.VersionID != "" || opts.Checkpoint != nil || opts.SeekIndex != nil || opts.StartLine != 0:
+		return fmt.Errorf("offsets, versions, checkpoints and seek indexes are set by the split")
+	case opts.Framing.kind == jsonSeqFrames || opts.Framing.kind == lengthPrefixedFrames:
+		return fmt.Errorf("only line and delimited framings can be split")
+	case newReaderConfig(s.opts).decryption != nil:
+		return fmt.Errorf("cannot split client-side encrypted objects")
+	}
+	if split.Start == split.End {
+		return nil
+	}
+
+	opts.split = &split
+	opts.VersionID = split.VersionID
+	if split.Start > 0 {
+		// Read from the byte before the split so a record starting exactly at
+		// split.Start is recognized as whole
+		opts.Offset = split.Start - 1
+	}
+
+	return s.StreamWithOptions(ctx, bucket, key, opts, fn)
+}
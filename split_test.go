@@ -0,0 +1,199 @@
+package s3streamer
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// splitTestRecords streams every split of data and returns the records with their
+// offsets, in split order.
+func splitTestRecords(t *testing.T, client S3Client, n int, opts StreamOptions) ([]string, error) {
+	t.Helper()
+	streamer := NewS3Streamer(client)
+	streamer.chunkSize = 64
+
+	splits, err := streamer.PlanSplits(context.Background(), "test-bucket", "test-key", n)
+	if err != nil {
+		t.Fatalf("PlanSplits failed: %v", err)
+	}
+	var records []string
+	for _, split := range splits {
+		err := streamer.StreamSplit(context.Background(), "test-bucket", "test-key", split, opts, func(line []byte, offset int64) error {
+			// Fragments of an oversized record may continue past the split
+			if opts.OversizePolicy != FragmentOversizeRecords && (offset < split.Start || offset >= split.End) {
+				t.Errorf("Record at %d delivered by split [%d, %d)", offset, split.Start, split.End)
+			}
+			records = append(records, fmt.Sprintf("%d:%s", offset, line))
+			return nil
+		})
+		if err != nil {
+			return records, err
+		}
+	}
+	return records, nil
+}
+
+func TestStreamSplit(t *testing.T) {
+	lines := checkpointTestLines(300)
+	crlf := []byte(strings.ReplaceAll(string(lines[:len(lines)-1]), "\n", "\r\n")) // No final newline
+
+	for _, tt := range []struct {
+		name string
+		data []byte
+	}{
+		{"LF", lines},
+		{"CRLF", crlf},
+		{"blank lines", []byte("\n\na\n\nbb\n\n\nccc\n")},
+	} {
+		streamer := NewS3Streamer(NewMockS3Client(tt.data))
+		var want []string
+		err := streamer.StreamWithOptions(context.Background(), "test-bucket", "test-key", StreamOptions{}, func(line []byte, offset int64) error {
+			want = append(want, fmt.Sprintf("%d:%s", offset, line))
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Stream failed: %v", err)
+		}
+
+		for _, n := range []int{1, 2, 3, 7, 64, 500} {
+			got, err := splitTestRecords(t, NewMockS3Client(tt.data), n, StreamOptions{})
+			if err != nil {
+				t.Fatalf("%s, %d splits: %v", tt.name, n, err)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("%s, %d splits: got %d records, want %d", tt.name, n, len(got), len(want))
+			}
+		}
+	}
+}
+
+func TestStreamSplit_Oversize(t *testing.T) {
+	data, records, starts := oversizeTestData(DelimitedFraming(0))
+	framing := DelimitedFraming(0)
+
+	for _, n := range []int{2, 5, 9} {
+		var skipped []int64
+		got, err := splitTestRecords(t, NewMockS3Client(data), n, StreamOptions{
+			Framing:        framing,
+			MaxRecordSize:  100,
+			OversizePolicy: SkipOversizeRecords,
+			OnSkippedRecord: func(err *RecordTooLargeError) error {
+				skipped = append(skipped, err.Offset)
+				return nil
+			},
+		})
+		if err != nil {
+			t.Fatalf("%d splits: %v", n, err)
+		}
+		if len(got) != len(records)-1 || len(skipped) != 1 || skipped[0] != starts[2] {
+			t.Errorf("%d splits: records %q, skipped %v", n, got, skipped)
+		}
+
+		// Only the split the record starts in fails
+		_, err = splitTestRecords(t, NewMockS3Client(data), n, StreamOptions{Framing: framing, MaxRecordSize: 100})
+		var tooLarge *RecordTooLargeError
+		if !errors.As(err, &tooLarge) || tooLarge.Offset != starts[2] {
+			t.Errorf("%d splits: expected error at %d, got %v", n, starts[2], err)
+		}
+
+		got, err = splitTestRecords(t, NewMockS3Client(data), n, StreamOptions{
+			Framing:        framing,
+			MaxRecordSize:  100,
+			OversizePolicy: FragmentOversizeRecords,
+		})
+		if err != nil {
+			t.Fatalf("%d splits: %v", n, err)
+		}
+		if joined := strings.Join(got, ""); !strings.Contains(joined, records[2][:50]) || len(got) <= len(records) {
+			t.Errorf("%d splits: the oversized record was not fragmented: %q", n, got)
+		}
+	}
+}
+
+func TestStreamSplit_Resume(t *testing.T) {
+	data := checkpointTestLines(100)
+	streamer := NewS3Streamer(NewMockS3Client(data))
+	splits, err := streamer.PlanSplits(context.Background(), "test-bucket", "test-key", 2)
+	if err != nil {
+		t.Fatalf("PlanSplits failed: %v", err)
+	}
+
+	errStop := errors.New("stop")
+	var committed int64
+	var first []int64
+	err = streamer.StreamSplit(context.Background(), "test-bucket", "test-key", splits[1], StreamOptions{
+		OnCommit: func(offset int64) error {
+			committed = offset
+			return nil
+		},
+	}, func(line []byte, offset int64) error {
+		if len(first) == 10 {
+			return errStop
+		}
+		first = append(first, offset)
+		return nil
+	})
+	if !errors.Is(err, errStop) {
+		t.Fatalf("Expected stop, got %v", err)
+	}
+
+	resume := splits[1]
+	resume.Start = committed
+	var rest []int64
+	err = streamer.StreamSplit(context.Background(), "test-bucket", "test-key", resume, StreamOptions{}, func(line []byte, offset int64) error {
+		rest = append(rest, offset)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Resume failed: %v", err)
+	}
+	if len(rest) == 0 || rest[0] != committed || rest[0] <= first[len(first)-1] {
+		t.Errorf("Resumed at %v after committing %d", rest[:1], committed)
+	}
+}
+
+func TestStreamSplit_Errors(t *testing.T) {
+	ctx := context.Background()
+	compressed := compressForTest(t, checkpointTestLines(100), Gzip, gzip.DefaultCompression, 0)
+	streamer := NewS3Streamer(NewMockS3Client(compressed))
+	if _, err := streamer.PlanSplits(ctx, "test-bucket", "test-key", 4); err == nil {
+		t.Error("Expected PlanSplits to reject a gzip object")
+	}
+	noop := func([]byte, int64) error { return nil }
+	if err := streamer.StreamSplit(ctx, "test-bucket", "test-key", Split{Start: 100, End: 200}, StreamOptions{}, noop); err == nil {
+		t.Error("Expected StreamSplit to reject a gzip object")
+	}
+
+	client := NewMockS3Client(checkpointTestLines(100))
+	client.etag = `"v1"`
+	streamer = NewS3Streamer(client)
+	splits, err := streamer.PlanSplits(ctx, "test-bucket", "test-key", 3)
+	if err != nil {
+		t.Fatalf("PlanSplits failed: %v", err)
+	}
+	if splits[2].End != int64(len(client.data)) || splits[0].ETag != `"v1"` {
+		t.Errorf("Splits = %+v", splits)
+	}
+	client.setObject(checkpointTestLines(200), `"v2"`, "")
+	var changed *ObjectChangedError
+	if err := streamer.StreamSplit(ctx, "test-bucket", "test-key", splits[1], StreamOptions{}, noop); !errors.As(err, &changed) {
+		t.Errorf("Expected *ObjectChangedError, got %v", err)
+	}
+
+	for _, opts := range []StreamOptions{
+		{Offset: 5},
+		{Framing: LengthPrefixedFraming(VarintPrefix)},
+		{Framing: JSONSeqFraming()},
+	} {
+		if err := streamer.StreamSplit(ctx, "test-bucket", "test-key", Split{End: 10}, opts, noop); err == nil {
+			t.Errorf("Expected error for %+v", opts)
+		}
+	}
+	if _, err := streamer.PlanSplits(ctx, "test-bucket", "test-key", 0); err == nil {
+		t.Error("Expected error for zero splits")
+	}
+}
@@ -0,0 +1,117 @@
+package s3streamer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// DecodeErrorPolicy decides what StreamJSON does with a line that does not decode.
+type DecodeErrorPolicy int
+
+const (
+	// FailOnDecodeError stops the stream with a *DecodeError (the default).
+	FailOnDecodeError DecodeErrorPolicy = iota
+	// SkipDecodeErrors drops lines that do not decode and continues.
+	SkipDecodeErrors
+	// HandleDecodeErrors passes each *DecodeError to JSONOptions.OnDecodeError, which
+	// continues the stream by returning nil or stops it by returning an error.
+	HandleDecodeErrors
+)
+
+// DecodeError reports a line that could not be decoded by StreamJSON.
+type DecodeError struct {
+	Line   int64  // 1-based line number, counted from the start of the stream or checkpoint
+	Offset int64  // Offset of the line in the decompressed stream
+	Data   []byte // Copy of the line
+	Err    error  // Error returned by json.Unmarshal
+}
+
+// Error implements the error interface.
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("failed to decode line %d at offset %d: %v", e.Line, e.Offset, e.Err)
+}
+
+// Unwrap returns the underlying decoding error.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// JSONOptions configures StreamJSON.
+// Example:
+//
+//	opts := s3streamer.JSONOptions{
+//	    ErrorPolicy: s3streamer.HandleDecodeErrors,
+//	    OnDecodeError: func(err *s3streamer.DecodeError) error {
+//	        log.Printf("skipping bad record: %v", err)
+//	        return nil
+//	    },
+//	}
+type JSONOptions struct {
+	// StreamOptions selects where the stream starts and receives checkpoints.
+	StreamOptions
+	// ErrorPolicy decides what happens to lines that do not decode.
+	ErrorPolicy DecodeErrorPolicy
+	// OnDecodeError receives decode errors under HandleDecodeErrors.
+	OnDecodeError func(*DecodeError) error
+}
+
+// StreamJSON streams the JSON Lines object at bucket/key like StreamWithOptions and
+// decodes every line into a T before calling fn with it and the line's offset in the
+// decompressed stream. Blank lines are skipped. Lines that do not decode are handled
+// according to opts.ErrorPolicy.
+//
+// Lines are decoded straight from the scan buffer into a single T that is reset for
+// every line, so the only allocations per line are those json.Unmarshal needs for the
+// record's own strings, slices and maps. fn receives a copy of the record and may keep it.
+// With StreamOptions.Workers above 1, records are decoded on the workers, and fn and
+// OnDecodeError are called concurrently.
+// Example:
+//
+//	type Event struct {
+//	    ID   string `json:"id"`
+//	    Type string `json:"type"`
+//	}
+//
+//	err := s3streamer.StreamJSON(ctx, streamer, "my-bucket", "events.json.gz", s3streamer.JSONOptions{},
+//	    func(event Event, offset int64) error {
+//	        return process(event)
+//	    })
+//	var decodeErr *s3streamer.DecodeError
+//	if errors.As(err, &decodeErr) {
+//	    log.Printf("bad record on line %d at offset %d", decodeErr.Line, decodeErr.Offset)
+//	}
+func StreamJSON[T any](ctx context.Context, s *S3Streamer, bucket, key string, opts JSONOptions, fn func(record T, offset int64) error) error {
+	if opts.ErrorPolicy == HandleDecodeErrors && opts.OnDecodeError == nil {
+		return fmt.Errorf("HandleDecodeErrors requires an OnDecodeError handler")
+	}
+	if opts.OversizePolicy == FragmentOversizeRecords {
+		return fmt.Errorf("StreamJSON cannot decode fragmented records; skip or fail oversized records instead")
+	}
+
+	var zero, shared T
+	return s.streamLines(ctx, bucket, key, opts.StreamOptions, func(line Line) error {
+		if len(bytes.TrimSpace(line.Data)) == 0 {
+			return nil
+		}
+
+		// Workers decode concurrently, so only a serial stream can share one record
+		record := &shared
+		if opts.Workers > 1 {
+			record = new(T)
+		}
+		*record = zero
+		if err := json.Unmarshal(line.Data, record); err != nil {
+			if opts.ErrorPolicy == SkipDecodeErrors {
+				return nil
+			}
+			decodeErr := &DecodeError{Line: line.Number, Offset: line.Offset, Data: bytes.Clone(line.Data), Err: err}
+			if opts.ErrorPolicy == HandleDecodeErrors {
+				return opts.OnDecodeError(decodeErr)
+			}
+			return decodeErr
+		}
+		return fn(*record, line.Offset)
+	})
+}
@@ -0,0 +1,131 @@
+package s3streamer
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/dsnet/compress/bzip2"
+)
+
+type jsonTestRecord struct {
+	ID   int               `json:"id"`
+	Tags []string          `json:"tags"`
+	Meta map[string]string `json:"meta"`
+}
+
+const jsonTestLines = `{"id":1,"tags":["a"],"meta":{"k":"v"}}
+{"id":2}
+
+{"id":3,"tags":
+{"id":4,"tags":["b","c"]}
+`
+
+func TestStreamJSON_DecodesRecords(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"uncompressed", []byte(jsonTestLines)},
+		{"gzip", compressForTest(t, []byte(jsonTestLines), Gzip, gzip.DefaultCompression, 0)},
+		{"bzip2", compressForTest(t, []byte(jsonTestLines), Bzip2, bzip2.BestSpeed, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			streamer := NewS3Streamer(NewMockS3Client(tt.data))
+
+			var records []jsonTestRecord
+			var offsets []int64
+			err := StreamJSON(context.Background(), streamer, "test-bucket", "test-key", JSONOptions{ErrorPolicy: SkipDecodeErrors},
+				func(record jsonTestRecord, offset int64) error {
+					records = append(records, record)
+					offsets = append(offsets, offset)
+					return nil
+				})
+			if err != nil {
+				t.Fatalf("StreamJSON failed: %v", err)
+			}
+
+			if len(records) != 3 || records[0].ID != 1 || records[1].ID != 2 || records[2].ID != 4 {
+				t.Fatalf("Records = %+v", records)
+			}
+			// The record is reset between lines, so nothing leaks from the previous one
+			if records[1].Tags != nil || records[1].Meta != nil {
+				t.Errorf("Record 2 carries fields of record 1: %+v", records[1])
+			}
+			if records[2].Meta != nil || strings.Join(records[2].Tags, ",") != "b,c" {
+				t.Errorf("Record 4 = %+v", records[2])
+			}
+			if want := int64(strings.Index(jsonTestLines, `{"id":4`)); offsets[2] != want {
+				t.Errorf("Offset of record 4 = %d, want %d", offsets[2], want)
+			}
+		})
+	}
+}
+
+func TestStreamJSON_ErrorPolicies(t *testing.T) {
+	ctx := context.Background()
+	streamer := NewS3Streamer(NewMockS3Client([]byte(jsonTestLines)))
+	badOffset := int64(strings.Index(jsonTestLines, `{"id":3`))
+	count := func(n *int) func(jsonTestRecord, int64) error {
+		return func(jsonTestRecord, int64) error {
+			*n++
+			return nil
+		}
+	}
+
+	t.Run("fail", func(t *testing.T) {
+		var n int
+		err := StreamJSON(ctx, streamer, "test-bucket", "test-key", JSONOptions{}, count(&n))
+		var decodeErr *DecodeError
+		if !errors.As(err, &decodeErr) {
+			t.Fatalf("Expected *DecodeError, got %v", err)
+		}
+		if decodeErr.Line != 4 || decodeErr.Offset != badOffset || string(decodeErr.Data) != `{"id":3,"tags":` {
+			t.Errorf("DecodeError = line %d, offset %d, data %q", decodeErr.Line, decodeErr.Offset, decodeErr.Data)
+		}
+		if n != 2 {
+			t.Errorf("Processed %d records before failing, want 2", n)
+		}
+	})
+
+	t.Run("handler", func(t *testing.T) {
+		var n int
+		var reported []*DecodeError
+		err := StreamJSON(ctx, streamer, "test-bucket", "test-key", JSONOptions{
+			ErrorPolicy: HandleDecodeErrors,
+			OnDecodeError: func(err *DecodeError) error {
+				reported = append(reported, err)
+				return nil
+			},
+		}, count(&n))
+		if err != nil {
+			t.Fatalf("StreamJSON failed: %v", err)
+		}
+		if n != 3 || len(reported) != 1 || reported[0].Line != 4 || reported[0].Offset != badOffset {
+			t.Errorf("Processed %d records, reported %v", n, reported)
+		}
+	})
+
+	t.Run("handler stops", func(t *testing.T) {
+		errStop := fmt.Errorf("too many bad records")
+		err := StreamJSON(ctx, streamer, "test-bucket", "test-key", JSONOptions{
+			ErrorPolicy:   HandleDecodeErrors,
+			OnDecodeError: func(*DecodeError) error { return errStop },
+		}, func(jsonTestRecord, int64) error { return nil })
+		if !errors.Is(err, errStop) {
+			t.Errorf("Expected handler error, got %v", err)
+		}
+	})
+
+	t.Run("handler missing", func(t *testing.T) {
+		err := StreamJSON(ctx, streamer, "test-bucket", "test-key", JSONOptions{ErrorPolicy: HandleDecodeErrors},
+			func(jsonTestRecord, int64) error { return nil })
+		if err == nil {
+			t.Error("Expected error without an OnDecodeError handler")
+		}
+	})
+}
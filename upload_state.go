@@ -0,0 +1,228 @@
+package s3streamer
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// UploadState describes the committed progress of an S3Writer's multipart upload. It
+// is safe to serialize, for example as JSON, and is passed to ResumeS3Writer to
+// continue the upload in another process.
+// Example:
+//
+//	state := writer.State()
+//	data, _ := json.Marshal(state)
+//	os.WriteFile("upload.state", data, 0o600)
+type UploadState struct {
+	Bucket   string `json:"bucket"`
+	Key      string `json:"key"`
+	UploadID string `json:"upload_id,omitempty"` // Empty until the first part is uploaded
+	PartSize int64  `json:"part_size"`
+	// ChecksumAlgorithm is the algorithm set with WithChecksum, if any
+	ChecksumAlgorithm types.ChecksumAlgorithm `json:"checksum_algorithm,omitempty"`
+	// Parts are the uploaded parts, numbered from 1 without gaps
+	Parts []UploadedPart `json:"parts,omitempty"`
+	// BytesCommitted is the number of written bytes stored in Parts. A resumed writer
+	// expects the data that follows them.
+	BytesCommitted int64 `json:"bytes_committed"`
+}
+
+// UploadedPart is a part of a multipart upload that S3 has acknowledged.
+type UploadedPart struct {
+	PartNumber int32  `json:"part_number"`
+	ETag       string `json:"etag"`
+	Size       int64  `json:"size"`
+	Checksum   string `json:"checksum,omitempty"` // Base64 encoded, with WithChecksum
+}
+
+// State returns the writer's committed progress. Only parts S3 has acknowledged are
+// included, and when parts upload concurrently only the run of consecutive parts
+// starting at part 1, so BytesCommitted is always a prefix of the written data.
+// Buffered data that has not been uploaded yet is not part of the state. Persist the
+// state after writes to be able to resume with ResumeS3Writer.
+// Example:
+//
+//	if _, err := writer.Write(chunk); err != nil {
+//	    return err
+//	}
+//	saveState(writer.State())
+func (w *S3Writer) State() UploadState {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	state := UploadState{
+		Bucket:   w.bucket,
+		Key:      w.key,
+		UploadID: aws.ToString(w.uploadID),
+		PartSize: w.partSize,
+
+		ChecksumAlgorithm: w.cfg.checksum,
+	}
+
+	w.partsMu.Lock()
+	defer w.partsMu.Unlock()
+	parts := make([]types.CompletedPart, len(w.parts))
+	copy(parts, w.parts)
+
+	sort.Slice(parts, func(i, j int) bool {
+		return *parts[i].PartNumber < *parts[j].PartNumber
+	})
+	for i, part := range parts {
+		number := *part.PartNumber
+		if number != int32(i+1) {
+			break // An earlier part is still uploading
+		}
+		size := w.partBytes[number]
+		state.Parts = append(state.Parts, UploadedPart{
+			PartNumber: number,
+			ETag:       aws.ToString(part.ETag),
+			Size:       size,
+			Checksum:   encodeChecksum(w.partSums[number]),
+		})
+		state.BytesCommitted += size
+	}
+	return state
+}
+
+// ResumeS3Writer continues a multipart upload described by state, typically saved by
+// a process that exited before Close. The parts in the state are verified against
+// S3 with ListParts before the writer is returned. The checksum algorithm of the
+// original writer is carried over from the state. The caller must continue writing
+// at byte state.BytesCommitted of the original data; parts S3 holds beyond the
+// state are overwritten. A state without an upload ID starts a new upload, as
+// NewS3Writer does.
+//
+// Only S3Writer can be resumed. A CompressedS3Writer's compressor state is not
+// part of UploadState.
+//
+// Example:
+//
+//	writer, err := s3streamer.ResumeS3Writer(ctx, client, state)
+//	if err != nil {
+//	    return err
+//	}
+//	if _, err := file.Seek(state.BytesCommitted, io.SeekStart); err != nil {
+//	    return err
+//	}
+//	if _, err := io.Copy(writer, file); err != nil {
+//	    writer.Abort()
+//	    return err
+//	}
+//	return writer.Close()
+func ResumeS3Writer(ctx context.Context, client S3Client, state UploadState, opts ...WriterOption) (*S3Writer, error) {
+	if state.UploadID == "" && (len(state.Parts) > 0 || state.BytesCommitted != 0) {
+		return nil, fmt.Errorf("invalid upload state: parts recorded without an upload ID")
+	}
+
+	// Recorded parts must be consecutive and add up to the committed bytes
+	var committed int64
+	for i, part := range state.Parts {
+		if part.PartNumber != int32(i+1) {
+			return nil, fmt.Errorf("invalid upload state: part %d recorded at position %d", part.PartNumber, i+1)
+		}
+		if part.ETag == "" || part.Size <= 0 {
+			return nil, fmt.Errorf("invalid upload state: part %d has no ETag or size", part.PartNumber)
+		}
+		if state.ChecksumAlgorithm != "" {
+			if _, err := base64.StdEncoding.DecodeString(part.Checksum); err != nil || part.Checksum == "" {
+				return nil, fmt.Errorf("invalid upload state: part %d has no valid checksum", part.PartNumber)
+			}
+		}
+		committed += part.Size
+	}
+	if committed != state.BytesCommitted {
+		return nil, fmt.Errorf("invalid upload state: parts hold %d bytes but %d bytes are committed", committed, state.BytesCommitted)
+	}
+
+	// The multipart upload was created with the state's checksum algorithm
+	opts = append([]WriterOption{WithChecksum(state.ChecksumAlgorithm)}, opts...)
+	writer, err := NewS3Writer(ctx, client, state.Bucket, state.Key, state.PartSize, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if state.UploadID == "" {
+		return writer, nil
+	}
+	if writer.cfg.checksum != state.ChecksumAlgorithm {
+		writer.uploadCancel()
+		return nil, fmt.Errorf("checksum algorithm %q does not match the upload's %q", writer.cfg.checksum, state.ChecksumAlgorithm)
+	}
+
+	if err := writer.verifyParts(state); err != nil {
+		writer.uploadCancel()
+		return nil, err
+	}
+
+	writer.uploadID = aws.String(state.UploadID)
+	for _, part := range state.Parts {
+		completed := types.CompletedPart{
+			ETag:       aws.String(part.ETag),
+			PartNumber: aws.Int32(part.PartNumber),
+		}
+		if state.ChecksumAlgorithm != "" {
+			checksumFields{&completed.ChecksumCRC32, &completed.ChecksumCRC32C, &completed.ChecksumCRC64NVME, &completed.ChecksumSHA1, &completed.ChecksumSHA256}.set(state.ChecksumAlgorithm, part.Checksum)
+			writer.partSums[part.PartNumber], _ = base64.StdEncoding.DecodeString(part.Checksum) // Validated by verifyParts
+		}
+		writer.parts = append(writer.parts, completed)
+		writer.partBytes[part.PartNumber] = part.Size
+	}
+	writer.partNumber = int32(len(state.Parts)) + 1
+	return writer, nil
+}
+
+// verifyParts checks that S3 holds every part recorded in state.
+func (w *S3Writer) verifyParts(state UploadState) error {
+	uploaded, err := w.listParts(state.UploadID)
+	if err != nil {
+		return fmt.Errorf("failed to verify multipart upload %s: %w", state.UploadID, err)
+	}
+	for _, part := range state.Parts {
+		actual, ok := uploaded[part.PartNumber]
+		if !ok {
+			return fmt.Errorf("part %d of multipart upload %s is missing", part.PartNumber, state.UploadID)
+		}
+		if aws.ToString(actual.ETag) != part.ETag || aws.ToInt64(actual.Size) != part.Size {
+			return fmt.Errorf("part %d of multipart upload %s does not match the saved state (ETag %s, size %d)",
+				part.PartNumber, state.UploadID, aws.ToString(actual.ETag), aws.ToInt64(actual.Size))
+		}
+		checksum := checksumFields{&actual.ChecksumCRC32, &actual.ChecksumCRC32C, &actual.ChecksumCRC64NVME, &actual.ChecksumSHA1, &actual.ChecksumSHA256}.get(state.ChecksumAlgorithm)
+		if checksum != "" && checksum != part.Checksum {
+			return fmt.Errorf("part %d of multipart upload %s does not match the saved checksum", part.PartNumber, state.UploadID)
+		}
+	}
+	return nil
+}
+
+// listParts returns every part S3 holds for the multipart upload, by part number.
+func (w *S3Writer) listParts(uploadID string) (map[int32]types.Part, error) {
+	parts := make(map[int32]types.Part)
+	var marker *string
+	for {
+		input := &s3.ListPartsInput{
+			Bucket:           &w.bucket,
+			Key:              &w.key,
+			UploadId:         &uploadID,
+			PartNumberMarker: marker,
+		}
+		w.cfg.customerKey.apply(&input.SSECustomerAlgorithm, &input.SSECustomerKey, &input.SSECustomerKeyMD5)
+		resp, err := w.client.ListParts(w.ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		for _, part := range resp.Parts {
+			if part.PartNumber != nil {
+				parts[*part.PartNumber] = part
+			}
+		}
+		if !aws.ToBool(resp.IsTruncated) || resp.NextPartNumberMarker == nil {
+			return parts, nil
+		}
+		marker = resp.NextPartNumberMarker
+	}
+}
@@ -0,0 +1,200 @@
+package s3streamer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestS3Writer_ResumeFromState(t *testing.T) {
+	ctx := context.Background()
+	mock := &mockS3ClientWriter{}
+	partSize := int64(5 * 1024 * 1024)
+	testData := sizedTestData(3*partSize + 4321)
+
+	writer, err := NewS3Writer(ctx, mock, "test-bucket", "test-key", partSize)
+	if err != nil {
+		t.Fatalf("Failed to create S3Writer: %v", err)
+	}
+
+	// Two full parts reach S3; the rest of the third part is only buffered
+	if _, err := writer.Write(testData[:2*partSize+100]); err != nil {
+		t.Fatalf("Failed to write data: %v", err)
+	}
+	state := writer.State()
+	if state.UploadID != mock.uploadID {
+		t.Errorf("State upload ID = %q, want %q", state.UploadID, mock.uploadID)
+	}
+	if len(state.Parts) != 2 || state.BytesCommitted != 2*partSize {
+		t.Fatalf("State has %d parts and %d bytes, want 2 parts and %d bytes", len(state.Parts), state.BytesCommitted, 2*partSize)
+	}
+
+	// The process dies here; the state survives serialization
+	data, err := json.Marshal(state)
+	if err != nil {
+		t.Fatalf("Failed to marshal state: %v", err)
+	}
+	var restored UploadState
+	if err := json.Unmarshal(data, &restored); err != nil {
+		t.Fatalf("Failed to unmarshal state: %v", err)
+	}
+
+	resumed, err := ResumeS3Writer(ctx, mock, restored)
+	if err != nil {
+		t.Fatalf("Failed to resume S3Writer: %v", err)
+	}
+	if _, err := resumed.Write(testData[restored.BytesCommitted:]); err != nil {
+		t.Fatalf("Failed to write remaining data: %v", err)
+	}
+	if err := resumed.Close(); err != nil {
+		t.Fatalf("Failed to close resumed writer: %v", err)
+	}
+
+	if !mock.completed {
+		t.Error("Multipart upload was not completed")
+	}
+	if !bytes.Equal(mock.GetUploadedData(), testData) {
+		t.Error("Uploaded data does not match written data")
+	}
+}
+
+func TestS3Writer_StateBeforeFirstPart(t *testing.T) {
+	ctx := context.Background()
+	mock := &mockS3ClientWriter{}
+
+	writer, err := NewS3Writer(ctx, mock, "test-bucket", "test-key", 5*1024*1024)
+	if err != nil {
+		t.Fatalf("Failed to create S3Writer: %v", err)
+	}
+	writer.Write([]byte("buffered only"))
+
+	state := writer.State()
+	if state.UploadID != "" || len(state.Parts) != 0 || state.BytesCommitted != 0 {
+		t.Fatalf("Unexpected state before the first part: %+v", state)
+	}
+
+	// Resuming such a state starts over
+	resumed, err := ResumeS3Writer(ctx, mock, state)
+	if err != nil {
+		t.Fatalf("Failed to resume S3Writer: %v", err)
+	}
+	resumed.Write([]byte("hello\n"))
+	if err := resumed.Close(); err != nil {
+		t.Fatalf("Failed to close resumed writer: %v", err)
+	}
+	if got := string(mock.GetUploadedData()); got != "hello\n" {
+		t.Errorf("Uploaded data = %q, want %q", got, "hello\n")
+	}
+}
+
+func TestResumeS3Writer_VerifiesParts(t *testing.T) {
+	ctx := context.Background()
+	partSize := int64(5 * 1024 * 1024)
+
+	newState := func(t *testing.T) (*mockS3ClientWriter, UploadState) {
+		t.Helper()
+		mock := &mockS3ClientWriter{}
+		writer, err := NewS3Writer(ctx, mock, "test-bucket", "test-key", partSize)
+		if err != nil {
+			t.Fatalf("Failed to create S3Writer: %v", err)
+		}
+		if _, err := writer.Write(sizedTestData(2 * partSize)); err != nil {
+			t.Fatalf("Failed to write data: %v", err)
+		}
+		return mock, writer.State()
+	}
+
+	tests := []struct {
+		name   string
+		modify func(mock *mockS3ClientWriter, state *UploadState)
+		want   string
+	}{
+		{"unknown upload", func(mock *mockS3ClientWriter, state *UploadState) {
+			state.UploadID = "other-upload"
+		}, "failed to verify multipart upload"},
+		{"missing part", func(mock *mockS3ClientWriter, state *UploadState) {
+			delete(mock.uploadedParts, 2)
+		}, "part 2 of multipart upload"},
+		{"changed etag", func(mock *mockS3ClientWriter, state *UploadState) {
+			state.Parts[0].ETag = `"stale"`
+		}, "does not match the saved state"},
+		{"gap in parts", func(mock *mockS3ClientWriter, state *UploadState) {
+			state.Parts = state.Parts[1:]
+			state.BytesCommitted = partSize
+		}, "invalid upload state"},
+		{"wrong byte count", func(mock *mockS3ClientWriter, state *UploadState) {
+			state.BytesCommitted++
+		}, "invalid upload state"},
+		{"parts without upload", func(mock *mockS3ClientWriter, state *UploadState) {
+			state.UploadID = ""
+		}, "invalid upload state"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, state := newState(t)
+			tt.modify(mock, &state)
+			_, err := ResumeS3Writer(ctx, mock, state)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestResumeS3Writer_PaginatesListParts(t *testing.T) {
+	ctx := context.Background()
+	partSize := int64(5 * 1024 * 1024)
+
+	state := UploadState{
+		Bucket:   "test-bucket",
+		Key:      "test-key",
+		UploadID: "upload-1",
+		PartSize: partSize,
+	}
+	for i := int32(1); i <= 3; i++ {
+		state.Parts = append(state.Parts, UploadedPart{PartNumber: i, ETag: fmt.Sprintf(`"etag-%d"`, i), Size: partSize})
+		state.BytesCommitted += partSize
+	}
+
+	// One part per page
+	var calls int
+	mock := &mockS3ClientWriter{
+		listPartsFunc: func(ctx context.Context, params *s3.ListPartsInput, optFns ...func(*s3.Options)) (*s3.ListPartsOutput, error) {
+			calls++
+			next := int32(1)
+			if params.PartNumberMarker != nil {
+				fmt.Sscan(*params.PartNumberMarker, &next)
+				next++
+			}
+			part := state.Parts[next-1]
+			return &s3.ListPartsOutput{
+				Parts: []types.Part{{
+					PartNumber: aws.Int32(part.PartNumber),
+					ETag:       aws.String(part.ETag),
+					Size:       aws.Int64(part.Size),
+				}},
+				IsTruncated:          aws.Bool(next < 3),
+				NextPartNumberMarker: aws.String(fmt.Sprint(next)),
+			}, nil
+		},
+	}
+
+	writer, err := ResumeS3Writer(ctx, mock, state)
+	if err != nil {
+		t.Fatalf("Failed to resume S3Writer: %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("ListParts called %d times, want 3", calls)
+	}
+	if got := writer.State(); got.BytesCommitted != state.BytesCommitted || len(got.Parts) != 3 {
+		t.Errorf("Resumed state = %+v", got)
+	}
+}
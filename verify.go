@@ -0,0 +1,301 @@
+package s3streamer
+
+import (
+	"bytes"
+	"fmt"
+	"hash"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// WithChecksumVerification makes ChunkStreamer verify the bytes it reads against the
+// checksums S3 stores for the object. Before the first Read the stored checksum and
+// the part layout are fetched with GetObjectAttributes, and every range request is
+// sent with ChecksumMode enabled. While reading sequentially, each multipart part that
+// lies entirely inside the range is hashed and compared with its stored checksum, and
+// when the whole object is read its checksum is compared at the end. Parts do not
+// need to line up with chunks.
+//
+// A mismatch fails Read with a *ChecksumMismatchError before the chunk that completes
+// the corrupted part or object is returned; bytes from earlier chunks of that part have
+// already been delivered, so treat the whole read as failed. Objects stored without a
+// checksum are read without verification. ReadAt is not verified, and after Seek only
+// parts that are read from their first byte are.
+//
+// The caller needs s3:GetObjectAttributes permission (granted with s3:GetObject and
+// s3:GetObjectVersion on most policies).
+// Example:
+//
+//	streamer := s3streamer.NewS3Streamer(client, s3streamer.WithChecksumVerification())
+//	err := streamer.Stream(ctx, "my-bucket", "data.json.gz", 0, processLine)
+//	var mismatch *s3streamer.ChecksumMismatchError
+//	if errors.As(err, &mismatch) {
+//	    log.Printf("corrupted download of part %d", mismatch.PartNumber)
+//	}
+func WithChecksumVerification() ReaderOption {
+	return func(cfg *readerConfig) {
+		cfg.verifyChecksums = true
+	}
+}
+
+// ChecksumMismatchError is returned when data read with WithChecksumVerification does
+// not match the checksum S3 stores for it.
+type ChecksumMismatchError struct {
+	Bucket    string
+	Key       string
+	Algorithm types.ChecksumAlgorithm
+	// PartNumber is the multipart part that failed, or 0 for the whole object
+	PartNumber int32
+	Expected   string // Base64 encoded, as reported by S3
+	Actual     string // Base64 encoded checksum of the bytes that were read
+}
+
+// Error implements the error interface.
+func (e *ChecksumMismatchError) Error() string {
+	target := fmt.Sprintf("s3://%s/%s", e.Bucket, e.Key)
+	if e.PartNumber > 0 {
+		target += fmt.Sprintf(" part %d", e.PartNumber)
+	}
+	return fmt.Sprintf("checksum mismatch for %s: expected %s %s, got %s", target, e.Algorithm, e.Expected, e.Actual)
+}
+
+// partChecksum is the stored checksum of one multipart part.
+type partChecksum struct {
+	number      int32
+	start, size int64
+	checksum    string // Empty if S3 does not report one for the part
+}
+
+// checksumVerifier hashes the bytes delivered by Read and compares them with the
+// object's stored checksums.
+type checksumVerifier struct {
+	bucket, key  string
+	algorithm    types.ChecksumAlgorithm
+	checksumType types.ChecksumType
+	expected     string         // Stored checksum of the object
+	size         int64          // Object size, or -1 if unknown
+	parts        []partChecksum // Part layout in object order, nil if unknown
+
+	pos      int64     // Object offset of the next byte to hash
+	whole    bool      // Every byte before pos has been hashed
+	full     hash.Hash // Running full-object hash, nil unless whole and FULL_OBJECT
+	part     int       // Index in parts of the part containing pos
+	partHash hash.Hash // Hash of the current part, nil if it was not read from its start
+	partSums [][]byte  // Raw checksums of the parts read so far, for composite checksums
+}
+
+// newChecksumVerifier fetches the object's stored checksums. It returns nil if the
+// object has none.
+func (c *ChunkStreamer) newChecksumVerifier() (*checksumVerifier, error) {
+	input := &s3.GetObjectAttributesInput{
+		Bucket: &c.bucket,
+		Key:    &c.key,
+		ObjectAttributes: []types.ObjectAttributes{
+			types.ObjectAttributesEtag,
+			types.ObjectAttributesChecksum,
+			types.ObjectAttributesObjectParts,
+			types.ObjectAttributesObjectSize,
+		},
+	}
+	if c.cfg.versionID != "" {
+		input.VersionId = &c.cfg.versionID
+	}
+	c.cfg.customerKey.apply(&input.SSECustomerAlgorithm, &input.SSECustomerKey, &input.SSECustomerKeyMD5)
+
+	var attrs *s3.GetObjectAttributesOutput
+	var objectParts []types.ObjectPart
+	for {
+		resp, err := c.client.GetObjectAttributes(c.ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get object checksums: %w", err)
+		}
+		if attrs == nil {
+			attrs = resp
+		}
+		if resp.ObjectParts == nil {
+			break
+		}
+		objectParts = append(objectParts, resp.ObjectParts.Parts...)
+		if !aws.ToBool(resp.ObjectParts.IsTruncated) || resp.ObjectParts.NextPartNumberMarker == nil {
+			break
+		}
+		input.PartNumberMarker = resp.ObjectParts.NextPartNumberMarker
+	}
+
+	// GetObjectAttributes cannot be pinned with If-Match, so check the ETag afterwards
+	etag := strings.Trim(aws.ToString(attrs.ETag), `"`)
+	if c.cfg.etag != "" && etag != "" && etag != strings.Trim(c.cfg.etag, `"`) {
+		return nil, c.changedError(aws.ToString(attrs.ETag), aws.ToString(attrs.VersionId), nil)
+	}
+
+	if attrs.Checksum == nil {
+		return nil, nil
+	}
+	stored := attrs.Checksum
+	fields := checksumFields{&stored.ChecksumCRC32, &stored.ChecksumCRC32C, &stored.ChecksumCRC64NVME, &stored.ChecksumSHA1, &stored.ChecksumSHA256}
+	algorithm := fields.present()
+	if algorithm == "" {
+		return nil, nil
+	}
+
+	v := &checksumVerifier{
+		bucket:       c.bucket,
+		key:          c.key,
+		algorithm:    algorithm,
+		checksumType: stored.ChecksumType,
+		expected:     fields.get(algorithm),
+		size:         -1,
+	}
+	if v.checksumType == "" {
+		// Composite checksums carry the part count, which base64 never contains
+		v.checksumType = types.ChecksumTypeFullObject
+		if strings.Contains(v.expected, "-") {
+			v.checksumType = types.ChecksumTypeComposite
+		}
+	}
+	if attrs.ObjectSize != nil {
+		v.size = *attrs.ObjectSize
+	}
+	v.parts = partLayout(algorithm, objectParts, v.size)
+	v.reset(0)
+	return v, nil
+}
+
+// partLayout returns the offsets and checksums of the parts, or nil if the parts do not
+// cover the object exactly.
+func partLayout(algorithm types.ChecksumAlgorithm, objectParts []types.ObjectPart, size int64) []partChecksum {
+	if len(objectParts) == 0 {
+		return nil
+	}
+	sort.Slice(objectParts, func(i, j int) bool {
+		return aws.ToInt32(objectParts[i].PartNumber) < aws.ToInt32(objectParts[j].PartNumber)
+	})
+
+	parts := make([]partChecksum, 0, len(objectParts))
+	var start int64
+	for i, part := range objectParts {
+		if aws.ToInt32(part.PartNumber) != int32(i+1) || aws.ToInt64(part.Size) <= 0 {
+			return nil
+		}
+		parts = append(parts, partChecksum{
+			number:   *part.PartNumber,
+			start:    start,
+			size:     *part.Size,
+			checksum: checksumFields{&part.ChecksumCRC32, &part.ChecksumCRC32C, &part.ChecksumCRC64NVME, &part.ChecksumSHA1, &part.ChecksumSHA256}.get(algorithm),
+		})
+		start += *part.Size
+	}
+	if start != size {
+		return nil
+	}
+	return parts
+}
+
+// reset restarts hashing at object offset start. Only parts beginning at or after
+// start can still be verified, and the whole object only if start is 0.
+func (v *checksumVerifier) reset(start int64) {
+	v.pos = start
+	v.whole = start == 0
+	v.full = nil
+	if v.whole && v.checksumType == types.ChecksumTypeFullObject {
+		v.full = newChecksumHash(v.algorithm)
+	}
+	v.partSums = nil
+
+	v.part = sort.Search(len(v.parts), func(i int) bool {
+		return v.parts[i].start+v.parts[i].size > start
+	})
+	v.partHash = nil
+	if v.part < len(v.parts) && v.parts[v.part].start == start {
+		v.partHash = newChecksumHash(v.algorithm)
+	}
+}
+
+// write hashes data, which starts at object offset start, and checks every part and
+// the object that it completes.
+func (v *checksumVerifier) write(start int64, data []byte) error {
+	if start != v.pos {
+		v.reset(start)
+	}
+
+	for len(data) > 0 {
+		n := int64(len(data))
+		if v.part < len(v.parts) {
+			n = min(n, v.parts[v.part].start+v.parts[v.part].size-v.pos)
+		}
+		if v.full != nil {
+			v.full.Write(data[:n])
+		}
+		if v.partHash != nil {
+			v.partHash.Write(data[:n])
+		}
+		v.pos += n
+		data = data[n:]
+
+		if v.part < len(v.parts) && v.pos == v.parts[v.part].start+v.parts[v.part].size {
+			if err := v.finishPart(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if v.pos == v.size && v.whole {
+		return v.finishObject()
+	}
+	return nil
+}
+
+// finishPart checks the part that has just been read and moves on to the next one.
+func (v *checksumVerifier) finishPart() error {
+	part := v.parts[v.part]
+	v.part++
+
+	if v.partHash == nil {
+		v.partHash = newChecksumHash(v.algorithm)
+		return nil
+	}
+	sum := v.partHash.Sum(nil)
+	v.partHash = newChecksumHash(v.algorithm)
+	v.partSums = append(v.partSums, sum)
+
+	if actual := encodeChecksum(sum); part.checksum != "" && actual != part.checksum {
+		return v.mismatch(part.number, part.checksum, actual)
+	}
+	return nil
+}
+
+// finishObject checks the checksum of the whole object.
+func (v *checksumVerifier) finishObject() error {
+	v.whole = false // Checked once per pass
+
+	var actual string
+	switch {
+	case v.checksumType == types.ChecksumTypeFullObject:
+		actual = encodeChecksum(v.full.Sum(nil))
+	case v.parts != nil:
+		// A composite checksum is the checksum of the part checksums
+		actual = fmt.Sprintf("%s-%d", encodeChecksum(computeChecksum(v.algorithm, bytes.Join(v.partSums, nil))), len(v.partSums))
+	default:
+		return nil // The part checksums cannot be recomputed without the part layout
+	}
+	if actual != v.expected {
+		return v.mismatch(0, v.expected, actual)
+	}
+	return nil
+}
+
+// mismatch builds a ChecksumMismatchError for this object.
+func (v *checksumVerifier) mismatch(partNumber int32, expected, actual string) error {
+	return &ChecksumMismatchError{
+		Bucket:     v.bucket,
+		Key:        v.key,
+		Algorithm:  v.algorithm,
+		PartNumber: partNumber,
+		Expected:   expected,
+		Actual:     actual,
+	}
+}
@@ -0,0 +1,256 @@
+package s3streamer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// attributesClient serves the checksums of a MockS3Client object, computed when the
+// client is created, and records the checksum mode of range requests. Changing the
+// mock's data afterwards simulates corruption in transit.
+type attributesClient struct {
+	*MockS3Client
+	attrs    s3.GetObjectAttributesOutput
+	parts    []types.ObjectPart
+	maxParts int // Parts per GetObjectAttributes page
+
+	modesMu        sync.Mutex
+	checksumModes  []types.ChecksumMode
+	attributeCalls int
+}
+
+// newAttributesClient stores data with a checksum of the given algorithm. A positive
+// partSize describes a multipart object with parts of that size.
+func newAttributesClient(data []byte, algorithm types.ChecksumAlgorithm, checksumType types.ChecksumType, partSize int64) *attributesClient {
+	c := &attributesClient{
+		MockS3Client: NewMockS3Client(append([]byte(nil), data...)),
+		maxParts:     2,
+	}
+	c.attrs.ObjectSize = aws.Int64(int64(len(data)))
+	c.attrs.Checksum = &types.Checksum{ChecksumType: checksumType}
+	fields := checksumFields{&c.attrs.Checksum.ChecksumCRC32, &c.attrs.Checksum.ChecksumCRC32C, &c.attrs.Checksum.ChecksumCRC64NVME, &c.attrs.Checksum.ChecksumSHA1, &c.attrs.Checksum.ChecksumSHA256}
+
+	var sums [][]byte
+	for start, number := int64(0), int32(1); partSize > 0 && start < int64(len(data)); start, number = start+partSize, number+1 {
+		part := data[start:min(start+partSize, int64(len(data)))]
+		sum := computeChecksum(algorithm, part)
+		sums = append(sums, sum)
+		objectPart := types.ObjectPart{PartNumber: aws.Int32(number), Size: aws.Int64(int64(len(part)))}
+		checksumFields{&objectPart.ChecksumCRC32, &objectPart.ChecksumCRC32C, &objectPart.ChecksumCRC64NVME, &objectPart.ChecksumSHA1, &objectPart.ChecksumSHA256}.set(algorithm, encodeChecksum(sum))
+		c.parts = append(c.parts, objectPart)
+	}
+
+	if checksumType == types.ChecksumTypeComposite {
+		fields.set(algorithm, fmt.Sprintf("%s-%d", encodeChecksum(computeChecksum(algorithm, bytes.Join(sums, nil))), len(sums)))
+	} else {
+		fields.set(algorithm, encodeChecksum(computeChecksum(algorithm, data)))
+	}
+	return c
+}
+
+func (c *attributesClient) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	c.modesMu.Lock()
+	c.checksumModes = append(c.checksumModes, params.ChecksumMode)
+	c.modesMu.Unlock()
+	return c.MockS3Client.GetObject(ctx, params, optFns...)
+}
+
+func (c *attributesClient) GetObjectAttributes(ctx context.Context, params *s3.GetObjectAttributesInput, optFns ...func(*s3.Options)) (*s3.GetObjectAttributesOutput, error) {
+	c.modesMu.Lock()
+	c.attributeCalls++
+	c.modesMu.Unlock()
+
+	resp := c.attrs
+	if len(c.parts) > 0 {
+		var first int
+		if params.PartNumberMarker != nil {
+			fmt.Sscan(*params.PartNumberMarker, &first)
+		}
+		last := first + c.maxParts
+		if last > len(c.parts) {
+			last = len(c.parts)
+		}
+		resp.ObjectParts = &types.GetObjectAttributesParts{
+			Parts:                c.parts[first:last],
+			IsTruncated:          aws.Bool(last < len(c.parts)),
+			NextPartNumberMarker: aws.String(fmt.Sprint(last)),
+			TotalPartsCount:      aws.Int32(int32(len(c.parts))),
+		}
+	}
+	return &resp, nil
+}
+
+func TestChunkStreamer_ChecksumVerification(t *testing.T) {
+	ctx := context.Background()
+	data := sizedTestData(3500)
+
+	tests := []struct {
+		name         string
+		algorithm    types.ChecksumAlgorithm
+		checksumType types.ChecksumType
+		partSize     int64
+		corrupt      int   // Offset of the corrupted byte
+		wantPart     int32 // Part reported as corrupted
+	}{
+		{"CRC64NVME multipart", types.ChecksumAlgorithmCrc64nvme, types.ChecksumTypeFullObject, 1000, 1500, 2},
+		{"CRC32C multipart", types.ChecksumAlgorithmCrc32c, types.ChecksumTypeFullObject, 1000, 3499, 4},
+		{"SHA256 composite", types.ChecksumAlgorithmSha256, types.ChecksumTypeComposite, 1000, 10, 1},
+		{"CRC32 composite", types.ChecksumAlgorithmCrc32, types.ChecksumTypeComposite, 1000, 2999, 3},
+		{"SHA1 single part", types.ChecksumAlgorithmSha1, types.ChecksumTypeFullObject, 0, 2000, 0},
+		{"CRC32C single part", types.ChecksumAlgorithmCrc32c, types.ChecksumTypeFullObject, 0, 3499, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newAttributesClient(data, tt.algorithm, tt.checksumType, tt.partSize)
+
+			// Chunks do not line up with the parts
+			streamer := NewChunkStreamer(ctx, client, "test-bucket", "test-key", 0, int64(len(data)), 300,
+				WithChecksumVerification(), WithReadConcurrency(3))
+			got, err := io.ReadAll(streamer)
+			streamer.Close()
+			if err != nil {
+				t.Fatalf("Failed to read intact object: %v", err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatal("Read data does not match")
+			}
+			if tt.partSize > 0 && client.attributeCalls != 2 {
+				t.Errorf("GetObjectAttributes called %d times, want 2 pages", client.attributeCalls)
+			}
+			for _, mode := range client.checksumModes {
+				if mode != types.ChecksumModeEnabled {
+					t.Fatalf("GetObject sent checksum mode %q", mode)
+				}
+			}
+
+			client.data[tt.corrupt] ^= 0x01
+			streamer = NewChunkStreamer(ctx, client, "test-bucket", "test-key", 0, int64(len(data)), 300,
+				WithChecksumVerification())
+			defer streamer.Close()
+			_, err = io.ReadAll(streamer)
+			var mismatch *ChecksumMismatchError
+			if !errors.As(err, &mismatch) {
+				t.Fatalf("Expected ChecksumMismatchError, got %v", err)
+			}
+			if mismatch.PartNumber != tt.wantPart || mismatch.Algorithm != tt.algorithm {
+				t.Errorf("Mismatch reported for part %d (%s), want part %d (%s)", mismatch.PartNumber, mismatch.Algorithm, tt.wantPart, tt.algorithm)
+			}
+			if _, err := streamer.Read(make([]byte, 10)); !errors.As(err, &mismatch) {
+				t.Errorf("Subsequent Read returned %v", err)
+			}
+		})
+	}
+}
+
+func TestChunkStreamer_ChecksumVerificationPartialRange(t *testing.T) {
+	ctx := context.Background()
+	data := sizedTestData(3500)
+
+	// The range [900, 3100) holds parts 2 and 3 entirely and parts 1 and 4 in part
+	tests := []struct {
+		corrupt int
+		wantErr bool
+	}{
+		{950, false},
+		{1500, true},
+		{3050, false},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.corrupt), func(t *testing.T) {
+			client := newAttributesClient(data, types.ChecksumAlgorithmCrc64nvme, types.ChecksumTypeFullObject, 1000)
+			client.data[tt.corrupt] ^= 0x01
+
+			streamer := NewChunkStreamer(ctx, client, "test-bucket", "test-key", 900, 2200, 256, WithChecksumVerification())
+			defer streamer.Close()
+			_, err := io.ReadAll(streamer)
+			if tt.wantErr != (err != nil) {
+				t.Errorf("ReadAll error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestChunkStreamer_ChecksumVerificationAfterSeek(t *testing.T) {
+	ctx := context.Background()
+	data := sizedTestData(3500)
+	client := newAttributesClient(data, types.ChecksumAlgorithmSha256, types.ChecksumTypeComposite, 1000)
+	client.data[100] ^= 0x01
+
+	streamer := NewChunkStreamer(ctx, client, "test-bucket", "test-key", 0, int64(len(data)), 256, WithChecksumVerification())
+	defer streamer.Close()
+
+	// Part 1 is skipped, so only parts 2 to 4 are verified
+	if _, err := streamer.Seek(1000, io.SeekStart); err != nil {
+		t.Fatalf("Seek failed: %v", err)
+	}
+	if _, err := io.ReadAll(streamer); err != nil {
+		t.Fatalf("Read after Seek failed: %v", err)
+	}
+
+	// Reading from the start again catches the corrupted part
+	if _, err := streamer.Seek(0, io.SeekStart); err != nil {
+		t.Fatalf("Seek failed: %v", err)
+	}
+	var mismatch *ChecksumMismatchError
+	if _, err := io.ReadAll(streamer); !errors.As(err, &mismatch) || mismatch.PartNumber != 1 {
+		t.Errorf("Expected mismatch in part 1, got %v", err)
+	}
+}
+
+func TestChunkStreamer_ChecksumVerificationWithoutStoredChecksum(t *testing.T) {
+	data := sizedTestData(1000)
+	client := newAttributesClient(data, types.ChecksumAlgorithmCrc32c, types.ChecksumTypeFullObject, 0)
+	client.attrs.Checksum = nil
+	client.data[5] ^= 0x01 // Undetectable without a stored checksum
+
+	streamer := NewChunkStreamer(context.Background(), client, "test-bucket", "test-key", 0, int64(len(data)), 256, WithChecksumVerification())
+	defer streamer.Close()
+	if _, err := io.ReadAll(streamer); err != nil {
+		t.Errorf("Read failed: %v", err)
+	}
+}
+
+func TestStream_ChecksumVerification(t *testing.T) {
+	ctx := context.Background()
+	data := sizedTestData(3500)
+
+	for _, corrupt := range []bool{false, true} {
+		t.Run(fmt.Sprintf("corrupt=%v", corrupt), func(t *testing.T) {
+			client := newAttributesClient(data, types.ChecksumAlgorithmCrc64nvme, types.ChecksumTypeFullObject, 1000)
+			if corrupt {
+				// Changes a digit, so every line still parses
+				i := bytes.LastIndex(client.data, []byte("line 9"))
+				client.data[i+5] = '8'
+			}
+
+			streamer := NewS3Streamer(client, WithChecksumVerification())
+			streamer.chunkSize = 512
+			err := streamer.Stream(ctx, "test-bucket", "test-key", 0, func(line []byte, offset int64) error {
+				return nil
+			})
+
+			var mismatch *ChecksumMismatchError
+			if corrupt {
+				if !errors.As(err, &mismatch) {
+					t.Fatalf("Expected ChecksumMismatchError, got %v", err)
+				}
+				if !strings.Contains(err.Error(), "checksum mismatch for s3://test-bucket/test-key part") {
+					t.Errorf("Unexpected error message: %v", err)
+				}
+			} else if err != nil {
+				t.Fatalf("Stream failed: %v", err)
+			}
+		})
+	}
+}
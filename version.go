@@ -0,0 +1,77 @@
+package s3streamer
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ObjectChangedError is returned when an object is overwritten or replaced while it is
+// being read. Every ranged request is pinned to the ETag and VersionId observed when
+// the read started, so bytes from two different versions are never stitched together.
+// Example:
+//
+//	err := streamer.Stream(ctx, "my-bucket", "data.json.gz", 0, processLine)
+//	var changed *s3streamer.ObjectChangedError
+//	if errors.As(err, &changed) {
+//	    log.Printf("object changed underneath us (was %s), restarting", changed.ExpectedETag)
+//	}
+type ObjectChangedError struct {
+	Bucket            string
+	Key               string
+	ExpectedETag      string
+	ExpectedVersionID string
+	ActualETag        string // Empty if S3 rejected the request without returning the new ETag
+	ActualVersionID   string // Empty if S3 rejected the request without returning the new VersionId
+	Err               error  // Underlying error, such as a PreconditionFailed response
+}
+
+// Error implements the error interface.
+func (e *ObjectChangedError) Error() string {
+	msg := fmt.Sprintf("object s3://%s/%s changed while reading (expected ETag %s", e.Bucket, e.Key, e.ExpectedETag)
+	if e.ExpectedVersionID != "" {
+		msg += fmt.Sprintf(", version %s", e.ExpectedVersionID)
+	}
+	msg += ")"
+	if e.ActualETag != "" || e.ActualVersionID != "" {
+		msg += fmt.Sprintf(": got ETag %s", e.ActualETag)
+		if e.ActualVersionID != "" {
+			msg += fmt.Sprintf(", version %s", e.ActualVersionID)
+		}
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Unwrap returns the underlying error, if any.
+func (e *ObjectChangedError) Unwrap() error {
+	return e.Err
+}
+
+// WithObjectVersion pins every range request made by a ChunkStreamer to a specific
+// object version. Requests carry If-Match with etag and, when versionID is set, the
+// VersionId parameter; a mismatch fails the read with an ObjectChangedError.
+// S3Streamer.Stream pins automatically using the values returned by HeadObject.
+// Example:
+//
+//	head, _ := client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: &bucket, Key: &key})
+//	streamer := s3streamer.NewChunkStreamer(ctx, client, bucket, key, 0, *head.ContentLength, 5*1024*1024,
+//	    s3streamer.WithObjectVersion(aws.ToString(head.ETag), aws.ToString(head.VersionId)))
+func WithObjectVersion(etag, versionID string) ReaderOption {
+	return func(cfg *readerConfig) {
+		cfg.etag = etag
+		cfg.versionID = versionID
+	}
+}
+
+// isPreconditionFailed reports whether err is S3's response to a failed If-Match.
+func isPreconditionFailed(err error) bool {
+	var statusErr interface{ HTTPStatusCode() int }
+	if errors.As(err, &statusErr) && statusErr.HTTPStatusCode() == http.StatusPreconditionFailed {
+		return true
+	}
+	var codeErr interface{ ErrorCode() string }
+	return errors.As(err, &codeErr) && codeErr.ErrorCode() == "PreconditionFailed"
+}
@@ -0,0 +1,168 @@
+package s3streamer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// overwritingMockS3Client overwrites the object after a number of GetObject calls and
+// records the version parameters sent with each request.
+type overwritingMockS3Client struct {
+	*MockS3Client
+	overwriteAfter int
+	newData        []byte
+	newETag        string
+	newVersionID   string
+	ignoreIfMatch  bool // Simulate a proxy that drops the If-Match header
+
+	mu         sync.Mutex
+	calls      int
+	ifMatches  []string
+	versionIDs []string
+}
+
+func (m *overwritingMockS3Client) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	m.mu.Lock()
+	m.calls++
+	if m.calls == m.overwriteAfter+1 {
+		m.MockS3Client.setObject(m.newData, m.newETag, m.newVersionID)
+	}
+	var ifMatch, versionID string
+	if params.IfMatch != nil {
+		ifMatch = *params.IfMatch
+	}
+	if params.VersionId != nil {
+		versionID = *params.VersionId
+	}
+	m.ifMatches = append(m.ifMatches, ifMatch)
+	m.versionIDs = append(m.versionIDs, versionID)
+	m.mu.Unlock()
+
+	if m.ignoreIfMatch {
+		stripped := *params
+		stripped.IfMatch = nil
+		params = &stripped
+	}
+	return m.MockS3Client.GetObject(ctx, params, optFns...)
+}
+
+func TestStreamPinsObjectVersion(t *testing.T) {
+	testData := prepareTestData(t, 20, Uncompressed)
+	mock := NewMockS3Client(testData)
+	mock.etag = `"etag-v1"`
+	mock.versionID = "version-1"
+	client := &overwritingMockS3Client{MockS3Client: mock, overwriteAfter: -1}
+
+	streamer := NewS3Streamer(client)
+	streamer.chunkSize = 256
+
+	var count int
+	err := streamer.Stream(context.Background(), "test-bucket", "test-key", 0, func(line []byte, offset int64) error {
+		count++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if count != 20 {
+		t.Errorf("Record count = %d, want 20", count)
+	}
+
+	// Every range request, including compression detection, must carry the pin
+	for i := range client.ifMatches {
+		if client.ifMatches[i] != `"etag-v1"` {
+			t.Errorf("Request %d IfMatch = %q, want %q", i, client.ifMatches[i], `"etag-v1"`)
+		}
+		if client.versionIDs[i] != "version-1" {
+			t.Errorf("Request %d VersionId = %q, want %q", i, client.versionIDs[i], "version-1")
+		}
+	}
+}
+
+func TestStreamDetectsOverwriteMidStream(t *testing.T) {
+	testData := prepareTestData(t, 50, Uncompressed)
+	mock := NewMockS3Client(testData)
+	mock.etag = `"etag-v1"`
+	client := &overwritingMockS3Client{
+		MockS3Client:   mock,
+		overwriteAfter: 3,
+		newData:        bytes.ToUpper(testData),
+		newETag:        `"etag-v2"`,
+	}
+
+	streamer := NewS3Streamer(client)
+	streamer.chunkSize = 256
+
+	err := streamer.Stream(context.Background(), "test-bucket", "test-key", 0, func(line []byte, offset int64) error {
+		if bytes.Contains(line, []byte("ID-")) {
+			t.Fatalf("Received a line from the overwritten object: %s", line)
+		}
+		return nil
+	})
+
+	var changed *ObjectChangedError
+	if !errors.As(err, &changed) {
+		t.Fatalf("Expected ObjectChangedError, got %v", err)
+	}
+	if changed.ExpectedETag != `"etag-v1"` {
+		t.Errorf("ExpectedETag = %q, want %q", changed.ExpectedETag, `"etag-v1"`)
+	}
+	if !isPreconditionFailed(changed) {
+		t.Errorf("Expected the PreconditionFailed response to be wrapped, got %v", changed.Err)
+	}
+
+	// The change must not be retried
+	if got, want := client.calls, 4; got != want {
+		t.Errorf("GetObject call count = %d, want %d", got, want)
+	}
+}
+
+func TestChunkStreamerDetectsETagMismatchWithoutIfMatch(t *testing.T) {
+	testData := bytes.Repeat([]byte("0123456789"), 10)
+	mock := NewMockS3Client(testData)
+	mock.etag = `"etag-v1"`
+	client := &overwritingMockS3Client{
+		MockS3Client:   mock,
+		overwriteAfter: 1,
+		newData:        testData,
+		newETag:        `"etag-v2"`,
+		ignoreIfMatch:  true,
+	}
+
+	streamer := NewChunkStreamer(context.Background(), client, "test-bucket", "test-key", 0, int64(len(testData)), 30,
+		WithObjectVersion(`"etag-v1"`, ""))
+	defer streamer.Close()
+
+	_, err := io.ReadAll(streamer)
+	var changed *ObjectChangedError
+	if !errors.As(err, &changed) {
+		t.Fatalf("Expected ObjectChangedError, got %v", err)
+	}
+	if changed.ActualETag != `"etag-v2"` {
+		t.Errorf("ActualETag = %q, want %q", changed.ActualETag, `"etag-v2"`)
+	}
+	if changed.Bucket != "test-bucket" || changed.Key != "test-key" {
+		t.Errorf("Unexpected object in error: s3://%s/%s", changed.Bucket, changed.Key)
+	}
+}
+
+func TestChunkStreamerWithoutPinSendsNoPreconditions(t *testing.T) {
+	testData := []byte("unpinned data")
+	client := &overwritingMockS3Client{MockS3Client: NewMockS3Client(testData), overwriteAfter: -1}
+
+	streamer := NewChunkStreamer(context.Background(), client, "test-bucket", "test-key", 0, int64(len(testData)), 1024)
+	defer streamer.Close()
+
+	if _, err := io.ReadAll(streamer); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if client.ifMatches[0] != "" || client.versionIDs[0] != "" {
+		t.Errorf("Expected no IfMatch/VersionId, got %q/%q", client.ifMatches[0], client.versionIDs[0])
+	}
+}
@@ -0,0 +1,179 @@
+package s3streamer
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+)
+
+// pendingPerWorker bounds how many records may be dispatched ahead of the committed
+// watermark, so a slow record cannot make completed ones pile up without limit.
+const pendingPerWorker = 16
+
+// lineJob is a record dispatched to a worker.
+type lineJob struct {
+	seq  uint64
+	line Line
+}
+
+// lineResult reports a finished record.
+type lineResult struct {
+	seq uint64
+	err error
+}
+
+// pendingLine is a dispatched record that has not been committed yet.
+type pendingLine struct {
+	number int64
+	end    int64       // Offset of the byte after the record
+	cp     *Checkpoint // Checkpoint taken after the record, if any
+	done   bool
+}
+
+// linePool calls fn for records on several goroutines and commits them in stream
+// order: the watermark only moves past a record once it and every record before it
+// have been processed. Commit and checkpoint callbacks run on the goroutine that
+// submits records.
+type linePool struct {
+	fn           func(Line) error
+	onCommit     func(int64) error
+	onCheckpoint func(Checkpoint) error
+
+	jobs    chan lineJob
+	results chan lineResult
+	stop    chan struct{} // Closed by close to skip queued lines
+	wg      sync.WaitGroup
+	closed  bool // jobs has been closed
+
+	pending   []pendingLine // Records from seq next onwards, in stream order
+	next      uint64        // Sequence number of pending[0]
+	maxAhead  int
+	watermark int64 // Last offset passed to onCommit
+}
+
+// newLinePool starts workers goroutines calling fn.
+func newLinePool(workers int, fn func(Line) error, onCommit func(int64) error, onCheckpoint func(Checkpoint) error) *linePool {
+	maxAhead := workers * pendingPerWorker
+	p := &linePool{
+		fn:           fn,
+		onCommit:     onCommit,
+		onCheckpoint: onCheckpoint,
+		jobs:         make(chan lineJob, workers),
+		results:      make(chan lineResult, maxAhead), // Workers never block on results
+		stop:         make(chan struct{}),
+		maxAhead:     maxAhead,
+	}
+	for range workers {
+		p.wg.Add(1)
+		go p.work()
+	}
+	return p
+}
+
+// work processes jobs until the pool is closed.
+func (p *linePool) work() {
+	defer p.wg.Done()
+	for job := range p.jobs {
+		select {
+		case <-p.stop:
+			continue // Drain without processing
+		default:
+		}
+		p.results <- lineResult{seq: job.seq, err: p.fn(job.line)}
+	}
+}
+
+// submit dispatches a copy of line, which ends at end. cp is emitted once the line
+// and everything before it have been processed. It returns the first error from a
+// record or callback.
+func (p *linePool) submit(line Line, end int64, cp *Checkpoint) error {
+	for len(p.pending) >= p.maxAhead {
+		if err := p.collect(<-p.results); err != nil {
+			return err
+		}
+	}
+
+	line.Data = bytes.Clone(line.Data) // The scanner reuses its buffer
+	job := lineJob{seq: p.next + uint64(len(p.pending)), line: line}
+	p.pending = append(p.pending, pendingLine{number: line.Number, end: end, cp: cp})
+	for {
+		select {
+		case p.jobs <- job:
+			return nil
+		case result := <-p.results:
+			if err := p.collect(result); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// collect records a finished line and commits everything that is now contiguous.
+func (p *linePool) collect(result lineResult) error {
+	i := int(result.seq - p.next)
+	if result.err != nil {
+		return fmt.Errorf("error processing line %d: %w", p.pending[i].number, result.err)
+	}
+	p.pending[i].done = true
+
+	// Commit pending lines up to the first unfinished one
+	var committed int
+	for committed < len(p.pending) && p.pending[committed].done {
+		line := p.pending[committed]
+		committed++
+		if line.cp == nil || p.onCheckpoint == nil {
+			continue
+		}
+		// The watermark has reached the checkpoint; commit up to it first
+		if err := p.commit(line.end); err != nil {
+			return err
+		}
+		if err := p.onCheckpoint(*line.cp); err != nil {
+			return fmt.Errorf("checkpoint callback failed at line %d: %w", line.number, err)
+		}
+	}
+	if committed == 0 {
+		return nil
+	}
+	end := p.pending[committed-1].end
+	p.pending = p.pending[committed:]
+	p.next += uint64(committed)
+	return p.commit(end)
+}
+
+// commit reports the watermark to onCommit if it has moved.
+func (p *linePool) commit(offset int64) error {
+	if p.onCommit == nil || offset <= p.watermark {
+		return nil
+	}
+	p.watermark = offset
+	if err := p.onCommit(offset); err != nil {
+		return fmt.Errorf("commit callback failed at offset %d: %w", offset, err)
+	}
+	return nil
+}
+
+// wait waits for every submitted line and commits it.
+func (p *linePool) wait() error {
+	if !p.closed {
+		p.closed = true
+		close(p.jobs)
+	}
+	for len(p.pending) > 0 {
+		if err := p.collect(<-p.results); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// close stops the workers, skipping lines that have not started, and waits for them.
+// It is safe to call after wait.
+func (p *linePool) close() {
+	close(p.stop)
+	if !p.closed {
+		p.closed = true
+		close(p.jobs)
+	}
+	p.wg.Wait()
+}
@@ -0,0 +1,190 @@
+package s3streamer
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// workerTestStream streams data with opts, checking on every commit that all records
+// before the watermark have been processed. It returns the processed record offsets
+// and the commits.
+func workerTestStream(t *testing.T, data []byte, opts StreamOptions) (map[int64]bool, []int64, error) {
+	t.Helper()
+	streamer := NewS3Streamer(NewMockS3Client(data))
+	streamer.chunkSize = 8 * 1024
+
+	var mu sync.Mutex
+	processed := map[int64]bool{}
+	ends := map[int64]int64{} // Record offset to the offset after it
+	var commits []int64
+	opts.OnCommit = func(offset int64) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(commits) > 0 && offset <= commits[len(commits)-1] {
+			t.Errorf("Watermark moved from %d to %d", commits[len(commits)-1], offset)
+		}
+		for start, end := range ends {
+			if end <= offset && !processed[start] {
+				t.Errorf("Committed %d before the record at %d was processed", offset, start)
+			}
+		}
+		commits = append(commits, offset)
+		return nil
+	}
+
+	for start := 0; start < len(data); {
+		end := start
+		for end < len(data) && data[end] != '\n' {
+			end++
+		}
+		ends[int64(start)] = int64(end + 1)
+		start = end + 1
+	}
+
+	err := streamer.StreamWithOptions(context.Background(), "test-bucket", "test-key", opts, func(line []byte, offset int64) error {
+		// Slow down some records so they finish out of order
+		if offset%7 == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		processed[offset] = true
+		return nil
+	})
+	return processed, commits, err
+}
+
+func TestStreamWithOptions_Workers(t *testing.T) {
+	data := checkpointTestLines(2000)
+	processed, commits, err := workerTestStream(t, data, StreamOptions{Workers: 8})
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if len(processed) != 2000 {
+		t.Errorf("Processed %d records, want 2000", len(processed))
+	}
+	if len(commits) == 0 || commits[len(commits)-1] != int64(len(data)) {
+		t.Errorf("Final watermark %v, want %d", commits[len(commits)-1:], len(data))
+	}
+}
+
+func TestStreamWithOptions_SerialCommits(t *testing.T) {
+	data := checkpointTestLines(100)
+	_, commits, err := workerTestStream(t, data, StreamOptions{})
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if len(commits) != 100 || commits[99] != int64(len(data)) {
+		t.Errorf("Got %d commits ending at %d", len(commits), commits[len(commits)-1])
+	}
+}
+
+func TestStreamWithOptions_WorkersCheckpoints(t *testing.T) {
+	lines := checkpointTestLines(4000)
+	data := compressForTest(t, lines, Gzip, gzip.DefaultCompression, 0)
+	streamer := NewS3Streamer(NewMockS3Client(data))
+
+	var mu sync.Mutex
+	done := map[int64]bool{}
+	var checkpoints []Checkpoint
+	err := streamer.StreamWithOptions(context.Background(), "test-bucket", "test-key", StreamOptions{
+		Workers:            4,
+		CheckpointInterval: 32 * 1024,
+		OnCheckpoint: func(cp Checkpoint) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if int64(len(done)) < cp.Line {
+				t.Errorf("Checkpoint at line %d emitted after only %d lines were processed", cp.Line, len(done))
+			}
+			checkpoints = append(checkpoints, cp)
+			return nil
+		},
+	}, func(line []byte, offset int64) error {
+		mu.Lock()
+		defer mu.Unlock()
+		done[offset] = true
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if len(checkpoints) < 3 {
+		t.Fatalf("Expected several checkpoints, got %d", len(checkpoints))
+	}
+	for i := 1; i < len(checkpoints); i++ {
+		if checkpoints[i].Offset <= checkpoints[i-1].Offset {
+			t.Errorf("Checkpoints out of order: %d after %d", checkpoints[i].Offset, checkpoints[i-1].Offset)
+		}
+	}
+
+	// Every checkpoint still resumes exactly after its line
+	cp := checkpoints[len(checkpoints)/2]
+	var resumed int64
+	err = streamer.StreamWithOptions(context.Background(), "test-bucket", "test-key", StreamOptions{Checkpoint: &cp, Workers: 4},
+		func(line []byte, offset int64) error {
+			mu.Lock()
+			defer mu.Unlock()
+			resumed++
+			return nil
+		})
+	if err != nil || cp.Line+resumed != 4000 {
+		t.Errorf("Resumed %d lines after line %d: %v", resumed, cp.Line, err)
+	}
+}
+
+func TestStreamWithOptions_WorkersError(t *testing.T) {
+	streamer := NewS3Streamer(NewMockS3Client(checkpointTestLines(1000)))
+	errBad := errors.New("bad record")
+	err := streamer.StreamWithOptions(context.Background(), "test-bucket", "test-key", StreamOptions{Workers: 4},
+		func(line []byte, offset int64) error {
+			if offset > 10000 {
+				return errBad
+			}
+			return nil
+		})
+	if !errors.Is(err, errBad) {
+		t.Errorf("Expected worker error, got %v", err)
+	}
+
+	errCommit := errors.New("commit store down")
+	err = streamer.StreamWithOptions(context.Background(), "test-bucket", "test-key", StreamOptions{
+		Workers:  4,
+		OnCommit: func(int64) error { return errCommit },
+	}, func([]byte, int64) error { return nil })
+	if !errors.Is(err, errCommit) {
+		t.Errorf("Expected commit error, got %v", err)
+	}
+
+	err = streamer.StreamWithOptions(context.Background(), "test-bucket", "test-key", StreamOptions{
+		Workers:        4,
+		OversizePolicy: FragmentOversizeRecords,
+	}, func([]byte, int64) error { return nil })
+	if err == nil {
+		t.Error("Expected fragments to be rejected with multiple workers")
+	}
+}
+
+func TestStreamJSON_Workers(t *testing.T) {
+	streamer := NewS3Streamer(NewMockS3Client([]byte(jsonTestLines)))
+	var mu sync.Mutex
+	ids := map[int]bool{}
+	err := StreamJSON(context.Background(), streamer, "test-bucket", "test-key", JSONOptions{
+		StreamOptions: StreamOptions{Workers: 3},
+		ErrorPolicy:   SkipDecodeErrors,
+	}, func(record jsonTestRecord, offset int64) error {
+		mu.Lock()
+		defer mu.Unlock()
+		ids[record.ID] = true
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamJSON failed: %v", err)
+	}
+	if len(ids) != 3 || !ids[1] || !ids[2] || !ids[4] {
+		t.Errorf("Decoded ids %v", ids)
+	}
+}